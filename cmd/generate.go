@@ -32,7 +32,10 @@ The generate command will generate a minecraft game folder (vanilla or fabric) a
 			return
 		}
 
-		gen.Generate(debug, nil)
+		if err := gen.Generate(debug, nil); err != nil {
+			fmt.Println("❌ Failed to generate the pack:", err)
+			return
+		}
 	},
 }
 
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"limeal.fr/launchygo/pkg/game/folder"
+)
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen <private_key_path>",
+	Short: "Generate a key pair to sign the manifests",
+	Long: `Generate an ed25519 key pair to sign the published manifests.
+
+Arguments:
+  <private_key_path>  Where the private key is written (PEM), it must stay on the publisher side.
+
+The public key is printed, pin it in the launcher build:
+  go build -ldflags "-X limeal.fr/launchygo/pkg/game/folder/shared.MANIFEST_PUBLIC_KEYS=<public_key>"
+or give it to the launch command with --trust-key <public_key>.
+Then publish with --sign-key <private_key_path>.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		publicKey, err := folder.GenerateSigningKey(args[0])
+		if err != nil {
+			fmt.Println("❌ Failed to generate the key:", err)
+			return
+		}
+
+		fmt.Println("Private key written to", args[0])
+		fmt.Println("Public key:", folder.EncodePublicKey(publicKey))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keygenCmd)
+}
@@ -1,16 +1,30 @@
 package cmd
 
 import (
+	"crypto/ed25519"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"limeal.fr/launchygo/pkg/connectors"
 	"limeal.fr/launchygo/pkg/game/folder"
+	"limeal.fr/launchygo/pkg/utils"
 )
 
+var publishFormat string
+var publishDelta bool
+var publishChunks bool
+var publishChunkStore string
+var publishCompression string
+var publishSignKey string
+var publishChangelog string
+var publishChannel string
+var publishCatalog string
+
 var publishCmd = &cobra.Command{
 	Use:   "publish <pack_name> <uri>",
 	Short: "Publish a minecraft game folder",
@@ -22,7 +36,28 @@ Arguments:
   <output_uri>     The uri where the pack will be published.
 
 The publish command will publish a minecraft game folder, to do that it will first update the manifest.json with extra files (aka: mods, options, etc.).
-And then upload the pack to the specified uri.`,
+And then upload the pack to the specified uri.
+
+With --format zip or tar.gz, the whole pack (manifest.json included) is bundled in one archive,
+the uri is then the path of the archive (e.g: ./dist/my-pack.zip, file://./dist/my-pack.zip).
+The archive can be launched with the zip:// and tar:// connectors.
+
+With --delta, a binary patch from the previous published version is uploaded for each changed file,
+the players with the previous version only download the patch.
+
+With --chunks, the files are stored as content-defined chunks named by their checksum, a chunk shared by several
+files, versions or packs is only uploaded and downloaded once. --chunk-store sets the directory of the chunks
+relative to the pack (e.g: ../.chunks to share them between the packs published next to each other).
+
+With --compress gzip, the changed files are stored compressed (<path>.gz) when it saves at least 10%,
+the launcher decompresses them while downloading.
+
+With --sign-key, the manifest is signed with the ed25519 private key (see the keygen command),
+the launchers trusting its public key reject the unsigned and tampered manifests.
+
+Each publish is a new revision of the pack in the --channel (stable by default), the previous revisions stay
+downloadable with launch --revision. The pack is added to the catalog of the packs published next to each other
+(--catalog, ../index.json by default), see the list command.`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		packName := args[0]
@@ -38,10 +73,39 @@ And then upload the pack to the specified uri.`,
 			return
 		}
 
-		connector := connectors.FindConnectorFromURI(outputURI)
-		if connector == nil {
-			fmt.Println("❌ The uri provided is not valid")
-			fmt.Println("[Format] <scheme>://<path>")
+		var signingKey ed25519.PrivateKey
+		if publishSignKey != "" {
+			var err error
+			if signingKey, err = folder.LoadSigningKey(publishSignKey); err != nil {
+				fmt.Println("❌ Failed to load the signing key:", err)
+				return
+			}
+		}
+
+		var connector connectors.Connector
+		switch publishFormat {
+		case "dir":
+			var err error
+			connector, err = connectors.NewConnector(outputURI, connectors.Options{Network: networkOptions})
+			if err != nil {
+				fmt.Println("❌ The uri provided is not valid:", err)
+				fmt.Println("[Format] <scheme>://<path>")
+				cmd.Help()
+				return
+			}
+			connector = connectors.WithRetry(connector, utils.DefaultRetryPolicy)
+		case "zip", "tar.gz":
+			archivePath, err := archiveDestination(outputURI)
+			if err != nil {
+				fmt.Println("❌ The uri provided is not valid:", err)
+				fmt.Println("[Format] <path> or file://<path>")
+				cmd.Help()
+				return
+			}
+			connector = connectors.NewArchiveWriter(archivePath, connectors.ArchiveFormat(publishFormat))
+		default:
+			fmt.Println("❌ Unknown format:", publishFormat)
+			fmt.Println("Available formats: dir, zip, tar.gz")
 			cmd.Help()
 			return
 		}
@@ -54,13 +118,59 @@ And then upload the pack to the specified uri.`,
 			fmt.Println(err)
 			return
 		}
-		defer connector.Close()
+
+		// An archive holds one pack, without the directory of the catalog
+		catalog := publishCatalog
+		if publishFormat != "dir" {
+			catalog = folder.NO_CATALOG
+		}
 
 		fmt.Println("Publishing game folder")
-		folder.PublishGameFolder(connector, packName)
+		err = folder.PublishGameFolder(connector, packName, folder.PublishOptions{
+			Deltas:      publishDelta,
+			Chunks:      publishChunks || publishChunkStore != "",
+			ChunkStore:  publishChunkStore,
+			Compression: folder.Compression(publishCompression),
+			SigningKey:  signingKey,
+			Changelog:   publishChangelog,
+			Channel:     publishChannel,
+			Catalog:     catalog,
+		})
+		if err != nil {
+			fmt.Println("❌ Failed to publish the pack:", err)
+		}
+
+		// The archive is only written once closed
+		if err := connector.Close(); err != nil {
+			fmt.Println("❌ Failed to close the connector")
+			fmt.Println(err)
+		}
 	},
 }
 
+// archiveDestination returns the local path of the archive from a path or a file://, zip:// or tar:// uri
+func archiveDestination(uri string) (string, error) {
+	if !strings.Contains(uri, "://") {
+		return uri, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case connectors.FILE_SCHEME, connectors.ZIP_SCHEME, connectors.TAR_SCHEME:
+	default:
+		return "", fmt.Errorf("archives can only be written on the local disk, got %s://", u.Scheme)
+	}
+
+	archivePath := u.Host + u.Path
+	if archivePath == "" {
+		return "", fmt.Errorf("missing archive path")
+	}
+	return archivePath, nil
+}
+
 func listAvailablePacks() []string {
 	packsDir := "./packs"
 	entries, err := os.ReadDir(packsDir)
@@ -88,4 +198,13 @@ func listAvailablePacks() []string {
 
 func init() {
 	rootCmd.AddCommand(publishCmd)
+	publishCmd.Flags().StringVar(&publishFormat, "format", "dir", "The output format (available: dir, zip, tar.gz)")
+	publishCmd.Flags().BoolVar(&publishDelta, "delta", false, "Publish binary patches from the previous version of the changed files")
+	publishCmd.Flags().BoolVar(&publishChunks, "chunks", false, "Store the files as deduplicated content-defined chunks")
+	publishCmd.Flags().StringVar(&publishChunkStore, "chunk-store", "", "Directory of the chunks relative to the pack, implies --chunks (default .chunks)")
+	publishCmd.Flags().StringVar(&publishCompression, "compress", "", "Store the files compressed (available: gzip, or a registered compression)")
+	publishCmd.Flags().StringVar(&publishSignKey, "sign-key", "", "PEM ed25519 private key signing the manifest (see keygen)")
+	publishCmd.Flags().StringVar(&publishChangelog, "changelog", "", "Changes of the published revision")
+	publishCmd.Flags().StringVar(&publishCatalog, "catalog", "", "Path of the catalog of the packs relative to the pack, - to leave it as is (default ../index.json)")
+	publishCmd.Flags().StringVar(&publishChannel, "channel", "", "Release channel of the published revision, e.g. beta (default stable)")
 }
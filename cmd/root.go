@@ -2,20 +2,36 @@ package cmd
 
 import (
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"limeal.fr/launchygo/pkg/utils"
 )
 
 var debug bool
+var retries int
+var requestTimeout time.Duration
+var networkOptions utils.NetworkOptions
 
 var rootCmd = &cobra.Command{
 	Use:   "launchygo",
 	Short: "launchygo is a tool for generating and launching minecraft",
 	Long:  `launchygo is a tool for generating and launching minecraft. It provides a command line interface for generating and launching minecraft.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		utils.DefaultRetryPolicy.MaxAttempts = retries
+		utils.DefaultRetryPolicy.RequestTimeout = requestTimeout
+		return utils.ConfigureHTTPClient(networkOptions)
+	},
 }
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "Enable debug mode")
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", utils.DefaultRetryPolicy.MaxAttempts, "Number of attempts of the network operations (1 to disable the retries)")
+	rootCmd.PersistentFlags().StringVar(&networkOptions.Proxy, "proxy", "", "Proxy of the network connections (http://, socks5://, socks5h://), default to HTTP_PROXY / HTTPS_PROXY / NO_PROXY, \"direct\" for none")
+	rootCmd.PersistentFlags().StringVar(&networkOptions.CAFile, "cacert", "", "PEM bundle of the certificate authorities to trust in addition to the system ones")
+	rootCmd.PersistentFlags().StringVar(&networkOptions.CertFile, "cert", "", "PEM client certificate for the servers requiring mTLS (with --key)")
+	rootCmd.PersistentFlags().StringVar(&networkOptions.KeyFile, "key", "", "PEM private key of the client certificate")
+	rootCmd.PersistentFlags().DurationVar(&requestTimeout, "request-timeout", utils.DefaultRetryPolicy.RequestTimeout, "Timeout of a network request until the server answers (0 for none)")
 }
 
 func Execute() {
@@ -28,7 +28,9 @@ func main() {
 	fmt.Printf("Creating Vanilla pack '%s' for version %s...\n", packName, version)
 
 	vanillaGen := generator.InitVanillaGenerator(packName, version)
-	vanillaGen.Generate(false, progressCallback)
+	if err := vanillaGen.Generate(false, progressCallback); err != nil {
+		log.Fatal("Failed to generate pack:", err)
+	}
 	fmt.Println("✅ Pack generated successfully!")
 	fmt.Println()
 
@@ -42,14 +44,19 @@ func main() {
 	}
 
 	// Connect to server and publish
-	serverConnector := connectors.FindConnectorFromURI("file://" + serverDir)
+	serverConnector, err := connectors.NewConnector("file://" + serverDir)
+	if err != nil {
+		log.Fatal("Invalid server uri:", err)
+	}
 	if err := serverConnector.Connect(); err != nil {
 		log.Fatal("Failed to connect to server:", err)
 	}
 	defer serverConnector.Close()
 
 	fmt.Printf("Publishing pack to: %s\n", serverDir)
-	folder.PublishGameFolder(serverConnector, packName)
+	if err := folder.PublishGameFolder(serverConnector, packName); err != nil {
+		log.Fatal("Failed to publish the pack:", err)
+	}
 	fmt.Println("✅ Pack published successfully!")
 	fmt.Println()
 
@@ -59,7 +66,10 @@ func main() {
 
 	// Connect to published pack
 	publishedPackURI := "file://" + serverDir
-	launchConnector := connectors.FindConnectorFromURI(publishedPackURI)
+	launchConnector, err := connectors.NewConnector(publishedPackURI)
+	if err != nil {
+		log.Fatal("Invalid published pack uri:", err)
+	}
 	if err := launchConnector.Connect(); err != nil {
 		log.Fatal("Failed to connect to published pack:", err)
 	}
@@ -3,11 +3,15 @@ module limeal.fr/launchygo
 go 1.23.4
 
 require (
+	github.com/jlaffaye/ftp v0.2.0
 	github.com/spf13/cobra v1.10.1
 	golang.org/x/crypto v0.33.0
+	golang.org/x/net v0.35.0
 )
 
 require (
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/kr/fs v0.1.0 // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
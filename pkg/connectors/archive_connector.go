@@ -0,0 +1,430 @@
+package connectors
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const ZIP_SCHEME = "zip"
+const TAR_SCHEME = "tar"
+
+type ArchiveFormat string
+
+const (
+	ArchiveFormatZip   ArchiveFormat = "zip"
+	ArchiveFormatTar   ArchiveFormat = "tar"    // Read: compressed with gzip or not
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz" // Write only, the reader detects the compression
+)
+
+/**
+* Read-only connector serving a pack bundled in a zip or tar (.tar, .tar.gz) archive
+* Example:
+* ```
+* zip://./dist/my-pack.zip
+* tar:///media/usb/my-pack.tar.gz
+* zip://./dist/packs.zip?root=my-pack (pack in a sub directory of the archive)
+* ```
+* A tar.gz archive is decompressed in a temporary file on Connect, so files can be opened in any order
+ */
+type ArchiveConnector struct {
+	Path   string // Path of the archive on the local disk
+	Format ArchiveFormat
+	Root   string // Directory of the pack inside the archive, query: root
+
+	file     *os.File
+	tmpPath  string                   // Decompressed copy of a tar.gz archive
+	entries  map[string]*archiveEntry // path relative to the root => file
+	children map[string][]os.FileInfo // directory relative to the root => direct children
+}
+
+type archiveEntry struct {
+	info    os.FileInfo
+	zipFile *zip.File
+	offset  int64 // Offset of the content in the tar file
+}
+
+func newArchiveConnector(u *url.URL, options Options) (Connector, error) {
+	archivePath := u.Host + u.Path
+	if archivePath == "" {
+		return nil, fmt.Errorf("missing archive path")
+	}
+
+	// if the path start with ./ use PWD
+	if strings.HasPrefix(archivePath, "./") {
+		pwd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pwd: %w", err)
+		}
+		archivePath = filepath.Join(pwd, strings.TrimPrefix(archivePath, "./"))
+	}
+
+	format := ArchiveFormatTar
+	if u.Scheme == ZIP_SCHEME {
+		format = ArchiveFormatZip
+	}
+
+	return &ArchiveConnector{
+		Path:   archivePath,
+		Format: format,
+		Root:   strings.Trim(options.Get(u, "root"), "/"),
+	}, nil
+}
+
+func (c *ArchiveConnector) GetPath() string {
+	return c.Path
+}
+
+func (c *ArchiveConnector) GetURI() string {
+	uri := c.GetScheme() + "://" + c.Path
+	if c.Root != "" {
+		uri += "?root=" + url.QueryEscape(c.Root)
+	}
+	return uri
+}
+
+// Connect opens the archive and indexes its files
+func (c *ArchiveConnector) Connect() error {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	c.file = f
+	c.entries = map[string]*archiveEntry{}
+	c.children = map[string][]os.FileInfo{}
+
+	if c.Format == ArchiveFormatZip {
+		err = c.indexZip()
+	} else {
+		err = c.indexTar()
+	}
+	if err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *ArchiveConnector) indexZip() error {
+	st, err := c.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader, err := zip.NewReader(c.file, st.Size())
+	if err != nil {
+		return fmt.Errorf("failed to read zip archive: %w", err)
+	}
+
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		c.addEntry(file.Name, &archiveEntry{info: file.FileInfo(), zipFile: file})
+	}
+	return nil
+}
+
+func (c *ArchiveConnector) indexTar() error {
+	// gzip can't be read at an offset, the archive is decompressed once in a temporary file
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(c.file, magic); err != nil {
+		return fmt.Errorf("failed to read tar archive: %w", err)
+	}
+	if _, err := c.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		if err := c.decompress(); err != nil {
+			return err
+		}
+	}
+
+	counter := &countingReader{reader: bufio.NewReader(c.file)}
+	reader := tar.NewReader(counter)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// The tar reader consumes the headers exactly, the content starts at the current position
+		c.addEntry(header.Name, &archiveEntry{info: header.FileInfo(), offset: counter.read})
+	}
+	return nil
+}
+
+// decompress replaces the file by a decompressed copy of the tar.gz archive
+func (c *ArchiveConnector) decompress() error {
+	gz, err := gzip.NewReader(c.file)
+	if err != nil {
+		return fmt.Errorf("failed to read tar.gz archive: %w", err)
+	}
+	defer gz.Close()
+
+	tmp, err := os.CreateTemp("", "launchygo-*.tar")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	c.tmpPath = tmp.Name()
+
+	if _, err := io.Copy(tmp, gz); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to decompress tar.gz archive: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	c.file.Close()
+	c.file = tmp
+	return nil
+}
+
+// addEntry indexes the file and its parent directories, files outside of the root are ignored
+func (c *ArchiveConnector) addEntry(name string, entry *archiveEntry) {
+	name = path.Clean(strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/"))
+	if c.Root != "" {
+		if !strings.HasPrefix(name, c.Root+"/") {
+			return
+		}
+		name = strings.TrimPrefix(name, c.Root+"/")
+	}
+	if name == "." || strings.HasPrefix(name, "../") {
+		return
+	}
+	if _, ok := c.entries[name]; ok {
+		// Like tar, the last entry wins
+		c.removeChild(name)
+	}
+
+	// Synthesize the parent directories, the archives don't always contain their entries
+	missing := []string{}
+	for dir := parentDir(name); dir != ""; dir = parentDir(dir) {
+		if _, ok := c.children[dir]; ok {
+			break
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		dir := missing[i]
+		c.children[dir] = []os.FileInfo{}
+		c.children[parentDir(dir)] = append(c.children[parentDir(dir)], &archiveFileInfo{name: path.Base(dir), dir: true})
+	}
+
+	// The name of the raw entry keeps its backslashes
+	if entry.info.Name() != path.Base(name) {
+		entry.info = &renamedFileInfo{FileInfo: entry.info, name: path.Base(name)}
+	}
+	c.entries[name] = entry
+	c.children[parentDir(name)] = append(c.children[parentDir(name)], entry.info)
+}
+
+func (c *ArchiveConnector) removeChild(name string) {
+	dir := parentDir(name)
+	for i, child := range c.children[dir] {
+		if child.Name() == path.Base(name) {
+			c.children[dir] = append(c.children[dir][:i], c.children[dir][i+1:]...)
+			return
+		}
+	}
+}
+
+// parentDir returns the parent directory of the path, "" for the root
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func (c *ArchiveConnector) Login() error {
+	return nil
+}
+
+func (c *ArchiveConnector) formatPath(remotePath string) string {
+	remotePath = path.Clean(strings.Trim(strings.ReplaceAll(remotePath, "\\", "/"), "/"))
+	if remotePath == "." {
+		return ""
+	}
+	return remotePath
+}
+
+func (c *ArchiveConnector) ReadFile(remotePath string, dest any) error {
+	bytes, err := c.ReadFileBytes(remotePath, -1)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, dest)
+}
+
+func (c *ArchiveConnector) ReadFileBytes(remotePath string, size int64) ([]byte, error) {
+	rc, _, err := c.Open(remotePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (c *ArchiveConnector) SendFile(remotePath string, localPath string) error {
+	return fmt.Errorf("Archive connector does not support SendFile")
+}
+
+func (c *ArchiveConnector) SendFileFromBytes(remotePath string, bytes []byte, perm ...fs.FileMode) error {
+	return fmt.Errorf("Archive connector does not support SendFileFromBytes")
+}
+
+func (c *ArchiveConnector) Open(remotePath string) (io.ReadCloser, int64, error) {
+	if c.entries == nil {
+		return nil, 0, fmt.Errorf("archive connector is not connected")
+	}
+
+	entry, ok := c.entries[c.formatPath(remotePath)]
+	if !ok {
+		return nil, 0, &fs.PathError{Op: "open", Path: remotePath, Err: fs.ErrNotExist}
+	}
+
+	if entry.zipFile != nil {
+		rc, err := entry.zipFile.Open()
+		if err != nil {
+			return nil, 0, err
+		}
+		return rc, entry.info.Size(), nil
+	}
+
+	// Concurrent reads are safe, SectionReader uses ReadAt
+	section := io.NewSectionReader(c.file, entry.offset, entry.info.Size())
+	return io.NopCloser(section), entry.info.Size(), nil
+}
+
+func (c *ArchiveConnector) Create(remotePath string, perm fs.FileMode) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("Archive connector does not support Create")
+}
+
+/**
+* List all files and directories in the given path
+* Example:
+* ```
+* files, err := connector.List("path/subpath")
+* ```
+ */
+func (c *ArchiveConnector) List(remotePath string) ([]os.FileInfo, error) {
+	children, ok := c.children[c.formatPath(remotePath)]
+	if !ok {
+		return nil, fmt.Errorf("failed to list files: %w", &fs.PathError{Op: "list", Path: remotePath, Err: fs.ErrNotExist})
+	}
+
+	files := append([]os.FileInfo{}, children...)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+	return files, nil
+}
+
+func (c *ArchiveConnector) Delete(remotePath string) error {
+	return fmt.Errorf("Archive connector does not support Delete")
+}
+
+func (c *ArchiveConnector) Rename(oldPath string, newPath string) error {
+	return fmt.Errorf("Archive connector does not support Rename")
+}
+
+func (c *ArchiveConnector) Walk(remotePath string, fn WalkFunc) error {
+	return walk(c, remotePath, fn)
+}
+
+func (c *ArchiveConnector) GetScheme() string {
+	if c.Format == ArchiveFormatZip {
+		return ZIP_SCHEME
+	}
+	return TAR_SCHEME
+}
+
+func (c *ArchiveConnector) IsConnected() bool {
+	return c.file != nil
+}
+
+func (c *ArchiveConnector) Close() error {
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+	if c.tmpPath != "" {
+		os.Remove(c.tmpPath)
+		c.tmpPath = ""
+	}
+	c.entries = nil
+	c.children = nil
+	return nil
+}
+
+func (c *ArchiveConnector) HasFile(remotePath string) bool {
+	_, ok := c.entries[c.formatPath(remotePath)]
+	return ok
+}
+
+func (c *ArchiveConnector) HasFileWithChecksum(remotePath string, checksumType ChecksumType, checksum string) bool {
+	return hasFileWithChecksum(c, remotePath, checksumType, checksum)
+}
+
+// countingReader counts the bytes read, used to find the offset of the tar entries
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// archiveFileInfo implements os.FileInfo for the directories of the archive
+type archiveFileInfo struct {
+	name string
+	dir  bool
+}
+
+func (f *archiveFileInfo) Name() string       { return f.name }
+func (f *archiveFileInfo) Size() int64        { return 0 }
+func (f *archiveFileInfo) ModTime() time.Time { return time.Time{} }
+func (f *archiveFileInfo) IsDir() bool        { return f.dir }
+func (f *archiveFileInfo) Sys() any           { return nil }
+
+func (f *archiveFileInfo) Mode() fs.FileMode {
+	if f.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// renamedFileInfo is the info of an archive entry with its cleaned name
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (f *renamedFileInfo) Name() string { return f.name }
@@ -0,0 +1,191 @@
+package connectors
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// archiveEntries are written in order, the same name can be written twice
+type archiveEntries [][2]string
+
+func writeTestZip(t *testing.T, entries archiveEntries) string {
+	t.Helper()
+	archivePath := filepath.Join(t.TempDir(), "pack.zip")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, entry := range entries {
+		entryWriter, err := w.Create(entry[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(entryWriter, entry[1])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func writeTestTarGz(t *testing.T, entries archiveEntries) string {
+	t.Helper()
+	archivePath := filepath.Join(t.TempDir(), "pack.tar.gz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	w := tar.NewWriter(gz)
+	for _, entry := range entries {
+		w.WriteHeader(&tar.Header{Name: entry[0], Mode: 0644, Size: int64(len(entry[1])), Typeflag: tar.TypeReg})
+		io.WriteString(w, entry[1])
+	}
+	w.Close()
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func connectArchive(t *testing.T, uri string) Connector {
+	t.Helper()
+	connector, err := NewConnector(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connector.Close() })
+	return connector
+}
+
+func listNames(t *testing.T, connector Connector, remotePath string) []string {
+	t.Helper()
+	files, err := connector.List(remotePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return names
+}
+
+func TestArchiveConnectorPaths(t *testing.T) {
+	archivePath := writeTestZip(t, archiveEntries{
+		{"my-pack/manifest.json", `{"version":"1.0"}`},
+		{"my-pack/./mods/../mods/a.jar", "a"},
+		{"/my-pack/config//b.cfg", "b"},
+		{"my-pack\\config\\c.cfg", "c"},
+		{"my-pack/../evil.txt", "evil"},
+		{"other/d.txt", "d"},
+	})
+	connector := connectArchive(t, "zip://"+archivePath+"?root=my-pack")
+
+	// The entry names and the requested paths are cleaned the same way
+	for path, content := range map[string]string{
+		"mods/a.jar":      "a",
+		"/mods//a.jar":    "a",
+		"config/b.cfg":    "b",
+		"config\\c.cfg":   "c",
+		"./manifest.json": `{"version":"1.0"}`,
+	} {
+		if data, err := connector.ReadFileBytes(path, -1); err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v, want %q", path, data, err, content)
+		}
+	}
+
+	// The files outside of the root are not served
+	for _, path := range []string{"../evil.txt", "evil.txt", "../other/d.txt", "mods/../../other/d.txt"} {
+		if connector.HasFile(path) {
+			t.Errorf("%s served from outside of the root", path)
+		}
+	}
+	if _, _, err := connector.Open("../other/d.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("err = %v, want fs.ErrNotExist", err)
+	}
+
+	if got := listNames(t, connector, ""); !slices.Equal(got, []string{"config", "manifest.json", "mods"}) {
+		t.Errorf("root = %v", got)
+	}
+	if got := listNames(t, connector, "/config/"); !slices.Equal(got, []string{"b.cfg", "c.cfg"}) {
+		t.Errorf("config = %v", got)
+	}
+}
+
+func TestArchiveConnectorTarGz(t *testing.T) {
+	archivePath := writeTestTarGz(t, archiveEntries{
+		{"manifest.json", "{}"},
+		{"mods/a.jar", "old"},
+		{"mods/a.jar", "new"},
+		{"libraries/net/foo.jar", "foo"},
+	})
+	connector := connectArchive(t, "tar://"+archivePath)
+
+	// Like tar, the last entry wins
+	if data, err := connector.ReadFileBytes("mods/a.jar", -1); err != nil || string(data) != "new" {
+		t.Errorf("mods/a.jar = %q, %v, want the last entry", data, err)
+	}
+	if got := listNames(t, connector, "mods"); !slices.Equal(got, []string{"a.jar"}) {
+		t.Errorf("mods = %v", got)
+	}
+
+	walked := []string{}
+	connector.Walk("", func(remotePath string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			walked = append(walked, remotePath)
+		}
+		return err
+	})
+	slices.Sort(walked)
+	if want := []string{"libraries/net/foo.jar", "manifest.json", "mods/a.jar"}; !slices.Equal(walked, want) {
+		t.Errorf("walked %v, want %v", walked, want)
+	}
+
+	if err := connector.SendFileFromBytes("mods/b.jar", []byte("b")); err == nil {
+		t.Error("archive connector written")
+	}
+}
+
+func TestArchiveWriterRoundTrip(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveFormatZip, ArchiveFormatTarGz} {
+		archivePath := filepath.Join(t.TempDir(), "my-pack."+string(format))
+		writer := NewArchiveWriter(archivePath, format)
+		if err := writer.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		writer.SendFileFromBytes("/mods\\a.jar", []byte("a"))
+		w, _ := writer.Create("config/./b.cfg", 0644)
+		io.WriteString(w, "b")
+		w.Close()
+		if err := writer.SendFileFromBytes("mods/a.jar", []byte("again")); err == nil {
+			t.Errorf("%s: file written twice", format)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		connector := connectArchive(t, writer.GetURI())
+		for path, content := range map[string]string{"mods/a.jar": "a", "config/b.cfg": "b"} {
+			if data, err := connector.ReadFileBytes(path, -1); err != nil || string(data) != content {
+				t.Errorf("%s: %s = %q, %v, want %q", format, path, data, err, content)
+			}
+		}
+	}
+}
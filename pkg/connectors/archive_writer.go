@@ -0,0 +1,289 @@
+package connectors
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+* ArchiveWriter is a write-only connector bundling the published files in a zip or tar.gz archive
+* The archive is written next to its path and only moved there on Close, a failed publish leaves no partial archive
+* It never holds a previous manifest, so PublishGameFolder sends every file
+* Example:
+* ```
+* writer := connectors.NewArchiveWriter("./dist/my-pack.zip", connectors.ArchiveFormatZip)
+* writer.Connect()
+* if err := folder.PublishGameFolder(writer, "my-pack"); err != nil {
+*     writer.Close()
+*     return err
+* }
+* err := writer.Close()
+* ```
+ */
+type ArchiveWriter struct {
+	Path   string
+	Format ArchiveFormat
+
+	mu        sync.Mutex // One entry is written at a time
+	file      *os.File
+	gz        *gzip.Writer
+	zipWriter *zip.Writer
+	tarWriter *tar.Writer
+	written   map[string]bool
+	failed    bool
+}
+
+func NewArchiveWriter(archivePath string, format ArchiveFormat) *ArchiveWriter {
+	return &ArchiveWriter{Path: archivePath, Format: format}
+}
+
+func (w *ArchiveWriter) GetPath() string {
+	return w.Path
+}
+
+func (w *ArchiveWriter) GetURI() string {
+	if w.Format == ArchiveFormatZip {
+		return ZIP_SCHEME + "://" + w.Path
+	}
+	return TAR_SCHEME + "://" + w.Path
+}
+
+// Connect creates the temporary archive
+func (w *ArchiveWriter) Connect() error {
+	switch w.Format {
+	case ArchiveFormatZip, ArchiveFormatTar, ArchiveFormatTarGz:
+	default:
+		return fmt.Errorf("unsupported archive format: %s", w.Format)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.OpenFile(w.Path+".part", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	w.file = f
+	w.written = map[string]bool{}
+	w.failed = false
+	switch w.Format {
+	case ArchiveFormatZip:
+		w.zipWriter = zip.NewWriter(f)
+	case ArchiveFormatTar:
+		w.tarWriter = tar.NewWriter(f)
+	case ArchiveFormatTarGz:
+		w.gz = gzip.NewWriter(f)
+		w.tarWriter = tar.NewWriter(w.gz)
+	}
+	return nil
+}
+
+func (w *ArchiveWriter) Login() error {
+	return nil
+}
+
+func (w *ArchiveWriter) formatPath(remotePath string) string {
+	return path.Clean(strings.Trim(strings.ReplaceAll(remotePath, "\\", "/"), "/"))
+}
+
+// add writes an entry of the archive, the size is required by the tar header
+func (w *ArchiveWriter) add(remotePath string, r io.Reader, size int64, perm fs.FileMode) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return fmt.Errorf("archive writer is not connected")
+	}
+	name := w.formatPath(remotePath)
+	if w.written[name] {
+		return fmt.Errorf("file already in the archive: %s", name)
+	}
+
+	err := w.write(name, r, size, perm)
+	if err != nil {
+		// The archive is corrupted once an entry is partially written
+		w.failed = true
+		return fmt.Errorf("failed to add %s to the archive: %w", name, err)
+	}
+	w.written[name] = true
+	return nil
+}
+
+func (w *ArchiveWriter) write(name string, r io.Reader, size int64, perm fs.FileMode) error {
+	if w.zipWriter != nil {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+		header.SetMode(perm)
+		entry, err := w.zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, r)
+		return err
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     int64(perm.Perm()),
+		ModTime:  time.Now(),
+	}
+	if err := w.tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tarWriter, r)
+	return err
+}
+
+func (w *ArchiveWriter) ReadFile(remotePath string, dest any) error {
+	return &fs.PathError{Op: "read", Path: remotePath, Err: fs.ErrNotExist}
+}
+
+func (w *ArchiveWriter) ReadFileBytes(remotePath string, size int64) ([]byte, error) {
+	return nil, &fs.PathError{Op: "read", Path: remotePath, Err: fs.ErrNotExist}
+}
+
+func (w *ArchiveWriter) SendFile(remotePath string, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return w.add(remotePath, f, st.Size(), st.Mode().Perm())
+}
+
+func (w *ArchiveWriter) SendFileFromBytes(remotePath string, data []byte, perm ...fs.FileMode) error {
+	mode := fs.FileMode(0644)
+	if len(perm) > 0 {
+		mode = perm[0]
+	}
+	return w.add(remotePath, bytes.NewReader(data), int64(len(data)), mode)
+}
+
+func (w *ArchiveWriter) Open(remotePath string) (io.ReadCloser, int64, error) {
+	return nil, 0, fmt.Errorf("Archive writer does not support Open")
+}
+
+// Create buffers the file in a temp file, it is added to the archive on close
+func (w *ArchiveWriter) Create(remotePath string, perm fs.FileMode) (io.WriteCloser, error) {
+	tmp, err := os.CreateTemp("", "launchygo-*.part")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return &archiveEntryWriter{File: tmp, archive: w, remotePath: remotePath, perm: perm}, nil
+}
+
+func (w *ArchiveWriter) List(remotePath string) ([]os.FileInfo, error) {
+	return nil, fmt.Errorf("Archive writer does not support List")
+}
+
+func (w *ArchiveWriter) Delete(remotePath string) error {
+	return fmt.Errorf("Archive writer does not support Delete")
+}
+
+func (w *ArchiveWriter) Rename(oldPath string, newPath string) error {
+	return fmt.Errorf("Archive writer does not support Rename")
+}
+
+func (w *ArchiveWriter) Walk(remotePath string, fn WalkFunc) error {
+	return fmt.Errorf("Archive writer does not support Walk")
+}
+
+func (w *ArchiveWriter) GetScheme() string {
+	if w.Format == ArchiveFormatZip {
+		return ZIP_SCHEME
+	}
+	return TAR_SCHEME
+}
+
+func (w *ArchiveWriter) IsConnected() bool {
+	return w.file != nil
+}
+
+// Close finalizes the archive and moves it to its path, the archive is discarded if an entry failed
+func (w *ArchiveWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	tmpPath := w.file.Name()
+
+	var err error
+	if w.zipWriter != nil {
+		err = w.zipWriter.Close()
+	} else {
+		err = w.tarWriter.Close()
+		if w.gz != nil && err == nil {
+			err = w.gz.Close()
+		}
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file, w.gz, w.zipWriter, w.tarWriter = nil, nil, nil, nil
+
+	if err == nil && w.failed {
+		err = fmt.Errorf("archive is incomplete, a file failed to be added")
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return os.Rename(tmpPath, w.Path)
+}
+
+func (w *ArchiveWriter) HasFile(remotePath string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written[w.formatPath(remotePath)]
+}
+
+func (w *ArchiveWriter) HasFileWithChecksum(remotePath string, checksumType ChecksumType, checksum string) bool {
+	return false
+}
+
+// archiveEntryWriter buffers an entry of the archive in a temp file
+type archiveEntryWriter struct {
+	*os.File
+	archive    *ArchiveWriter
+	remotePath string
+	perm       fs.FileMode
+}
+
+func (w *archiveEntryWriter) Close() error {
+	defer os.Remove(w.File.Name())
+	defer w.File.Close()
+
+	size, err := w.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := w.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return w.archive.add(w.remotePath, w.File, size, w.perm)
+}
+
+func (w *archiveEntryWriter) Cancel() error {
+	w.File.Close()
+	return os.Remove(w.File.Name())
+}
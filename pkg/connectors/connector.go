@@ -1,8 +1,23 @@
 package connectors
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+
+	"limeal.fr/launchygo/pkg/utils"
 )
 
 type ChecksumType int
@@ -13,8 +28,6 @@ const (
 )
 
 type Connector interface {
-	NewFromURI(uri string) Connector
-
 	GetPath() string
 	GetURI() string
 
@@ -27,6 +40,21 @@ type Connector interface {
 	SendFile(remotePath string, localPath string) error
 	SendFileFromBytes(remotePath string, bytes []byte, perm ...fs.FileMode) error
 
+	// Open opens the remote file for streaming, it returns the size of the file (-1 if unknown)
+	Open(remotePath string) (io.ReadCloser, int64, error)
+	// Create returns a writer on the remote file, the file is only visible at its final path once the writer is closed
+	// Use CancelWriter to discard a partially written file
+	Create(remotePath string, perm fs.FileMode) (io.WriteCloser, error)
+
+	// List returns the files and directories of the remote directory
+	List(remotePath string) ([]os.FileInfo, error)
+	// Delete removes a remote file (or an empty directory)
+	Delete(remotePath string) error
+	// Rename moves a remote file, the destination is overwritten if it exists
+	Rename(oldPath string, newPath string) error
+	// Walk walks the remote tree rooted at remotePath, see WalkFunc
+	Walk(remotePath string, fn WalkFunc) error
+
 	GetScheme() string // ftp, sftp, etc.
 	IsConnected() bool
 	Close() error
@@ -35,19 +63,431 @@ type Connector interface {
 	HasFileWithChecksum(remotePath string, checksumType ChecksumType, checksum string) bool
 }
 
-var CONNECTORS = map[string]Connector{
-	"sftp":  new(SFTPConnector),
-	"file":  new(FileConnector),
-	"http":  new(HttpConnector),
-	"https": new(HttpConnector),
+// RangeConnector is implemented by the connectors able to open a remote file at an offset (resumable downloads)
+type RangeConnector interface {
+	// OpenRange opens the remote file starting at offset and returns the size of the remaining content (-1 if unknown)
+	// ifRange is the validator returned when the partial content was opened, the whole file is returned if it changed since
+	// If the server can't send a range the whole file is returned and resumed is false
+	// The returned validator identifies the version of the opened file, empty if the connector has none
+	OpenRange(remotePath string, offset int64, ifRange string) (rc io.ReadCloser, size int64, validator string, resumed bool, err error)
+}
+
+// CancelableWriter is implemented by the writers returned by Create
+// Cancel discards the written data instead of publishing the file
+type CancelableWriter interface {
+	io.WriteCloser
+	Cancel() error
+}
+
+// CancelWriter discards a writer returned by Create, if the writer can't be canceled it is closed
+func CancelWriter(w io.WriteCloser) error {
+	if cw, ok := w.(CancelableWriter); ok {
+		return cw.Cancel()
+	}
+	return w.Close()
+}
+
+// ConcurrencyLimiter is implemented by the connectors which can only serve a limited number of parallel operations
+// (e.g. a pool of connections), the download scheduler doesn't start more workers than MaxConcurrency
+type ConcurrencyLimiter interface {
+	MaxConcurrency() int
+}
+
+// WalkFunc is called by Walk for each file and directory, remotePath is relative to the connector root
+// Like filepath.WalkFunc, returning fs.SkipDir skips the directory and fs.SkipAll stops the walk
+type WalkFunc func(remotePath string, info os.FileInfo, err error) error
+
+// walk implements Walk on top of List, directories are visited before their content
+func walk(c Connector, root string, fn WalkFunc) error {
+	root = strings.Trim(strings.ReplaceAll(root, "\\", "/"), "/")
+	err := walkDir(c, root, fn)
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func walkDir(c Connector, dir string, fn WalkFunc) error {
+	files, err := c.List(dir)
+	if err != nil {
+		return fn(dir, nil, err)
+	}
+
+	for _, file := range files {
+		remotePath := path.Join(dir, file.Name())
+		err := fn(remotePath, file, nil)
+		if err == nil && file.IsDir() {
+			err = walkDir(c, remotePath, fn)
+		}
+		if err != nil {
+			if errors.Is(err, fs.SkipDir) && file.IsDir() {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// checksumExtension returns the extension of the sidecar files (e.g. foo.jar.sha1)
+func (t ChecksumType) checksumExtension() string {
+	switch t {
+	case ChecksumTypeSHA1:
+		return ".sha1"
+	case ChecksumTypeSHA256:
+		return ".sha256"
+	}
+	return ""
+}
+
+// hexLength returns the length of the hex encoded checksum
+func (t ChecksumType) hexLength() int {
+	switch t {
+	case ChecksumTypeSHA1:
+		return 40
+	case ChecksumTypeSHA256:
+		return 64
+	}
+	return 0
+}
+
+// parseChecksum extracts the checksum of a "<checksum>  <file>" line (sha1sum output or sidecar file)
+// An empty string is returned if it is not a valid checksum of the given type
+func parseChecksum(checksumType ChecksumType, content string) string {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	checksum := strings.ToLower(fields[0])
+	if len(checksum) != checksumType.hexLength() {
+		return ""
+	}
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return ""
+	}
+	return checksum
+}
+
+// sidecarChecksum reads the checksum from the sidecar file (e.g. foo.jar.sha1) if it exists
+func sidecarChecksum(c Connector, remotePath string, checksumType ChecksumType) string {
+	extension := checksumType.checksumExtension()
+	if extension == "" {
+		return ""
+	}
+
+	content, err := c.ReadFileBytes(remotePath+extension, -1)
+	if err != nil {
+		return ""
+	}
+	return parseChecksum(checksumType, string(content))
+}
+
+// hasFileWithChecksum streams the remote file and compares its checksum
+func hasFileWithChecksum(c Connector, remotePath string, checksumType ChecksumType, checksum string) bool {
+	rc, _, err := c.Open(remotePath)
+	if err != nil {
+		return false
+	}
+
+	switch checksumType {
+	case ChecksumTypeSHA1:
+		sha1, err := utils.ReaderSHA1(rc)
+		return err == nil && sha1 == checksum
+	case ChecksumTypeSHA256:
+		sha256, err := utils.ReaderSHA256(rc)
+		return err == nil && sha256 == checksum
+	}
+	rc.Close()
+	return true
+}
+
+/////////////////////////////////////////////////////////////////////
+// Registry
+/////////////////////////////////////////////////////////////////////
+
+// Factory creates a connector from a parsed uri, the options complement (and take precedence over) the query parameters
+type Factory func(u *url.URL, options Options) (Connector, error)
+
+// Options are given to the connector factories
+type Options struct {
+	// Values are backend specific settings, named like the query parameters they replace (e.g. "region" for s3)
+	Values map[string]string
+	// SFTP are the keys, agent and host key verification options of the sftp connector
+	SFTP SFTPOptions
+	// HTTP are the bearer token and the url signer of the http connector
+	HTTP HTTPOptions
+	// Network are the proxy, CA bundle and client certificate of the http, webdav and s3 connectors (proxy only for sftp)
+	Network utils.NetworkOptions
+}
+
+// Get returns the value of the option, or the query parameter of the uri with the same name
+func (o Options) Get(u *url.URL, key string) string {
+	if v, ok := o.Values[key]; ok {
+		return v
+	}
+	return u.Query().Get(key)
+}
+
+// networkOptionKeys are the query parameters of the network options
+var networkOptionKeys = []string{"proxy", "cacert", "cert", "key"}
+
+// network returns the network options, completed by the query parameters proxy, cacert, cert and key
+func (o Options) network(u *url.URL) utils.NetworkOptions {
+	return o.Network.Merge(utils.NetworkOptions{
+		Proxy:    o.Get(u, "proxy"),
+		CAFile:   expandHome(o.Get(u, "cacert")),
+		CertFile: expandHome(o.Get(u, "cert")),
+		KeyFile:  expandHome(o.Get(u, "key")),
+	})
+}
+
+// httpClient returns the client of the http based connectors, the shared client without network options
+func (o Options) httpClient(u *url.URL) (*http.Client, error) {
+	client, err := utils.NewHTTPClient(o.network(u))
+	if err != nil {
+		return nil, fmt.Errorf("invalid network options: %w", err)
+	}
+	return client, nil
+}
+
+// poolSize returns the "pool" option (number of connections of the pooled connectors) or def when it isn't set
+func (o Options) poolSize(u *url.URL, def int) (int, error) {
+	value := o.Get(u, "pool")
+	if value == "" {
+		return def, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid pool option %q: must be a positive number", value)
+	}
+	return size, nil
+}
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      = map[string]Factory{}
+)
+
+func init() {
+	RegisterConnector(FILE_SCHEME, newFileConnector)
+	RegisterConnector(SFTP_SCHEME, newSFTPConnector)
+	RegisterConnector(FTP_SCHEME, newFTPConnector)
+	RegisterConnector(FTPS_SCHEME, newFTPConnector)
+	RegisterConnector(HTTP_SCHEME, newHttpConnector)
+	RegisterConnector(HTTPS_SCHEME, newHttpConnector)
+	RegisterConnector(S3_SCHEME, newS3Connector)
+	RegisterConnector(WEBDAV_SCHEME, newWebDAVConnector)
+	RegisterConnector(WEBDAVS_SCHEME, newWebDAVConnector)
+	RegisterConnector(MULTI_SCHEME, newMirrorConnector)
+	RegisterConnector(ZIP_SCHEME, newArchiveConnector)
+	RegisterConnector(TAR_SCHEME, newArchiveConnector)
+	RegisterConnector(MEM_SCHEME, newMemoryConnector)
+}
+
+/**
+* Register the factory of the connectors of an uri scheme, a registered scheme (built-in ones included) is replaced
+* Example:
+* ```
+* connectors.RegisterConnector("acme", func(u *url.URL, options connectors.Options) (connectors.Connector, error) {
+*     return NewAcmeConnector(u.Host, u.Path, options.Get(u, "token"))
+* })
+* connector, err := connectors.NewConnector("acme://storage.internal/packs/my-pack")
+* ```
+ */
+func RegisterConnector(scheme string, factory Factory) {
+	if factory == nil {
+		panic("connectors: RegisterConnector factory is nil")
+	}
+	if !schemeRegex.MatchString(scheme) {
+		panic("connectors: invalid scheme " + strconv.Quote(scheme))
+	}
+
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	factories[strings.ToLower(scheme)] = factory
 }
 
+// RegisteredSchemes returns the sorted list of the registered schemes
+func RegisteredSchemes() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	for scheme := range CONNECTORS {
+		if _, ok := factories[scheme]; !ok {
+			schemes = append(schemes, scheme)
+		}
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// schemeRegex matches an uri scheme (RFC 3986)
+var schemeRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+
+// nestedURIRegex matches the uris embedded in an uri (e.g. multi://sftp://...)
+var nestedURIRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+/**
+* Create a connector from an uri, the factory is picked by the exact scheme of the uri
+* Uris embedding other uris (e.g. multi://sftp://...|https://...) are not parsed, the factory gets them in url.Opaque
+* Example:
+* ```
+* connector, err := connectors.NewConnector("sftp://deploy@host/packs/my-pack", connectors.Options{
+*     SFTP: connectors.SFTPOptions{KeyFiles: []string{"~/.ssh/deploy_key"}},
+* })
+* ```
+ */
+func NewConnector(uri string, options ...Options) (Connector, error) {
+	return newConnector(uri, true, options...)
+}
+
+// newConnector creates the connector with the registered factories, and the ones of CONNECTORS if legacy is set
+func newConnector(uri string, legacy bool, options ...Options) (Connector, error) {
+	scheme, rest, found := strings.Cut(uri, "://")
+	if !found || !schemeRegex.MatchString(scheme) {
+		return nil, fmt.Errorf("invalid uri %q: expected <scheme>://<path>", uri)
+	}
+
+	// The connectors set in CONNECTORS by the code written before the registry take precedence
+	var factory Factory
+	ok := false
+	if legacy {
+		factory, ok = legacyFactory(strings.ToLower(scheme))
+	}
+	if !ok {
+		factoriesMutex.RLock()
+		factory, ok = factories[strings.ToLower(scheme)]
+		factoriesMutex.RUnlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("no connector registered for scheme %q (available: %s)", scheme, strings.Join(RegisteredSchemes(), ", "))
+	}
+
+	var u *url.URL
+	if nestedURIRegex.MatchString(rest) {
+		u = &url.URL{Scheme: strings.ToLower(scheme), Opaque: rest}
+	} else {
+		var err error
+		u, err = url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uri: %w", err)
+		}
+	}
+
+	var opts Options
+	if len(options) > 0 {
+		opts = options[0]
+	}
+
+	connector, err := factory(u, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s connector: %w", scheme, err)
+	}
+	return connector, nil
+}
+
+// FindConnectorFromURI returns nil if the uri is invalid or its scheme isn't registered
+//
+// Deprecated: use NewConnector, which reports why the uri is invalid
 func FindConnectorFromURI(uri string) Connector {
-	for k, connector := range CONNECTORS {
-		if strings.HasPrefix(uri, k+"://") {
-			return connector.NewFromURI(uri)
+	connector, err := NewConnector(uri)
+	if err != nil {
+		return nil
+	}
+	return connector
+}
+
+/////////////////////////////////////////////////////////////////////
+// Deprecated
+/////////////////////////////////////////////////////////////////////
+
+// uriConnector is implemented by the connectors of CONNECTORS, NewFromURI creates a connector of the scheme
+type uriConnector interface {
+	NewFromURI(uri string) Connector
+}
+
+// CONNECTORS maps a scheme to a connector creating the connectors of the scheme with NewFromURI
+// NewConnector uses the entries replacing or added to the built-in ones before the registered factories,
+// the connectors without NewFromURI are ignored. Change the entries before any use (e.g. in init)
+//
+// Deprecated: use RegisterConnector and NewConnector
+var CONNECTORS = map[string]Connector{
+	SFTP_SCHEME:    new(SFTPConnector),
+	FTP_SCHEME:     new(FTPConnector),
+	FTPS_SCHEME:    new(FTPConnector),
+	FILE_SCHEME:    new(FileConnector),
+	HTTP_SCHEME:    new(HttpConnector),
+	HTTPS_SCHEME:   new(HttpConnector),
+	S3_SCHEME:      new(S3Connector),
+	WEBDAV_SCHEME:  new(WebDAVConnector),
+	WEBDAVS_SCHEME: new(WebDAVConnector),
+	MULTI_SCHEME:   new(MirrorConnector),
+}
+
+// builtinConnectors are the initial entries of CONNECTORS
+var builtinConnectors = maps.Clone(CONNECTORS)
+
+// legacyFactory returns a factory calling NewFromURI on the connector of the scheme in CONNECTORS
+// The built-in entries are skipped so the registered factories get the options
+func legacyFactory(scheme string) (Factory, bool) {
+	prototype, ok := CONNECTORS[scheme]
+	if !ok || prototype == nil || prototype == builtinConnectors[scheme] {
+		return nil, false
+	}
+	uriPrototype, ok := prototype.(uriConnector)
+	if !ok {
+		return nil, false
+	}
+	return func(u *url.URL, options Options) (Connector, error) {
+		uri := u.String()
+		if u.Opaque != "" {
+			uri = u.Scheme + "://" + u.Opaque
+		}
+		connector := uriPrototype.NewFromURI(uri)
+		if connector == nil {
+			return nil, fmt.Errorf("invalid uri")
 		}
+		return connector, nil
+	}, true
+}
+
+// newFromURI implements NewFromURI for the built-in connectors, nil if the uri is invalid
+// CONNECTORS is not used, a built-in connector set again in CONNECTORS would call itself
+func newFromURI(uri string) Connector {
+	connector, err := newConnector(uri, false)
+	if err != nil {
+		return nil
 	}
+	return connector
+}
 
-	return nil
+// Deprecated: use NewConnector
+func (c *SFTPConnector) NewFromURI(uri string) Connector { return newFromURI(uri) }
+
+// Deprecated: use NewConnector
+func (c *FTPConnector) NewFromURI(uri string) Connector { return newFromURI(uri) }
+
+// Deprecated: use NewConnector
+func (c *FileConnector) NewFromURI(uri string) Connector { return newFromURI(uri) }
+
+// Deprecated: use NewConnector
+func (c *HttpConnector) NewFromURI(uri string) Connector { return newFromURI(uri) }
+
+// Deprecated: use NewConnector
+func (c *S3Connector) NewFromURI(uri string) Connector { return newFromURI(uri) }
+
+// Deprecated: use NewConnector
+func (c *WebDAVConnector) NewFromURI(uri string) Connector { return newFromURI(uri) }
+
+// Deprecated: use NewConnector
+func (c *MirrorConnector) NewFromURI(uri string) Connector { return newFromURI(uri) }
+
+// Deprecated: use NewConnector and WithRetry
+func (c *RetryConnector) NewFromURI(uri string) Connector {
+	return WithRetry(newFromURI(uri), c.Policy)
 }
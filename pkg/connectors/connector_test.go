@@ -0,0 +1,64 @@
+package connectors
+
+import (
+	"slices"
+	"testing"
+)
+
+// legacyConnector is a connector of a downstream project added to CONNECTORS before the registry
+type legacyConnector struct {
+	*MemoryConnector
+	uri string
+}
+
+func (c *legacyConnector) NewFromURI(uri string) Connector {
+	return &legacyConnector{MemoryConnector: NewMemoryConnector(NewMemFS(), ""), uri: uri}
+}
+
+func TestDeprecatedConnectors(t *testing.T) {
+	CONNECTORS["legacy"] = new(legacyConnector)
+	t.Cleanup(func() { delete(CONNECTORS, "legacy") })
+
+	connector, err := NewConnector("legacy://host/packs/my-pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy, ok := connector.(*legacyConnector); !ok || legacy.uri != "legacy://host/packs/my-pack" {
+		t.Errorf("connector = %#v, want the one of CONNECTORS", connector)
+	}
+	if !slices.Contains(RegisteredSchemes(), "legacy") {
+		t.Errorf("schemes = %v, want the ones of CONNECTORS", RegisteredSchemes())
+	}
+
+	// The built-in connectors still create the connectors of their scheme
+	if _, ok := CONNECTORS[HTTPS_SCHEME].(*HttpConnector).NewFromURI("https://cdn.example.com/packs").(*HttpConnector); !ok {
+		t.Error("NewFromURI didn't create a http connector")
+	}
+	if CONNECTORS[SFTP_SCHEME].(*SFTPConnector).NewFromURI("sftp://") != nil || FindConnectorFromURI("unknown://host") != nil {
+		t.Error("connector created from an invalid uri")
+	}
+}
+
+func TestDeprecatedConnectorsReplaceBuiltins(t *testing.T) {
+	builtin := CONNECTORS[HTTPS_SCHEME]
+	t.Cleanup(func() { CONNECTORS[HTTPS_SCHEME] = builtin })
+
+	// An entry replacing a built-in scheme takes precedence over its factory
+	CONNECTORS[HTTPS_SCHEME] = new(legacyConnector)
+	if _, ok := FindConnectorFromURI("https://cdn.example.com/packs").(*legacyConnector); !ok {
+		t.Error("https connector not created by the entry of CONNECTORS")
+	}
+
+	// A new built-in connector doesn't call itself
+	CONNECTORS[HTTPS_SCHEME] = new(HttpConnector)
+	if _, ok := FindConnectorFromURI("https://cdn.example.com/packs").(*HttpConnector); !ok {
+		t.Error("https connector not created")
+	}
+
+	// A connector without NewFromURI can't create the connectors of its scheme
+	CONNECTORS["plain"] = NewMemoryConnector(NewMemFS(), "")
+	t.Cleanup(func() { delete(CONNECTORS, "plain") })
+	if _, err := NewConnector("plain://host"); err == nil {
+		t.Error("connector created by a connector without NewFromURI")
+	}
+}
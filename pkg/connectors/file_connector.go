@@ -19,16 +19,11 @@ type FileConnector struct {
 	Path string
 }
 
-func (c *FileConnector) NewFromURI(uri string) Connector {
+func newFileConnector(parsed *url.URL, options Options) (Connector, error) {
 	// Example: file:///path/to/file
-	parsed, err := url.Parse(uri)
-	if err != nil {
-		return nil
-	}
-
 	pwd, err := os.Getwd()
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("failed to get pwd: %w", err)
 	}
 
 	// if the path start with ./ use PWD
@@ -39,7 +34,7 @@ func (c *FileConnector) NewFromURI(uri string) Connector {
 
 	return &FileConnector{
 		Path: finalPath,
-	}
+	}, nil
 }
 
 func (c *FileConnector) GetPath() string {
@@ -118,6 +113,98 @@ func (c *FileConnector) SendFileFromBytes(remotePath string, bytes []byte, perm
 	return os.WriteFile(filepath.Join(c.Path, remotePath), bytes, fs.FileMode(mode))
 }
 
+func (c *FileConnector) Open(remotePath string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(filepath.Join(c.Path, remotePath))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, st.Size(), nil
+}
+
+func (c *FileConnector) Create(remotePath string, perm fs.FileMode) (io.WriteCloser, error) {
+	fullPath := filepath.Join(c.Path, remotePath)
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write in a temp file, renamed on close
+	tmp := fullPath + ".part"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	return &fileWriter{File: f, tmpPath: tmp, path: fullPath}, nil
+}
+
+// fileWriter writes in a .part file and renames it on close
+type fileWriter struct {
+	*os.File
+	tmpPath string
+	path    string
+}
+
+func (w *fileWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.tmpPath)
+		return err
+	}
+	return os.Rename(w.tmpPath, w.path)
+}
+
+func (w *fileWriter) Cancel() error {
+	w.File.Close()
+	return os.Remove(w.tmpPath)
+}
+
+/**
+* List all files and directories in the given path
+* Example:
+* ```
+* files, err := connector.List("path/subpath")
+* ```
+ */
+func (c *FileConnector) List(remotePath string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(c.Path, remotePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	files := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// The file was removed in the meantime
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+func (c *FileConnector) Delete(remotePath string) error {
+	return os.Remove(filepath.Join(c.Path, remotePath))
+}
+
+func (c *FileConnector) Rename(oldPath string, newPath string) error {
+	newPath = filepath.Join(c.Path, newPath)
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return os.Rename(filepath.Join(c.Path, oldPath), newPath)
+}
+
+func (c *FileConnector) Walk(remotePath string, fn WalkFunc) error {
+	return walk(c, remotePath, fn)
+}
+
 func (c *FileConnector) GetScheme() string {
 	return FILE_SCHEME
 }
@@ -137,18 +224,5 @@ func (c *FileConnector) HasFile(remotePath string) bool {
 }
 
 func (c *FileConnector) HasFileWithChecksum(remotePath string, checksumType ChecksumType, checksum string) bool {
-	bytes, err := c.ReadFileBytes(remotePath, -1)
-	if err != nil {
-		return false
-	}
-
-	switch checksumType {
-	case ChecksumTypeSHA1:
-		sha1 := utils.BytesSHA1(bytes)
-		return sha1 == checksum
-	case ChecksumTypeSHA256:
-		sha256 := utils.BytesSHA256(bytes)
-		return sha256 == checksum
-	}
-	return true
+	return hasFileWithChecksum(c, remotePath, checksumType, checksum)
 }
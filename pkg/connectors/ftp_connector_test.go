@@ -0,0 +1,411 @@
+package connectors
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFTPServer is a minimal FTP server serving root, with explicit TLS when tlsConfig is set
+type testFTPServer struct {
+	root      string
+	tlsConfig *tls.Config
+	listener  net.Listener
+
+	mu          sync.Mutex
+	sessions    int // Control connections accepted
+	open        int // Control connections currently open
+	maxOpen     int
+	tlsSessions int // Control connections upgraded with AUTH TLS
+}
+
+func newTestFTPServer(t *testing.T, tlsConfig *tls.Config) *testFTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testFTPServer{root: t.TempDir(), tlsConfig: tlsConfig, listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testFTPServer) uri(scheme string, query string) string {
+	return scheme + "://user:secret@" + s.listener.Addr().String() + "/pack" + query
+}
+
+func (s *testFTPServer) stats() (sessions int, open int, maxOpen int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions, s.open, s.maxOpen
+}
+
+func (s *testFTPServer) localPath(remotePath string) string {
+	return filepath.Join(s.root, filepath.FromSlash(remotePath))
+}
+
+func (s *testFTPServer) serve(conn net.Conn) {
+	s.mu.Lock()
+	s.sessions++
+	s.open++
+	s.maxOpen = max(s.maxOpen, s.open)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.open--
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	ctrl := textproto.NewConn(conn)
+	ctrl.PrintfLine("220 ready")
+
+	var passive net.Listener
+	protected := false
+	renameFrom := ""
+
+	// dataConn accepts the data connection opened after EPSV
+	dataConn := func() (net.Conn, error) {
+		if passive == nil {
+			return nil, fmt.Errorf("no data connection")
+		}
+		defer func() { passive.Close(); passive = nil }()
+		data, err := passive.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if protected {
+			return tls.Server(data, s.tlsConfig), nil
+		}
+		return data, nil
+	}
+
+	for {
+		line, err := ctrl.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "AUTH":
+			if s.tlsConfig == nil {
+				ctrl.PrintfLine("502 no TLS")
+				continue
+			}
+			ctrl.PrintfLine("234 AUTH TLS ok")
+			conn = tls.Server(conn, s.tlsConfig)
+			ctrl = textproto.NewConn(conn)
+			s.mu.Lock()
+			s.tlsSessions++
+			s.mu.Unlock()
+		case "USER":
+			ctrl.PrintfLine("331 password required")
+		case "PASS":
+			if arg != "secret" {
+				ctrl.PrintfLine("530 login incorrect")
+				continue
+			}
+			ctrl.PrintfLine("230 logged in")
+		case "FEAT":
+			ctrl.PrintfLine("211-Features:\r\n MLST type*;size*;modify*;\r\n211 End")
+		case "TYPE", "PBSZ":
+			ctrl.PrintfLine("200 ok")
+		case "PROT":
+			protected = arg == "P"
+			ctrl.PrintfLine("200 ok")
+		case "EPSV":
+			if passive, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				ctrl.PrintfLine("425 %v", err)
+				continue
+			}
+			ctrl.PrintfLine("229 Entering Extended Passive Mode (|||%d|)", passive.Addr().(*net.TCPAddr).Port)
+		case "SIZE":
+			info, err := os.Stat(s.localPath(arg))
+			if err != nil || info.IsDir() {
+				ctrl.PrintfLine("550 not a file")
+				continue
+			}
+			ctrl.PrintfLine("213 %d", info.Size())
+		case "RETR":
+			data, err := dataConn()
+			if err != nil {
+				ctrl.PrintfLine("425 %v", err)
+				continue
+			}
+			f, err := os.Open(s.localPath(arg))
+			if err != nil {
+				data.Close()
+				ctrl.PrintfLine("550 %v", err)
+				continue
+			}
+			ctrl.PrintfLine("150 sending")
+			io.Copy(data, f)
+			f.Close()
+			data.Close()
+			ctrl.PrintfLine("226 done")
+		case "STOR":
+			data, err := dataConn()
+			if err != nil {
+				ctrl.PrintfLine("425 %v", err)
+				continue
+			}
+			f, err := os.Create(s.localPath(arg))
+			if err != nil {
+				data.Close()
+				ctrl.PrintfLine("553 %v", err)
+				continue
+			}
+			ctrl.PrintfLine("150 receiving")
+			io.Copy(f, data)
+			f.Close()
+			data.Close()
+			ctrl.PrintfLine("226 done")
+		case "MLSD":
+			data, err := dataConn()
+			if err != nil {
+				ctrl.PrintfLine("425 %v", err)
+				continue
+			}
+			entries, err := os.ReadDir(s.localPath(arg))
+			if err != nil {
+				data.Close()
+				ctrl.PrintfLine("550 %v", err)
+				continue
+			}
+			ctrl.PrintfLine("150 listing")
+			for _, entry := range entries {
+				info, _ := entry.Info()
+				entryType := "file"
+				if entry.IsDir() {
+					entryType = "dir"
+				}
+				fmt.Fprintf(data, "type=%s;size=%d;modify=%s; %s\r\n", entryType, info.Size(), info.ModTime().UTC().Format("20060102150405"), entry.Name())
+			}
+			data.Close()
+			ctrl.PrintfLine("226 done")
+		case "MKD":
+			if err := os.Mkdir(s.localPath(arg), 0755); err != nil {
+				ctrl.PrintfLine("550 %v", err)
+				continue
+			}
+			ctrl.PrintfLine(`257 "%s" created`, arg)
+		case "DELE":
+			if info, err := os.Stat(s.localPath(arg)); err != nil || info.IsDir() {
+				ctrl.PrintfLine("550 not a file")
+				continue
+			}
+			os.Remove(s.localPath(arg))
+			ctrl.PrintfLine("250 deleted")
+		case "RMD":
+			if err := os.Remove(s.localPath(arg)); err != nil {
+				ctrl.PrintfLine("550 %v", err)
+				continue
+			}
+			ctrl.PrintfLine("250 removed")
+		case "RNFR":
+			if _, err := os.Stat(s.localPath(arg)); err != nil {
+				ctrl.PrintfLine("550 %v", err)
+				continue
+			}
+			renameFrom = arg
+			ctrl.PrintfLine("350 ready")
+		case "RNTO":
+			if err := os.Rename(s.localPath(renameFrom), s.localPath(arg)); err != nil {
+				ctrl.PrintfLine("550 %v", err)
+				continue
+			}
+			ctrl.PrintfLine("250 renamed")
+		case "QUIT":
+			ctrl.PrintfLine("221 bye")
+			return
+		default:
+			ctrl.PrintfLine("502 %s not implemented", command)
+		}
+	}
+}
+
+func connectFTP(t *testing.T, uri string) Connector {
+	t.Helper()
+	connector, err := NewConnector(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connector.Close() })
+	return connector
+}
+
+// withTimeout fails the test if fn doesn't return, instead of blocking the whole test binary
+func withTimeout(t *testing.T, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("deadlock")
+	}
+}
+
+func TestFTPConnectorPoolExhaustion(t *testing.T) {
+	server := newTestFTPServer(t, nil)
+	connector := connectFTP(t, server.uri("ftp", "?pool=2"))
+
+	// More operations than connections wait for a connection of the pool
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("mods/%d.jar", i)
+			if err := connector.SendFileFromBytes(name, []byte(name)); err != nil {
+				errs <- err
+				return
+			}
+			if data, err := connector.ReadFileBytes(name, -1); err != nil || string(data) != name {
+				errs <- fmt.Errorf("%s = %q, %v", name, data, err)
+			}
+		}()
+	}
+	withTimeout(t, wg.Wait)
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if sessions, _, maxOpen := server.stats(); sessions != 2 || maxOpen != 2 {
+		t.Errorf("%d connections, %d at the same time, want the 2 of the pool", sessions, maxOpen)
+	}
+	if files := listNames(t, connector, "mods"); len(files) != 16 {
+		t.Errorf("mods = %v, want the 16 files without their .part", files)
+	}
+}
+
+func TestFTPConnectorOpenAndCreate(t *testing.T) {
+	server := newTestFTPServer(t, nil)
+	connector := connectFTP(t, server.uri("ftp", "?pool=1"))
+	connector.SendFileFromBytes("mods/a.jar", []byte("a"))
+
+	// A file copied with a pool of one connection, like the archive of a revision
+	withTimeout(t, func() {
+		rc, _, err := connector.Open("mods/a.jar")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer rc.Close()
+		w, err := connector.Create(".archive/mods/a.jar", 0644)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		io.Copy(w, rc)
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	if data, err := connector.ReadFileBytes(".archive/mods/a.jar", -1); err != nil || string(data) != "a" {
+		t.Errorf("copy = %q, %v", data, err)
+	}
+
+	// The connection dialed for the writer is closed with it
+	withTimeout(t, func() {
+		for _, open, _ := server.stats(); open != 1; _, open, _ = server.stats() {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	// A canceled writer leaves no .part file
+	w, _ := connector.Create("mods/b.jar", 0644)
+	io.WriteString(w, "partial")
+	CancelWriter(w)
+	if files := listNames(t, connector, "mods"); !slices.Equal(files, []string{"a.jar"}) {
+		t.Errorf("mods = %v, want only a.jar", files)
+	}
+}
+
+func TestFTPConnectorTLS(t *testing.T) {
+	server := newTestFTPServer(t, &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}})
+	connector := connectFTP(t, server.uri("ftps", "?insecure=true&pool=1"))
+
+	if err := connector.SendFileFromBytes("mods/a.jar", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	rc, size, err := connector.Open("mods/a.jar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "a" || size != 1 {
+		t.Errorf("a.jar = %q of %d bytes", data, size)
+	}
+	if files := listNames(t, connector, "mods"); !slices.Equal(files, []string{"a.jar"}) {
+		t.Errorf("mods = %v", files)
+	}
+	server.mu.Lock()
+	tlsSessions := server.tlsSessions
+	server.mu.Unlock()
+	if sessions, _, _ := server.stats(); tlsSessions != sessions {
+		t.Errorf("%d of the %d connections upgraded to TLS", tlsSessions, sessions)
+	}
+
+	// The self-signed certificate is refused without insecure
+	strict, _ := NewConnector(server.uri("ftps", "?pool=1"))
+	if err := strict.Connect(); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("err = %v, want a certificate error", err)
+	}
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,179 @@
+package connectors
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+// HTTP_TOKEN_ENV is the environment variable of the bearer token of the http connector
+const HTTP_TOKEN_ENV = "LAUNCHYGO_HTTP_TOKEN"
+
+// TokenSource returns the current bearer token, it is called before each request so the token can be refreshed
+type TokenSource func() (string, error)
+
+// URLSigner returns the url to request instead of u (e.g. with an expiring signature), u must not be modified
+type URLSigner interface {
+	SignURL(u *url.URL) (*url.URL, error)
+}
+
+// URLSignerFunc adapts a function to the URLSigner interface
+type URLSignerFunc func(u *url.URL) (*url.URL, error)
+
+func (f URLSignerFunc) SignURL(u *url.URL) (*url.URL, error) {
+	return f(u)
+}
+
+/**
+* Credentials of the http connector, the basic credentials are the user info of the url
+* The token is sent as "Authorization: Bearer <token>" and takes precedence over the basic credentials
+* Example:
+* ```
+* connector, err := connectors.NewConnector("https://packs.example.com/my-pack", connectors.Options{
+*     HTTP: connectors.HTTPOptions{TokenSource: gameProfile.AccessToken},
+* })
+* ```
+ */
+type HTTPOptions struct {
+	Token       string      // Static bearer token, default to the token option then LAUNCHYGO_HTTP_TOKEN
+	TokenSource TokenSource // Dynamic bearer token (e.g. the token of the player), takes precedence over Token
+	Signer      URLSigner   // Signs the url of each request (expiring signed urls)
+
+	// ETagChecksum is the checksum the strong ETags of the server are made of (e.g. ChecksumTypeSHA1), 0 if they are
+	// not a checksum of the content. Most servers build them from the size and the modification date
+	ETagChecksum ChecksumType
+}
+
+/////////////////////////////////////////////////////////////////////
+// HMAC signed urls
+/////////////////////////////////////////////////////////////////////
+
+/**
+* Sign the urls with an HMAC-SHA256 of the path and an expiration date, added as the expires and signature query parameters
+* The server checks them with VerifyHMACURL (or the same computation), the secret is shared with the server
+* Example:
+* ```
+* signer := connectors.NewHMACURLSigner([]byte(os.Getenv("PACK_SECRET")), 10*time.Minute)
+* ```
+ */
+func NewHMACURLSigner(secret []byte, ttl time.Duration) URLSigner {
+	return URLSignerFunc(func(u *url.URL) (*url.URL, error) {
+		signed := *u
+		query := signed.Query()
+		expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+		query.Set("expires", expires)
+		query.Set("signature", hmacURLSignature(secret, u.EscapedPath(), expires))
+		signed.RawQuery = query.Encode()
+		return &signed, nil
+	})
+}
+
+// VerifyHMACURL checks the signature of an url signed by NewHMACURLSigner, for the servers written in Go
+func VerifyHMACURL(secret []byte, u *url.URL) error {
+	query := u.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid expiration")
+	}
+	if time.Now().Unix() > expires {
+		return errors.New("the url has expired")
+	}
+
+	expected := hmacURLSignature(secret, u.EscapedPath(), query.Get("expires"))
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func hmacURLSignature(secret []byte, path string, expires string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(path + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+/////////////////////////////////////////////////////////////////////
+// Remote signer
+/////////////////////////////////////////////////////////////////////
+
+// remoteSignerMargin is the time before the expiration at which a signed url is renewed
+const remoteSignerMargin = 30 * time.Second
+
+type remoteSignedURL struct {
+	url     *url.URL
+	expires time.Time
+}
+
+// RemoteURLSigner asks a signing endpoint for the signed urls, the request is authenticated with the token
+type RemoteURLSigner struct {
+	Endpoint    string
+	TokenSource TokenSource // e.g. the token of the player, so the endpoint can check the player is allowed
+
+	mu    sync.Mutex
+	cache map[string]remoteSignedURL // The signed urls are reused until they expire
+}
+
+/**
+* Create a signer requesting GET <endpoint>?url=<url> with "Authorization: Bearer <token>"
+* The endpoint answers {"url": "<signed url>", "expires": <unix timestamp>} (expires is optional)
+* Example:
+* ```
+* signer := connectors.NewRemoteURLSigner("https://api.example.com/packs/sign", gameProfile.AccessToken)
+* ```
+ */
+func NewRemoteURLSigner(endpoint string, tokenSource TokenSource) *RemoteURLSigner {
+	return &RemoteURLSigner{Endpoint: endpoint, TokenSource: tokenSource, cache: map[string]remoteSignedURL{}}
+}
+
+func (s *RemoteURLSigner) SignURL(u *url.URL) (*url.URL, error) {
+	key := u.String()
+	s.mu.Lock()
+	cached, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && time.Now().Add(remoteSignerMargin).Before(cached.expires) {
+		return cached.url, nil
+	}
+
+	options := utils.NewRequestOptions[[]byte]("application/json", nil)
+	options.QueryParams = map[string]string{"url": key}
+	if s.TokenSource != nil {
+		token, err := s.TokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the token of the signer: %w", err)
+		}
+		options.AddHeader("Authorization", "Bearer "+token)
+	}
+
+	body, err := utils.DoRequest(http.MethodGet, s.Endpoint, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign %s: %w", u.Path, err)
+	}
+	var response struct {
+		URL     string `json:"url"`
+		Expires int64  `json:"expires"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.URL == "" {
+		return nil, fmt.Errorf("invalid response of the signer for %s", u.Path)
+	}
+	signed, err := u.Parse(response.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signed url for %s: %w", u.Path, err)
+	}
+
+	if response.Expires > 0 {
+		s.mu.Lock()
+		s.cache[key] = remoteSignedURL{url: signed, expires: time.Unix(response.Expires, 0)}
+		s.mu.Unlock()
+	}
+	return signed, nil
+}
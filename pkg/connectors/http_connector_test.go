@@ -0,0 +1,345 @@
+package connectors
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+func TestHttpConnectorNetworkOptions(t *testing.T) {
+	var mu sync.Mutex
+	proxied := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		io.WriteString(w, `{"version":"1.0"}`)
+	}))
+	defer proxy.Close()
+
+	connector, err := NewConnector("http://packs.example/my-pack?proxy=" + proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The network options are not sent to the server
+	if uri := connector.GetURI(); uri != "http://packs.example/my-pack" {
+		t.Errorf("uri = %s", uri)
+	}
+
+	var manifest struct{ Version string }
+	if err := connector.ReadFile("manifest.json", &manifest); err != nil {
+		t.Fatal(err)
+	}
+	rc, _, err := connector.Open("mods/foo.jar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+
+	want := []string{"http://packs.example/my-pack/manifest.json", "http://packs.example/my-pack/mods/foo.jar"}
+	if len(proxied) != 2 || proxied[0] != want[0] || proxied[1] != want[1] {
+		t.Errorf("proxied = %v, want %v", proxied, want)
+	}
+
+	// The Go options take precedence over the query parameters
+	connector, err = NewConnector("http://packs.example/my-pack?proxy=http://unreachable.invalid", Options{
+		Network: utils.NetworkOptions{Proxy: proxy.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connector.ReadFileBytes("manifest.json", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewConnector("https://packs.example/my-pack?cacert=/missing/ca.pem"); err == nil {
+		t.Error("expected an error for a missing CA bundle")
+	}
+}
+
+// newAuthServer serves the files to the requests with the expected Authorization header
+func newAuthServer(t *testing.T, authorization string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "content of "+r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHttpConnectorBasicAuth(t *testing.T) {
+	server := newAuthServer(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("steve:secret")))
+	u, _ := url.Parse(server.URL)
+
+	connector, err := NewConnector("http://steve:secret@" + u.Host + "/packs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := connector.ReadFileBytes("manifest.json", -1); err != nil || string(data) != "content of /packs/manifest.json" {
+		t.Errorf("ReadFileBytes = %q, %v", data, err)
+	}
+	if uri := connector.GetURI(); strings.Contains(uri, "secret") {
+		t.Errorf("the password is displayed: %s", uri)
+	}
+
+	connector, _ = NewConnector("http://steve:wrong@" + u.Host + "/packs")
+	if connector.HasFile("manifest.json") {
+		t.Error("request accepted with a wrong password")
+	}
+}
+
+func TestHttpConnectorBearerToken(t *testing.T) {
+	server := newAuthServer(t, "Bearer player-token")
+
+	t.Setenv(HTTP_TOKEN_ENV, "player-token")
+	connector, err := NewConnector(server.URL + "/packs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !connector.HasFile("manifest.json") {
+		t.Error("the token of the environment is not sent")
+	}
+
+	// The options take precedence over the environment, the token source over the static token
+	connector, _ = NewConnector(server.URL+"/packs", Options{Values: map[string]string{"token": "other"}})
+	if connector.HasFile("manifest.json") {
+		t.Error("the token option is not used")
+	}
+
+	calls := 0
+	connector, _ = NewConnector(server.URL+"/packs", Options{HTTP: HTTPOptions{
+		Token:       "other",
+		TokenSource: func() (string, error) { calls++; return "player-token", nil },
+	}})
+	rc, _, err := connector.Open("mods/foo.jar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if calls != 1 {
+		t.Errorf("token source called %d times, want 1", calls)
+	}
+
+	connector.(*HttpConnector).SetTokenSource(func() (string, error) { return "", errors.New("not authenticated") })
+	if _, err := connector.ReadFileBytes("manifest.json", -1); err == nil || !strings.Contains(err.Error(), "not authenticated") {
+		t.Errorf("err = %v, want the error of the token source", err)
+	}
+}
+
+func TestHMACURLSigner(t *testing.T) {
+	secret := []byte("pack-secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := VerifyHMACURL(secret, r.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, "signed")
+	}))
+	defer server.Close()
+
+	connector, err := NewConnector(server.URL+"/packs", Options{HTTP: HTTPOptions{Signer: NewHMACURLSigner(secret, time.Minute)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := connector.ReadFileBytes("mods/foo.jar", -1); err != nil || string(data) != "signed" {
+		t.Errorf("ReadFileBytes = %q, %v", data, err)
+	}
+
+	// Wrong secret, expired url, no signature
+	for _, signer := range []URLSigner{NewHMACURLSigner([]byte("wrong"), time.Minute), NewHMACURLSigner(secret, -time.Minute), nil} {
+		connector.(*HttpConnector).SetURLSigner(signer)
+		if connector.HasFile("mods/foo.jar") {
+			t.Errorf("url accepted with signer %v", signer)
+		}
+	}
+}
+
+func TestRemoteURLSigner(t *testing.T) {
+	var mu sync.Mutex
+	signed := 0
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sig") != "ok" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, "content")
+	}))
+	defer files.Close()
+	signer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer player-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		signed++
+		mu.Unlock()
+		fmt.Fprintf(w, `{"url": %q, "expires": %d}`, r.URL.Query().Get("url")+"?sig=ok", time.Now().Add(time.Hour).Unix())
+	}))
+	defer signer.Close()
+
+	token := "player-token"
+	connector, err := NewConnector(files.URL+"/packs", Options{HTTP: HTTPOptions{
+		Signer: NewRemoteURLSigner(signer.URL, func() (string, error) { return token, nil }),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if data, err := connector.ReadFileBytes("mods/foo.jar", -1); err != nil || string(data) != "content" {
+			t.Fatalf("ReadFileBytes = %q, %v", data, err)
+		}
+	}
+	// The signed url is reused until it expires
+	if signed != 1 {
+		t.Errorf("%d signing requests, want 1", signed)
+	}
+
+	// The players without a valid token can't download the pack
+	token = "stolen"
+	if _, err := connector.ReadFileBytes("mods/bar.jar", -1); err == nil {
+		t.Error("expected an error with a token refused by the signer")
+	}
+}
+
+func TestHttpConnectorChecksumETag(t *testing.T) {
+	// The ETag looks like a sha1 but is built from the modification date
+	etag := utils.BytesSHA1([]byte("1700000000-3"))
+	gets := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sha1") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"`+etag+`"`)
+		if r.Method == http.MethodGet {
+			gets++
+		}
+		io.WriteString(w, "foo")
+	}))
+	defer server.Close()
+
+	connector, _ := NewConnector(server.URL)
+	if !connector.HasFileWithChecksum("mods/foo.jar", ChecksumTypeSHA1, utils.BytesSHA1([]byte("foo"))) || gets != 1 {
+		t.Errorf("checksum compared to the ETag (%d downloads), want the checksum of the content", gets)
+	}
+
+	// The server is configured to send the sha1 of the content as ETag
+	gets = 0
+	connector, _ = NewConnector(server.URL, Options{HTTP: HTTPOptions{ETagChecksum: ChecksumTypeSHA1}})
+	if !connector.HasFileWithChecksum("mods/foo.jar", ChecksumTypeSHA1, etag) || gets != 0 {
+		t.Errorf("ETag not used as checksum (%d downloads)", gets)
+	}
+}
+
+func TestHttpConnectorChecksumHeaders(t *testing.T) {
+	content := []byte("foo")
+	sha1Sum := utils.BytesSHA1(content)
+	sha256Sum := utils.BytesSHA256(content)
+	otherSum := utils.BytesSHA1([]byte("bar"))
+	base64Sum := func(hexSum string) string {
+		decoded, _ := hex.DecodeString(hexSum)
+		return base64.StdEncoding.EncodeToString(decoded)
+	}
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		files        map[string]string // sidecar files
+		checksumType ChecksumType
+		checksum     string
+		want         bool
+	}{
+		{"Digest", map[string]string{"Digest": "MD5=rL0Y20zC+Fzt72VPzMSk2A==, SHA=" + base64Sum(sha1Sum)}, nil, ChecksumTypeSHA1, sha1Sum, true},
+		{"Digest mismatch", map[string]string{"Digest": "SHA=" + base64Sum(otherSum)}, nil, ChecksumTypeSHA1, sha1Sum, false},
+		{"Content-Digest", map[string]string{"Content-Digest": "sha-256=:" + base64Sum(sha256Sum) + ":"}, nil, ChecksumTypeSHA256, sha256Sum, true},
+		{"x-amz-checksum", map[string]string{"x-amz-checksum-sha256": base64Sum(sha256Sum)}, nil, ChecksumTypeSHA256, sha256Sum, true},
+		{"x-amz-checksum mismatch", map[string]string{"x-amz-checksum-sha1": base64Sum(otherSum)}, nil, ChecksumTypeSHA1, sha1Sum, false},
+		{"x-amz-meta", map[string]string{"x-amz-meta-sha1": strings.ToUpper(sha1Sum)}, nil, ChecksumTypeSHA1, sha1Sum, true},
+		{"sha1 sidecar", nil, map[string]string{"foo.jar.sha1": sha1Sum + "  foo.jar\n"}, ChecksumTypeSHA1, sha1Sum, true},
+		{"sha1 sidecar mismatch", nil, map[string]string{"foo.jar.sha1": otherSum}, ChecksumTypeSHA1, sha1Sum, false},
+		{"sha256 sidecar", nil, map[string]string{"foo.jar.sha256": sha256Sum}, ChecksumTypeSHA256, sha256Sum, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gets := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, ".sha1") || strings.HasSuffix(r.URL.Path, ".sha256") {
+					name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+					if sidecar, ok := tt.files[name]; ok {
+						io.WriteString(w, sidecar)
+					} else {
+						http.NotFound(w, r)
+					}
+					return
+				}
+				for name, value := range tt.headers {
+					w.Header().Set(name, value)
+				}
+				if r.Method == http.MethodGet {
+					gets++
+				}
+				w.Write(content)
+			}))
+			defer server.Close()
+
+			connector, _ := NewConnector(server.URL)
+			if got := connector.HasFileWithChecksum("mods/foo.jar", tt.checksumType, tt.checksum); got != tt.want {
+				t.Errorf("HasFileWithChecksum = %v, want %v", got, tt.want)
+			}
+			if gets != 0 {
+				t.Errorf("file downloaded %d times, want the announced checksum", gets)
+			}
+		})
+	}
+}
+
+func TestHttpConnectorOpenRange(t *testing.T) {
+	content := "0123456789"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+	connector, _ := NewConnector(server.URL)
+	rangeConnector := connector.(RangeConnector)
+
+	open := func(offset int64, ifRange string) (string, string, bool) {
+		t.Helper()
+		rc, _, validator, resumed, err := rangeConnector.OpenRange("minecraft.jar", offset, ifRange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+		return string(data), validator, resumed
+	}
+
+	// The validator of the first download is sent back to resume it
+	if data, validator, _ := open(0, ""); data != content || validator != `"v2"` {
+		t.Errorf("OpenRange = %q with the validator %s, want the content and \"v2\"", data, validator)
+	}
+	if data, _, resumed := open(4, `"v2"`); !resumed || data != content[4:] {
+		t.Errorf("resumed %v with %q, want the content from the offset", resumed, data)
+	}
+	// The file changed since the part was downloaded
+	if data, _, resumed := open(4, `"v1"`); resumed || data != content {
+		t.Errorf("resumed %v with %q, want the whole content", resumed, data)
+	}
+}
@@ -0,0 +1,356 @@
+package connectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const MEM_SCHEME = "mem"
+
+/**
+* MemFS is a concurrency-safe in-memory filesystem, the directories are implied by the paths of the files
+* The filesystems are named, the connectors created with the same name share the same files
+* Example:
+* ```
+* connector, err := connectors.NewConnector("mem://test/packs/my-pack")
+* connectors.GetMemFS("test").WriteFile("packs/my-pack/manifest.json", data, 0644)
+* ```
+ */
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte // Never modified in place, a write replaces the slice so the opened readers are not affected
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+var (
+	memFSMutex sync.Mutex
+	memFS      = map[string]*MemFS{}
+)
+
+func NewMemFS() *MemFS {
+	return &MemFS{files: map[string]*memFile{}}
+}
+
+// GetMemFS returns the filesystem of the name, it is created if it doesn't exist
+func GetMemFS(name string) *MemFS {
+	memFSMutex.Lock()
+	defer memFSMutex.Unlock()
+
+	fsys, ok := memFS[name]
+	if !ok {
+		fsys = NewMemFS()
+		memFS[name] = fsys
+	}
+	return fsys
+}
+
+// RemoveMemFS forgets the filesystem of the name, the next GetMemFS returns an empty one
+func RemoveMemFS(name string) {
+	memFSMutex.Lock()
+	defer memFSMutex.Unlock()
+	delete(memFS, name)
+}
+
+func memPath(p string) string {
+	p = path.Clean(strings.Trim(strings.ReplaceAll(p, "\\", "/"), "/"))
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// WriteFile creates or replaces the file
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[memPath(name)] = &memFile{data: bytes.Clone(data), mode: perm, modTime: time.Now()}
+}
+
+// ReadFile returns a copy of the content of the file
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	file, err := m.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(file.data), nil
+}
+
+// Remove deletes the file
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = memPath(name)
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+// Paths returns the paths of all the files, sorted
+func (m *MemFS) Paths() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	paths := make([]string, 0, len(m.files))
+	for p := range m.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (m *MemFS) stat(name string) (*memFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	file, ok := m.files[memPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return file, nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// Connector
+/////////////////////////////////////////////////////////////////////
+
+// MemoryConnector serves the files of a MemFS under a prefix, mostly used by the tests
+type MemoryConnector struct {
+	Name string // Name of the filesystem, empty if it was not created from an uri
+	Path string // Prefix of the files in the filesystem
+	FS   *MemFS
+}
+
+func NewMemoryConnector(fsys *MemFS, prefix string) *MemoryConnector {
+	return &MemoryConnector{Path: memPath(prefix), FS: fsys}
+}
+
+func newMemoryConnector(u *url.URL, options Options) (Connector, error) {
+	// Example: mem://test/packs/my-pack
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing filesystem name")
+	}
+
+	connector := NewMemoryConnector(GetMemFS(u.Host), u.Path)
+	connector.Name = u.Host
+	return connector, nil
+}
+
+func (c *MemoryConnector) fullPath(remotePath string) string {
+	return memPath(path.Join(c.Path, memPath(remotePath)))
+}
+
+func (c *MemoryConnector) GetPath() string {
+	return c.Path
+}
+
+func (c *MemoryConnector) GetURI() string {
+	return MEM_SCHEME + "://" + c.Name + "/" + c.Path
+}
+
+func (c *MemoryConnector) Connect() error {
+	return nil
+}
+
+func (c *MemoryConnector) Login() error {
+	return nil
+}
+
+func (c *MemoryConnector) ReadFile(remotePath string, dest any) error {
+	bytes, err := c.ReadFileBytes(remotePath, -1)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	return json.Unmarshal(bytes, dest)
+}
+
+func (c *MemoryConnector) ReadFileBytes(remotePath string, size int64) ([]byte, error) {
+	return c.FS.ReadFile(c.fullPath(remotePath))
+}
+
+func (c *MemoryConnector) SendFile(remotePath string, localPath string) error {
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	st, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	c.FS.WriteFile(c.fullPath(remotePath), data, st.Mode().Perm())
+	return nil
+}
+
+func (c *MemoryConnector) SendFileFromBytes(remotePath string, bytes []byte, perm ...fs.FileMode) error {
+	mode := fs.FileMode(0644)
+	if len(perm) > 0 {
+		mode = perm[0]
+	}
+	c.FS.WriteFile(c.fullPath(remotePath), bytes, mode)
+	return nil
+}
+
+func (c *MemoryConnector) Open(remotePath string) (io.ReadCloser, int64, error) {
+	file, err := c.FS.stat(c.fullPath(remotePath))
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(bytes.NewReader(file.data)), int64(len(file.data)), nil
+}
+
+// OpenRange has no validator, the files are never changed under an open range
+func (c *MemoryConnector) OpenRange(remotePath string, offset int64, ifRange string) (io.ReadCloser, int64, string, bool, error) {
+	file, err := c.FS.stat(c.fullPath(remotePath))
+	if err != nil {
+		return nil, 0, "", false, err
+	}
+	if offset < 0 || offset > int64(len(file.data)) {
+		return io.NopCloser(bytes.NewReader(file.data)), int64(len(file.data)), "", false, nil
+	}
+	return io.NopCloser(bytes.NewReader(file.data[offset:])), int64(len(file.data)) - offset, "", true, nil
+}
+
+// Create buffers the content, the file is written on close
+func (c *MemoryConnector) Create(remotePath string, perm fs.FileMode) (io.WriteCloser, error) {
+	return &memWriter{fs: c.FS, path: c.fullPath(remotePath), perm: perm}, nil
+}
+
+type memWriter struct {
+	bytes.Buffer
+	fs       *MemFS
+	path     string
+	perm     fs.FileMode
+	canceled bool
+}
+
+func (w *memWriter) Close() error {
+	if !w.canceled {
+		w.fs.WriteFile(w.path, w.Bytes(), w.perm)
+	}
+	return nil
+}
+
+func (w *memWriter) Cancel() error {
+	w.canceled = true
+	w.Reset()
+	return nil
+}
+
+/**
+* List all files and directories in the given path
+* Example:
+* ```
+* files, err := connector.List("path/subpath")
+* ```
+ */
+func (c *MemoryConnector) List(remotePath string) ([]os.FileInfo, error) {
+	dir := c.fullPath(remotePath)
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+
+	c.FS.mu.RLock()
+	defer c.FS.mu.RUnlock()
+
+	children := map[string]os.FileInfo{}
+	for p, file := range c.FS.files {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		name, _, isDir := strings.Cut(strings.TrimPrefix(p, prefix), "/")
+		if isDir {
+			children[name] = &memFileInfo{name: name, mode: fs.ModeDir | 0755}
+			continue
+		}
+		children[name] = &memFileInfo{name: name, size: int64(len(file.data)), mode: file.mode, modTime: file.modTime}
+	}
+
+	// The directories only exist through their files, except the root of the connector
+	if len(children) == 0 && memPath(remotePath) != "" {
+		return nil, fmt.Errorf("failed to list files: %w", &fs.PathError{Op: "list", Path: remotePath, Err: fs.ErrNotExist})
+	}
+
+	files := make([]os.FileInfo, 0, len(children))
+	for _, info := range children {
+		files = append(files, info)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+	return files, nil
+}
+
+func (c *MemoryConnector) Delete(remotePath string) error {
+	return c.FS.Remove(c.fullPath(remotePath))
+}
+
+func (c *MemoryConnector) Rename(oldPath string, newPath string) error {
+	c.FS.mu.Lock()
+	defer c.FS.mu.Unlock()
+
+	oldPath, newPath = c.fullPath(oldPath), c.fullPath(newPath)
+	file, ok := c.FS.files[oldPath]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: fs.ErrNotExist}
+	}
+	delete(c.FS.files, oldPath)
+	c.FS.files[newPath] = file
+	return nil
+}
+
+func (c *MemoryConnector) Walk(remotePath string, fn WalkFunc) error {
+	return walk(c, remotePath, fn)
+}
+
+func (c *MemoryConnector) GetScheme() string {
+	return MEM_SCHEME
+}
+
+func (c *MemoryConnector) IsConnected() bool {
+	return true
+}
+
+func (c *MemoryConnector) Close() error {
+	return nil
+}
+
+func (c *MemoryConnector) HasFile(remotePath string) bool {
+	_, err := c.FS.stat(c.fullPath(remotePath))
+	return err == nil
+}
+
+func (c *MemoryConnector) HasFileWithChecksum(remotePath string, checksumType ChecksumType, checksum string) bool {
+	return hasFileWithChecksum(c, remotePath, checksumType, checksum)
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (f *memFileInfo) Name() string       { return f.name }
+func (f *memFileInfo) Size() int64        { return f.size }
+func (f *memFileInfo) Mode() fs.FileMode  { return f.mode }
+func (f *memFileInfo) ModTime() time.Time { return f.modTime }
+func (f *memFileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f *memFileInfo) Sys() any           { return nil }
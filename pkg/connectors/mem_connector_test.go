@@ -0,0 +1,207 @@
+package connectors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+func newTestMemoryConnector(t *testing.T) *MemoryConnector {
+	t.Helper()
+	t.Cleanup(func() { RemoveMemFS(t.Name()) })
+
+	connector, err := NewConnector("mem://" + t.Name() + "/packs/my-pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return connector.(*MemoryConnector)
+}
+
+func TestMemoryConnectorReadWrite(t *testing.T) {
+	connector := newTestMemoryConnector(t)
+
+	if err := connector.SendFileFromBytes("manifest.json", []byte(`{"version":"1.0"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest struct{ Version string }
+	if err := connector.ReadFile("/manifest.json", &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version != "1.0" {
+		t.Errorf("version = %q, want 1.0", manifest.Version)
+	}
+
+	// The files are stored under the prefix of the connector
+	if _, err := GetMemFS(t.Name()).ReadFile("packs/my-pack/manifest.json"); err != nil {
+		t.Errorf("file not stored under the prefix: %v", err)
+	}
+
+	_, err := connector.ReadFileBytes("missing.json", -1)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestMemoryConnectorSharedByName(t *testing.T) {
+	connector := newTestMemoryConnector(t)
+	connector.SendFileFromBytes("mods/foo.jar", []byte("foo"))
+
+	other, err := NewConnector("mem://" + t.Name() + "/packs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.HasFile("my-pack/mods/foo.jar") {
+		t.Error("the connectors of the same filesystem don't share the files")
+	}
+
+	if _, err := NewConnector("mem:///packs"); err == nil {
+		t.Error("expected an error without filesystem name")
+	}
+}
+
+func TestMemoryConnectorCreate(t *testing.T) {
+	connector := newTestMemoryConnector(t)
+
+	w, err := connector.Create("libraries/foo.jar", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "foo")
+	if connector.HasFile("libraries/foo.jar") {
+		t.Error("file visible before the writer is closed")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !connector.HasFileWithChecksum("libraries/foo.jar", ChecksumTypeSHA1, utils.BytesSHA1([]byte("foo"))) {
+		t.Error("file not written")
+	}
+
+	w, _ = connector.Create("libraries/bar.jar", 0644)
+	io.WriteString(w, "bar")
+	if err := CancelWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	if connector.HasFile("libraries/bar.jar") {
+		t.Error("canceled file written")
+	}
+}
+
+func TestMemoryConnectorOpenRange(t *testing.T) {
+	connector := newTestMemoryConnector(t)
+	connector.SendFileFromBytes("minecraft.jar", []byte("0123456789"))
+
+	rc, size, _, resumed, err := connector.OpenRange("minecraft.jar", 4, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	data, _ := io.ReadAll(rc)
+	if !resumed || size != 6 || string(data) != "456789" {
+		t.Errorf("OpenRange = %q, %d, %v, want 456789, 6, true", data, size, resumed)
+	}
+}
+
+func TestMemoryConnectorListAndWalk(t *testing.T) {
+	connector := newTestMemoryConnector(t)
+	for _, file := range []string{"manifest.json", "mods/a.jar", "mods/b.jar", "libraries/x/y.jar"} {
+		connector.SendFileFromBytes(file, []byte(file))
+	}
+
+	files, err := connector.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, fmt.Sprintf("%s:%v", file.Name(), file.IsDir()))
+	}
+	if want := []string{"libraries:true", "manifest.json:false", "mods:true"}; !slices.Equal(names, want) {
+		t.Errorf("List = %v, want %v", names, want)
+	}
+
+	if _, err := connector.List("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("List(missing) err = %v, want fs.ErrNotExist", err)
+	}
+
+	walked := []string{}
+	err = connector.Walk("", func(remotePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == "libraries" {
+			return fs.SkipDir
+		}
+		walked = append(walked, remotePath)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"manifest.json", "mods", "mods/a.jar", "mods/b.jar"}; !slices.Equal(walked, want) {
+		t.Errorf("Walk = %v, want %v", walked, want)
+	}
+}
+
+func TestMemoryConnectorDeleteAndRename(t *testing.T) {
+	connector := newTestMemoryConnector(t)
+	connector.SendFileFromBytes("mods/a.jar", []byte("a"))
+
+	if err := connector.Rename("mods/a.jar", "mods/old/a.jar"); err != nil {
+		t.Fatal(err)
+	}
+	if connector.HasFile("mods/a.jar") || !connector.HasFile("mods/old/a.jar") {
+		t.Error("file not renamed")
+	}
+
+	if err := connector.Delete("mods/old/a.jar"); err != nil {
+		t.Fatal(err)
+	}
+	if connector.HasFile("mods/old/a.jar") {
+		t.Error("file not deleted")
+	}
+	if err := connector.Delete("mods/old/a.jar"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("err = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestMemoryConnectorConcurrentAccess(t *testing.T) {
+	connector := newTestMemoryConnector(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				path := fmt.Sprintf("assets/%d/%d", i, j)
+				w, _ := connector.Create(path, 0644)
+				fmt.Fprintf(w, "%d-%d", i, j)
+				w.Close()
+
+				data, err := connector.ReadFileBytes(path, -1)
+				if err != nil || string(data) != fmt.Sprintf("%d-%d", i, j) {
+					t.Errorf("read %s = %q, %v", path, data, err)
+				}
+				connector.List("assets")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(GetMemFS(t.Name()).Paths()); n != 16*50 {
+		t.Errorf("%d files, want %d", n, 16*50)
+	}
+}
@@ -0,0 +1,360 @@
+package connectors
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+const MULTI_SCHEME = "multi"
+
+// mirrorProbePath is the file requested to measure the latency of the mirrors (the pack manifest)
+const mirrorProbePath = "manifest.json"
+
+// mirrorMaxFailures is the number of consecutive failures after which a mirror is only tried last
+const mirrorMaxFailures = 3
+
+/**
+* MirrorConnector serves the same pack from several connectors (e.g. a SFTP host and a HTTP CDN)
+* Reads are sent to the fastest mirror and fail over per file to the next one when a mirror returns an error
+* or a content with a wrong checksum (see FailoverConnector), writes go to the primary mirror (the first one)
+* Example:
+* ```
+* multi://sftp://user@host/packs/my-pack|https://cdn.example.com/packs/my-pack
+* ```
+* ```
+* connector := connectors.NewMirrorConnector(sftpConnector, httpConnector)
+* ```
+ */
+type MirrorConnector struct {
+	Mirrors      []Connector // In priority order, the first one is the primary
+	ProbeLatency bool        // Order the mirrors by latency on Connect, the priority order is kept otherwise
+
+	mu       sync.Mutex
+	order    []int // Indices of the mirrors, fastest first
+	state    []mirrorState
+	served   map[string]int          // remote path => mirror which served it last
+	badFiles map[string]map[int]bool // remote path => mirrors which served a wrong content
+}
+
+type mirrorState struct {
+	connected bool
+	latency   time.Duration
+	failures  int // Consecutive failures
+}
+
+// FailoverConnector is implemented by the connectors able to serve a file from another source
+type FailoverConnector interface {
+	// ReportBadFile tells that the content last served for the file is wrong (checksum mismatch)
+	// The source which served it is not used again for this file
+	ReportBadFile(remotePath string)
+}
+
+func NewMirrorConnector(mirrors ...Connector) *MirrorConnector {
+	return &MirrorConnector{
+		Mirrors:      mirrors,
+		ProbeLatency: true,
+	}
+}
+
+// newMirrorConnector creates the mirrors with the same options, the nested uris are in u.Opaque
+func newMirrorConnector(u *url.URL, options Options) (Connector, error) {
+	// Example: multi://sftp://user@host/pack|https://cdn.example.com/pack
+	if u.Opaque == "" {
+		return nil, fmt.Errorf("expected multi://<uri>|<uri>...")
+	}
+
+	mirrors := []Connector{}
+	for _, mirrorURI := range strings.Split(u.Opaque, "|") {
+		mirror, err := NewConnector(strings.TrimSpace(mirrorURI), options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror: %w", err)
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	return NewMirrorConnector(mirrors...), nil
+}
+
+func (c *MirrorConnector) primary() Connector {
+	return c.Mirrors[0]
+}
+
+func (c *MirrorConnector) GetPath() string {
+	return c.primary().GetPath()
+}
+
+func (c *MirrorConnector) GetURI() string {
+	uris := make([]string, len(c.Mirrors))
+	for i, mirror := range c.Mirrors {
+		uris[i] = mirror.GetURI()
+	}
+	return MULTI_SCHEME + "://" + strings.Join(uris, "|")
+}
+
+// Connect connects every mirror, it only fails if none of them is reachable
+// The mirrors are then ordered by the latency of a request on the manifest
+func (c *MirrorConnector) Connect() error {
+	if len(c.Mirrors) == 0 {
+		return fmt.Errorf("no mirror configured")
+	}
+
+	state := make([]mirrorState, len(c.Mirrors))
+	errs := make([]error, len(c.Mirrors))
+
+	var wg sync.WaitGroup
+	for i, mirror := range c.Mirrors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := mirror.Connect(); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", mirror.GetURI(), err)
+				return
+			}
+			state[i].connected = true
+
+			if c.ProbeLatency {
+				start := time.Now()
+				if !mirror.HasFile(mirrorProbePath) {
+					// Reachable but not serving the pack, only used as a last resort
+					state[i].failures = mirrorMaxFailures
+				}
+				state[i].latency = time.Since(start)
+			}
+		}()
+	}
+	wg.Wait()
+
+	order := []int{}
+	for i := range c.Mirrors {
+		if state[i].connected {
+			order = append(order, i)
+		}
+	}
+	if len(order) == 0 {
+		return fmt.Errorf("failed to connect to any mirror: %w", errors.Join(errs...))
+	}
+
+	// Stable sort, the priority order is kept between mirrors with the same latency (or without probe)
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(state[a].latency, state[b].latency)
+	})
+
+	c.mu.Lock()
+	c.state = state
+	c.order = order
+	c.served = map[string]int{}
+	c.badFiles = map[string]map[int]bool{}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *MirrorConnector) Login() error {
+	return nil
+}
+
+// candidates returns the mirrors to try for the file: the healthy ones by latency, then the failing ones
+// The mirrors which served a wrong content for the file are excluded
+func (c *MirrorConnector) candidates(remotePath string) []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	healthy, failing := []int{}, []int{}
+	for _, i := range c.order {
+		if c.badFiles[remotePath][i] {
+			continue
+		}
+		if c.state[i].failures >= mirrorMaxFailures {
+			failing = append(failing, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, failing...)
+}
+
+// try runs the operation on each candidate mirror until one succeeds
+func (c *MirrorConnector) try(remotePath string, fn func(mirror Connector) error) error {
+	candidates := c.candidates(remotePath)
+	if len(candidates) == 0 {
+		return fmt.Errorf("no mirror available for %s", remotePath)
+	}
+
+	errs := []error{}
+	for _, i := range candidates {
+		err := fn(c.Mirrors[i])
+
+		c.mu.Lock()
+		if err == nil {
+			c.state[i].failures = 0
+			c.served[remotePath] = i
+		} else if !isNotFoundError(err) {
+			// A missing file doesn't mean the mirror is down
+			c.state[i].failures++
+		}
+		c.mu.Unlock()
+
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", c.Mirrors[i].GetURI(), err))
+	}
+	return fmt.Errorf("all mirrors failed for %s: %w", remotePath, errors.Join(errs...))
+}
+
+// ReportBadFile excludes the mirror which served the file last, the next read of the file uses another mirror
+func (c *MirrorConnector) ReportBadFile(remotePath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.served[remotePath]
+	if !ok {
+		return
+	}
+	if c.badFiles[remotePath] == nil {
+		c.badFiles[remotePath] = map[int]bool{}
+	}
+	c.badFiles[remotePath][i] = true
+	delete(c.served, remotePath)
+}
+
+func isNotFoundError(err error) bool {
+	var statusErr *utils.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusNotFound
+	}
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// ReadFile unmarshals the file of the first mirror serving a valid json
+func (c *MirrorConnector) ReadFile(remotePath string, dest any) error {
+	return c.try(remotePath, func(mirror Connector) error {
+		bytes, err := mirror.ReadFileBytes(remotePath, -1)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(bytes, dest)
+	})
+}
+
+func (c *MirrorConnector) ReadFileBytes(remotePath string, size int64) ([]byte, error) {
+	var data []byte
+	err := c.try(remotePath, func(mirror Connector) error {
+		var err error
+		data, err = mirror.ReadFileBytes(remotePath, size)
+		return err
+	})
+	return data, err
+}
+
+func (c *MirrorConnector) SendFile(remotePath string, localPath string) error {
+	return c.primary().SendFile(remotePath, localPath)
+}
+
+func (c *MirrorConnector) SendFileFromBytes(remotePath string, bytes []byte, perm ...fs.FileMode) error {
+	return c.primary().SendFileFromBytes(remotePath, bytes, perm...)
+}
+
+func (c *MirrorConnector) Open(remotePath string) (io.ReadCloser, int64, error) {
+	var rc io.ReadCloser
+	var size int64
+	err := c.try(remotePath, func(mirror Connector) error {
+		var err error
+		rc, size, err = mirror.Open(remotePath)
+		return err
+	})
+	return rc, size, err
+}
+
+// OpenRange resumes the file from the first mirror able to open it, the whole file is sent by the mirrors without range support
+// The validator of another mirror doesn't match, the whole file is then sent
+func (c *MirrorConnector) OpenRange(remotePath string, offset int64, ifRange string) (io.ReadCloser, int64, string, bool, error) {
+	var rc io.ReadCloser
+	var size int64
+	var validator string
+	var resumed bool
+	err := c.try(remotePath, func(mirror Connector) error {
+		var err error
+		if rangeConnector, ok := mirror.(RangeConnector); ok {
+			rc, size, validator, resumed, err = rangeConnector.OpenRange(remotePath, offset, ifRange)
+			return err
+		}
+		rc, size, err = mirror.Open(remotePath)
+		validator, resumed = "", false
+		return err
+	})
+	return rc, size, validator, resumed, err
+}
+
+func (c *MirrorConnector) Create(remotePath string, perm fs.FileMode) (io.WriteCloser, error) {
+	return c.primary().Create(remotePath, perm)
+}
+
+func (c *MirrorConnector) List(remotePath string) ([]os.FileInfo, error) {
+	var files []os.FileInfo
+	err := c.try(remotePath, func(mirror Connector) error {
+		var err error
+		files, err = mirror.List(remotePath)
+		return err
+	})
+	return files, err
+}
+
+func (c *MirrorConnector) Delete(remotePath string) error {
+	return c.primary().Delete(remotePath)
+}
+
+func (c *MirrorConnector) Rename(oldPath string, newPath string) error {
+	return c.primary().Rename(oldPath, newPath)
+}
+
+func (c *MirrorConnector) Walk(remotePath string, fn WalkFunc) error {
+	return walk(c, remotePath, fn)
+}
+
+func (c *MirrorConnector) GetScheme() string {
+	return MULTI_SCHEME
+}
+
+func (c *MirrorConnector) IsConnected() bool {
+	return slices.ContainsFunc(c.Mirrors, Connector.IsConnected)
+}
+
+func (c *MirrorConnector) Close() error {
+	errs := []error{}
+	for _, mirror := range c.Mirrors {
+		if err := mirror.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *MirrorConnector) HasFile(remotePath string) bool {
+	return c.try(remotePath, func(mirror Connector) error {
+		if !mirror.HasFile(remotePath) {
+			return fs.ErrNotExist
+		}
+		return nil
+	}) == nil
+}
+
+func (c *MirrorConnector) HasFileWithChecksum(remotePath string, checksumType ChecksumType, checksum string) bool {
+	return c.try(remotePath, func(mirror Connector) error {
+		if !mirror.HasFileWithChecksum(remotePath, checksumType, checksum) {
+			return fs.ErrNotExist
+		}
+		return nil
+	}) == nil
+}
@@ -0,0 +1,225 @@
+package connectors
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+// testMirror is a file connector recording its reads, failing them with err when set
+type testMirror struct {
+	*FileConnector
+	connectErr error
+
+	mu    sync.Mutex
+	err   error
+	reads []string
+}
+
+func newTestMirror(t *testing.T, files map[string]string) *testMirror {
+	t.Helper()
+	mirror := &testMirror{FileConnector: &FileConnector{Path: t.TempDir()}}
+	for path, content := range files {
+		writeTestFile(t, filepath.Join(mirror.Path, path), content)
+	}
+	return mirror
+}
+
+func writeTestFile(t *testing.T, filePath string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (m *testMirror) Connect() error {
+	return m.connectErr
+}
+
+func (m *testMirror) fail(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *testMirror) ReadFileBytes(remotePath string, size int64) ([]byte, error) {
+	m.mu.Lock()
+	m.reads = append(m.reads, remotePath)
+	err := m.err
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return m.FileConnector.ReadFileBytes(remotePath, size)
+}
+
+func (m *testMirror) readCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.reads)
+}
+
+func newTestMirrorConnector(t *testing.T, mirrors ...*testMirror) *MirrorConnector {
+	t.Helper()
+	connectors := []Connector{}
+	for _, mirror := range mirrors {
+		connectors = append(connectors, mirror)
+	}
+	connector := NewMirrorConnector(connectors...)
+	connector.ProbeLatency = false
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return connector
+}
+
+func TestMirrorConnectorFailover(t *testing.T) {
+	files := map[string]string{"mods/a.jar": "a", "mods/b.jar": "b"}
+	primary, backup := newTestMirror(t, files), newTestMirror(t, files)
+	connector := newTestMirrorConnector(t, primary, backup)
+
+	// The priority order is kept without probe
+	if data, err := connector.ReadFileBytes("mods/a.jar", -1); err != nil || string(data) != "a" || backup.readCount() != 0 {
+		t.Fatalf("read %q, %v from the backup %d times, want the primary", data, err, backup.readCount())
+	}
+
+	// Each file fails over to the next mirror
+	primary.fail(&utils.StatusError{StatusCode: http.StatusBadGateway})
+	if data, err := connector.ReadFileBytes("mods/b.jar", -1); err != nil || string(data) != "b" {
+		t.Errorf("read %q, %v, want the content of the backup", data, err)
+	}
+
+	// After mirrorMaxFailures failures in a row the primary is only tried last
+	for range mirrorMaxFailures {
+		connector.ReadFileBytes("mods/a.jar", -1)
+	}
+	reads := primary.readCount()
+	connector.ReadFileBytes("mods/a.jar", -1)
+	if primary.readCount() != reads {
+		t.Error("failing mirror still tried first")
+	}
+
+	// A success makes it healthy again
+	backup.fail(errors.New("connection reset"))
+	primary.fail(nil)
+	if data, err := connector.ReadFileBytes("mods/a.jar", -1); err != nil || string(data) != "a" {
+		t.Fatalf("read %q, %v, want the primary as a last resort", data, err)
+	}
+	backup.fail(nil)
+	reads = primary.readCount()
+	connector.ReadFileBytes("mods/a.jar", -1)
+	if primary.readCount() != reads+1 {
+		t.Error("recovered mirror not tried first")
+	}
+}
+
+func TestMirrorConnectorMissingFile(t *testing.T) {
+	primary := newTestMirror(t, map[string]string{"manifest.json": "{}"})
+	backup := newTestMirror(t, map[string]string{"manifest.json": "{}", "mods/a.jar": "a"})
+	connector := newTestMirrorConnector(t, primary, backup)
+
+	// A missing file is served by another mirror without marking the mirror as failing
+	for range mirrorMaxFailures + 1 {
+		if data, err := connector.ReadFileBytes("mods/a.jar", -1); err != nil || string(data) != "a" {
+			t.Fatalf("read %q, %v, want the file of the backup", data, err)
+		}
+	}
+	reads := primary.readCount()
+	connector.ReadFileBytes("manifest.json", -1)
+	if primary.readCount() != reads+1 {
+		t.Error("mirror without a file demoted")
+	}
+
+	_, err := connector.ReadFileBytes("mods/missing.jar", -1)
+	if err == nil || !strings.Contains(err.Error(), "all mirrors failed") {
+		t.Errorf("err = %v, want the errors of all the mirrors", err)
+	}
+}
+
+func TestMirrorConnectorReportBadFile(t *testing.T) {
+	primary := newTestMirror(t, map[string]string{"mods/a.jar": "corrupted"})
+	backup := newTestMirror(t, map[string]string{"mods/a.jar": "a"})
+	connector := newTestMirrorConnector(t, primary, backup)
+
+	var failover FailoverConnector = connector
+	connector.ReadFileBytes("mods/a.jar", -1)
+	failover.ReportBadFile("mods/a.jar")
+
+	if data, _ := connector.ReadFileBytes("mods/a.jar", -1); string(data) != "a" {
+		t.Errorf("read %q, want the content of the backup", data)
+	}
+	// The mirror is only excluded for this file
+	writeTestFile(t, filepath.Join(primary.Path, "mods/b.jar"), "b")
+	reads := primary.readCount()
+	connector.ReadFileBytes("mods/b.jar", -1)
+	if primary.readCount() != reads+1 {
+		t.Error("mirror excluded for every file")
+	}
+}
+
+func TestMirrorConnectorConnect(t *testing.T) {
+	down := newTestMirror(t, nil)
+	down.connectErr = errors.New("connection refused")
+	empty := newTestMirror(t, nil)
+	up := newTestMirror(t, map[string]string{"manifest.json": "{}"})
+
+	// The unreachable mirrors are skipped, the ones without the pack are only used last
+	connector := NewMirrorConnector(down, empty, up)
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	connector.ReadFileBytes("manifest.json", -1)
+	if down.readCount() != 0 || empty.readCount() != 0 || up.readCount() != 1 {
+		t.Errorf("reads down %d empty %d up %d, want the mirror serving the pack", down.readCount(), empty.readCount(), up.readCount())
+	}
+
+	// Writes go to the primary
+	connector.SendFileFromBytes("mods/a.jar", []byte("a"))
+	if !down.FileConnector.HasFile("mods/a.jar") || up.FileConnector.HasFile("mods/a.jar") {
+		t.Error("file not written to the primary mirror")
+	}
+
+	if err := NewMirrorConnector(down).Connect(); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("err = %v, want the error of the mirror", err)
+	}
+}
+
+func TestMirrorConnectorHttpMirror(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("from http"))
+	}))
+	defer server.Close()
+
+	// The first mirror doesn't have the file, the http one serves it
+	connector := NewMirrorConnector(&FileConnector{Path: t.TempDir()}, &HttpConnector{URL: server.URL + "/pack"})
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := connector.ReadFileBytes("mods/a.jar", -1); err != nil || string(data) != "from http" {
+		t.Errorf("read %q, %v", data, err)
+	}
+}
+
+func TestMirrorConnectorFromURI(t *testing.T) {
+	connector := FindConnectorFromURI("multi://file:///srv/packs/my-pack|https://cdn.example.com/packs/my-pack")
+	mirror, ok := connector.(*MirrorConnector)
+	if !ok || len(mirror.Mirrors) != 2 {
+		t.Fatalf("connector = %#v, want the 2 mirrors", connector)
+	}
+	if path := mirror.Mirrors[0].GetPath(); path != "/srv/packs/my-pack" {
+		t.Errorf("path of the first mirror = %s", path)
+	}
+	if _, ok := mirror.Mirrors[1].(*HttpConnector); !ok {
+		t.Errorf("second mirror = %T, want an http connector", mirror.Mirrors[1])
+	}
+}
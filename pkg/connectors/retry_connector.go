@@ -0,0 +1,198 @@
+package connectors
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/textproto"
+	"os"
+
+	"github.com/pkg/sftp"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+/**
+* RetryConnector is a middleware retrying the operations of a connector which fail with a transient error
+* (dropped connection, timeout, 5xx...), following the same policy as the HTTP layer
+* Streams returned by Open are not retried once opened, GameFolder.Build resumes them from the .part file
+* Example:
+* ```
+* sftpConnector, err := connectors.NewConnector("sftp://user@host/pack")
+* connector := connectors.WithRetry(sftpConnector, utils.DefaultRetryPolicy)
+* ```
+ */
+type RetryConnector struct {
+	Connector
+	Policy utils.RetryPolicy
+}
+
+// WithRetry wraps the connector with a RetryConnector
+// The HTTP based connectors (http, https, s3, webdav) already retry their requests and are returned as is, like nil
+func WithRetry(connector Connector, policy utils.RetryPolicy) Connector {
+	switch connector.(type) {
+	case nil, *HttpConnector, *S3Connector, *WebDAVConnector, *RetryConnector:
+		return connector
+	}
+	return &RetryConnector{Connector: connector, Policy: policy}
+}
+
+// Unwrap returns the wrapped connector
+func (c *RetryConnector) Unwrap() Connector {
+	return c.Connector
+}
+
+// Unwrap returns the innermost connector of the middlewares
+func Unwrap(connector Connector) Connector {
+	for {
+		wrapper, ok := connector.(interface{ Unwrap() Connector })
+		if !ok {
+			return connector
+		}
+		connector = wrapper.Unwrap()
+	}
+}
+
+/**
+* Find the first connector of the middleware chain implementing T, like errors.As
+* Example:
+* ```
+* failover, ok := connectors.As[connectors.FailoverConnector](connector)
+* ```
+ */
+func As[T any](connector Connector) (T, bool) {
+	for connector != nil {
+		if found, ok := connector.(T); ok {
+			return found, true
+		}
+		wrapper, ok := connector.(interface{ Unwrap() Connector })
+		if !ok {
+			break
+		}
+		connector = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// retry runs the operation following the policy, the errors of the connector libraries are also classified
+func (c *RetryConnector) retry(fn func() error) error {
+	return c.Policy.RetryIf(isTransientConnectorError, fn)
+}
+
+func (c *RetryConnector) Connect() error {
+	return c.retry(c.Connector.Connect)
+}
+
+func (c *RetryConnector) ReadFile(remotePath string, dest any) error {
+	return c.retry(func() error {
+		return c.Connector.ReadFile(remotePath, dest)
+	})
+}
+
+func (c *RetryConnector) ReadFileBytes(remotePath string, size int64) ([]byte, error) {
+	var data []byte
+	err := c.retry(func() error {
+		var err error
+		data, err = c.Connector.ReadFileBytes(remotePath, size)
+		return err
+	})
+	return data, err
+}
+
+func (c *RetryConnector) SendFile(remotePath string, localPath string) error {
+	return c.retry(func() error {
+		return c.Connector.SendFile(remotePath, localPath)
+	})
+}
+
+func (c *RetryConnector) SendFileFromBytes(remotePath string, bytes []byte, perm ...fs.FileMode) error {
+	return c.retry(func() error {
+		return c.Connector.SendFileFromBytes(remotePath, bytes, perm...)
+	})
+}
+
+func (c *RetryConnector) Open(remotePath string) (io.ReadCloser, int64, error) {
+	var rc io.ReadCloser
+	var size int64
+	err := c.retry(func() error {
+		var err error
+		rc, size, err = c.Connector.Open(remotePath)
+		return err
+	})
+	return rc, size, err
+}
+
+// OpenRange resumes the download if the wrapped connector supports it, otherwise the whole file is opened
+func (c *RetryConnector) OpenRange(remotePath string, offset int64, ifRange string) (io.ReadCloser, int64, string, bool, error) {
+	rangeConnector, ok := c.Connector.(RangeConnector)
+	if !ok {
+		rc, size, err := c.Open(remotePath)
+		return rc, size, "", false, err
+	}
+
+	var rc io.ReadCloser
+	var size int64
+	var validator string
+	var resumed bool
+	err := c.retry(func() error {
+		var err error
+		rc, size, validator, resumed, err = rangeConnector.OpenRange(remotePath, offset, ifRange)
+		return err
+	})
+	return rc, size, validator, resumed, err
+}
+
+// Create retries the creation of the writer, the written data is not retried
+func (c *RetryConnector) Create(remotePath string, perm fs.FileMode) (io.WriteCloser, error) {
+	var w io.WriteCloser
+	err := c.retry(func() error {
+		var err error
+		w, err = c.Connector.Create(remotePath, perm)
+		return err
+	})
+	return w, err
+}
+
+func (c *RetryConnector) List(remotePath string) ([]os.FileInfo, error) {
+	var files []os.FileInfo
+	err := c.retry(func() error {
+		var err error
+		files, err = c.Connector.List(remotePath)
+		return err
+	})
+	return files, err
+}
+
+func (c *RetryConnector) Delete(remotePath string) error {
+	return c.retry(func() error {
+		return c.Connector.Delete(remotePath)
+	})
+}
+
+func (c *RetryConnector) Rename(oldPath string, newPath string) error {
+	return c.retry(func() error {
+		return c.Connector.Rename(oldPath, newPath)
+	})
+}
+
+// Walk lists the directories through the middleware, so each listing is retried
+func (c *RetryConnector) Walk(remotePath string, fn WalkFunc) error {
+	return walk(c, remotePath, fn)
+}
+
+// isTransientConnectorError extends utils.IsTransientError with the errors of the SFTP and FTP libraries
+func isTransientConnectorError(err error) bool {
+	if utils.IsTransientError(err) {
+		return true
+	}
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, sftp.ErrSSHFxNoConnection) {
+		return true
+	}
+
+	// FTP 4xx replies are "transient negative completion" (421 service not available, 425 can't open data connection...)
+	var ftpErr *textproto.Error
+	if errors.As(err, &ftpErr) {
+		return ftpErr.Code >= 400 && ftpErr.Code < 500
+	}
+	return false
+}
@@ -0,0 +1,760 @@
+package connectors
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+const S3_SCHEME = "s3"
+
+const (
+	S3_DEFAULT_REGION        = "us-east-1"
+	S3_MULTIPART_THRESHOLD   = 16 << 20 // Files bigger than 16MiB are sent with a multipart upload
+	S3_MULTIPART_PART_SIZE   = 8 << 20  // Must be >= 5MiB (S3 minimum, except for the last part)
+	s3SigningAlgorithm       = "AWS4-HMAC-SHA256"
+	s3MetadataSHA1           = "X-Amz-Meta-Sha1"
+	s3MetadataSHA256         = "X-Amz-Meta-Sha256"
+	s3EmptyPayloadSHA256     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3AmzDateFormat          = "20060102T150405Z"
+	s3AmzShortDateFormat     = "20060102"
+	s3ServiceName            = "s3"
+	s3RequestTerminationName = "aws4_request"
+)
+
+type S3Connector struct {
+	Bucket   string
+	Prefix   string
+	Region   string
+	Endpoint string // e.g. https://minio.example.com, empty for AWS
+	// PathStyle sends requests as <endpoint>/<bucket>/<key> instead of <bucket>.<endpoint>/<key>
+	// Most self-hosted stores (MinIO, Garage, Ceph...) expect path style
+	PathStyle bool
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	client *http.Client
+}
+
+/**
+* Create a S3 connector from an uri
+* Example:
+* ```
+* s3://bucket/prefix
+* s3://ACCESS_KEY:SECRET_KEY@bucket/prefix?region=eu-west-3
+* s3://bucket/prefix?endpoint=https://minio.example.com&region=us-east-1
+* ```
+* Credentials fallback to AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+* Region fallback to AWS_REGION, endpoint to AWS_ENDPOINT_URL_S3 / AWS_ENDPOINT_URL
+ */
+func newS3Connector(parsed *url.URL, options Options) (Connector, error) {
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("missing bucket")
+	}
+
+	region := options.Get(parsed, "region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = S3_DEFAULT_REGION
+	}
+
+	endpoint := options.Get(parsed, "endpoint")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL_S3")
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	// Self-hosted stores rarely support virtual hosted buckets
+	pathStyle := endpoint != ""
+	if ps := options.Get(parsed, "path_style"); ps != "" {
+		v, err := strconv.ParseBool(ps)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_style option %q: %w", ps, err)
+		}
+		pathStyle = v
+	}
+
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if parsed.User != nil {
+		accessKey = parsed.User.Username()
+		if pw, set := parsed.User.Password(); set {
+			secretKey = pw
+		}
+	}
+
+	client, err := options.httpClient(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Connector{
+		Bucket:       parsed.Host,
+		Prefix:       strings.Trim(parsed.Path, "/"),
+		Region:       region,
+		Endpoint:     endpoint,
+		PathStyle:    pathStyle,
+		AccessKey:    accessKey,
+		SecretKey:    secretKey,
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       client,
+	}, nil
+}
+
+func (c *S3Connector) GetPath() string {
+	return c.Prefix
+}
+
+func (c *S3Connector) GetURI() string {
+	uri := S3_SCHEME + "://" + c.Bucket + "/" + c.Prefix
+	if c.Endpoint != "" {
+		uri += "?endpoint=" + url.QueryEscape(c.Endpoint)
+	}
+	return uri
+}
+
+func (c *S3Connector) Connect() error {
+	if c.client == nil {
+		c.client = utils.HTTPClient()
+	}
+	return nil
+}
+
+func (c *S3Connector) Login() error {
+	return nil
+}
+
+/**
+* Internal function to get the object key of a remote path, the . and .. segments are resolved like a file path
+* without going above the bucket
+* Example: prefix = "packs/my-pack", remotePath = "/libraries/a.jar" => "packs/my-pack/libraries/a.jar"
+ */
+func (c *S3Connector) formatKey(remotePath string) string {
+	key := strings.ReplaceAll(remotePath, "\\", "/")
+	if c.Prefix != "" {
+		key = c.Prefix + "/" + key
+	}
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
+
+func (c *S3Connector) objectURL(key string, query url.Values) *url.URL {
+	var u *url.URL
+	if c.Endpoint != "" {
+		u, _ = url.Parse(c.Endpoint)
+	} else {
+		u = &url.URL{Scheme: "https", Host: "s3." + c.Region + ".amazonaws.com"}
+	}
+
+	if c.PathStyle {
+		u.Path = "/" + c.Bucket + "/" + key
+	} else {
+		u.Host = c.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+
+	if query != nil {
+		u.RawQuery = s3CanonicalQuery(query)
+	}
+	return u
+}
+
+func (c *S3Connector) ReadFile(remotePath string, dest any) error {
+	bytes, err := c.ReadFileBytes(remotePath, -1)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, dest)
+}
+
+func (c *S3Connector) ReadFileBytes(remotePath string, size int64) ([]byte, error) {
+	resp, err := c.do(http.MethodGet, c.formatKey(remotePath), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if size > 0 {
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(resp.Body, buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (c *S3Connector) SendFile(remotePath string, localPath string) error {
+	bytes, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	return c.SendFileFromBytes(remotePath, bytes)
+}
+
+// SendFileFromBytes uploads the object, objects bigger than S3_MULTIPART_THRESHOLD use a multipart upload
+// Permissions are ignored as object storages have no notion of file mode
+func (c *S3Connector) SendFileFromBytes(remotePath string, buf []byte, perm ...fs.FileMode) error {
+	w, err := c.Create(remotePath, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(buf); err != nil {
+		CancelWriter(w)
+		return err
+	}
+	return w.Close()
+}
+
+func (c *S3Connector) Open(remotePath string) (io.ReadCloser, int64, error) {
+	resp, err := c.do(http.MethodGet, c.formatKey(remotePath), nil, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (c *S3Connector) OpenRange(remotePath string, offset int64) (io.ReadCloser, int64, bool, error) {
+	headers := map[string]string{}
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+	resp, err := c.do(http.MethodGet, c.formatKey(remotePath), nil, headers, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return resp.Body, resp.ContentLength, offset > 0 && resp.StatusCode == http.StatusPartialContent, nil
+}
+
+// Create returns a writer buffering up to S3_MULTIPART_THRESHOLD bytes in memory
+// Bigger objects are streamed with a multipart upload, one part of S3_MULTIPART_PART_SIZE at a time
+// Permissions are ignored as object storages have no notion of file mode
+func (c *S3Connector) Create(remotePath string, perm fs.FileMode) (io.WriteCloser, error) {
+	return &s3Writer{
+		connector: c,
+		key:       c.formatKey(remotePath),
+		sha1:      sha1.New(),
+		sha256:    sha256.New(),
+	}, nil
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+// s3Writer uploads an object with a single PUT, or with a multipart upload once it exceeds S3_MULTIPART_THRESHOLD
+type s3Writer struct {
+	connector *S3Connector
+	key       string
+
+	buf      bytes.Buffer
+	uploadID string
+	parts    []s3CompletedPart
+
+	sha1   hash.Hash
+	sha256 hash.Hash
+	err    error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf.Write(p)
+	w.sha1.Write(p)
+	w.sha256.Write(p)
+
+	if w.uploadID == "" && w.buf.Len() <= S3_MULTIPART_THRESHOLD {
+		return len(p), nil
+	}
+
+	// Flush the full parts
+	for w.buf.Len() >= S3_MULTIPART_PART_SIZE {
+		if err := w.uploadPart(w.buf.Next(S3_MULTIPART_PART_SIZE)); err != nil {
+			w.err = err
+			w.abort()
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *s3Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	c := w.connector
+
+	// Checksums are stored in the object metadata so HasFileWithChecksum don't need to download the object
+	headers := map[string]string{
+		s3MetadataSHA1:   hex.EncodeToString(w.sha1.Sum(nil)),
+		s3MetadataSHA256: hex.EncodeToString(w.sha256.Sum(nil)),
+		"Content-Type":   "application/octet-stream",
+	}
+
+	if w.uploadID == "" {
+		resp, err := c.do(http.MethodPut, w.key, nil, headers, w.buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("put %s: %w", w.key, err)
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	// Last part may be smaller than S3_MULTIPART_PART_SIZE
+	if w.buf.Len() > 0 {
+		if err := w.uploadPart(w.buf.Next(w.buf.Len())); err != nil {
+			w.abort()
+			return err
+		}
+	}
+
+	if err := w.complete(); err != nil {
+		w.abort()
+		return err
+	}
+
+	// The checksums are only known at the end of the upload, copy the object on itself to set them (best effort)
+	headers["X-Amz-Copy-Source"] = "/" + c.Bucket + "/" + s3EscapePath(w.key)
+	headers["X-Amz-Metadata-Directive"] = "REPLACE"
+	if resp, err := c.do(http.MethodPut, w.key, nil, headers, nil); err == nil {
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+func (w *s3Writer) Cancel() error {
+	w.err = fmt.Errorf("upload of %s canceled", w.key)
+	w.abort()
+	return nil
+}
+
+func (w *s3Writer) uploadPart(part []byte) error {
+	c := w.connector
+
+	// Initiate the upload on the first part
+	if w.uploadID == "" {
+		resp, err := c.do(http.MethodPost, w.key, url.Values{"uploads": {""}}, map[string]string{"Content-Type": "application/octet-stream"}, nil)
+		if err != nil {
+			return fmt.Errorf("initiate multipart upload %s: %w", w.key, err)
+		}
+		var initiated s3InitiateMultipartUploadResult
+		err = xml.NewDecoder(resp.Body).Decode(&initiated)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("decode multipart upload response: %w", err)
+		}
+		w.uploadID = initiated.UploadID
+	}
+
+	partNumber := len(w.parts) + 1
+	query := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {w.uploadID},
+	}
+	resp, err := c.do(http.MethodPut, w.key, query, nil, part)
+	if err != nil {
+		return fmt.Errorf("upload part %d of %s: %w", partNumber, w.key, err)
+	}
+	resp.Body.Close()
+
+	w.parts = append(w.parts, s3CompletedPart{
+		PartNumber: partNumber,
+		ETag:       resp.Header.Get("ETag"),
+	})
+	return nil
+}
+
+func (w *s3Writer) complete() error {
+	body, err := xml.Marshal(s3CompleteMultipartUpload{Parts: w.parts})
+	if err != nil {
+		return fmt.Errorf("marshal complete multipart upload: %w", err)
+	}
+
+	resp, err := w.connector.do(http.MethodPost, w.key, url.Values{"uploadId": {w.uploadID}}, map[string]string{"Content-Type": "application/xml"}, body)
+	if err != nil {
+		return fmt.Errorf("complete multipart upload %s: %w", w.key, err)
+	}
+	defer resp.Body.Close()
+
+	// S3 may answer 200 with an error document when the completion fails
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read complete multipart upload response: %w", err)
+	}
+	if bytes.Contains(respBody, []byte("<Error>")) {
+		return fmt.Errorf("complete multipart upload %s: %s", w.key, string(respBody))
+	}
+	return nil
+}
+
+func (w *s3Writer) abort() {
+	if w.uploadID == "" {
+		return
+	}
+	if resp, err := w.connector.do(http.MethodDelete, w.key, url.Values{"uploadId": {w.uploadID}}, nil, nil); err == nil {
+		resp.Body.Close()
+	}
+	w.uploadID = ""
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+/**
+* List all files and directories in the given path
+* Directories are the common prefixes of the object keys
+* Example:
+* ```
+* files, err := connector.List("path/subpath")
+* ```
+ */
+func (c *S3Connector) List(remotePath string) ([]os.FileInfo, error) {
+	prefix := strings.TrimSuffix(c.formatKey(remotePath), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	files := []os.FileInfo{}
+	continuationToken := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+			"delimiter": {"/"},
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		resp, err := c.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+		var result s3ListBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode list response: %w", err)
+		}
+
+		for _, p := range result.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(p.Prefix, prefix), "/")
+			files = append(files, &s3FileInfo{name: name, dir: true})
+		}
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, prefix)
+			if name == "" {
+				// Directory marker
+				continue
+			}
+			modTime, _ := time.Parse(time.RFC3339, object.LastModified)
+			files = append(files, &s3FileInfo{name: name, size: object.Size, modTime: modTime})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+
+	return files, nil
+}
+
+func (c *S3Connector) Delete(remotePath string) error {
+	key := c.formatKey(remotePath)
+	resp, err := c.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Rename copies the object (metadata included) then deletes the source, object storages can't move objects
+func (c *S3Connector) Rename(oldPath string, newPath string) error {
+	oldKey := c.formatKey(oldPath)
+	newKey := c.formatKey(newPath)
+
+	resp, err := c.do(http.MethodPut, newKey, nil, map[string]string{
+		"X-Amz-Copy-Source": "/" + c.Bucket + "/" + s3EscapePath(oldKey),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("copy %s to %s: %w", oldKey, newKey, err)
+	}
+	resp.Body.Close()
+
+	return c.Delete(oldPath)
+}
+
+func (c *S3Connector) Walk(remotePath string, fn WalkFunc) error {
+	return walk(c, remotePath, fn)
+}
+
+func (c *S3Connector) GetScheme() string {
+	return S3_SCHEME
+}
+
+func (c *S3Connector) IsConnected() bool {
+	return c.client != nil
+}
+
+func (c *S3Connector) Close() error {
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (c *S3Connector) HasFile(remotePath string) bool {
+	resp, err := c.do(http.MethodHead, c.formatKey(remotePath), nil, nil, nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+func (c *S3Connector) HasFileWithChecksum(remotePath string, checksumType ChecksumType, checksum string) bool {
+	key := c.formatKey(remotePath)
+
+	// Objects uploaded by launchygo carry their checksums in the metadata
+	resp, err := c.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	if remote := headerChecksum(resp.Header, checksumType, 0); remote != "" {
+		return remote == strings.ToLower(checksum)
+	}
+	if remote := sidecarChecksum(c, remotePath, checksumType); remote != "" {
+		return remote == strings.ToLower(checksum)
+	}
+
+	// Fallback for objects uploaded by other tools
+	return hasFileWithChecksum(c, remotePath, checksumType, checksum)
+}
+
+// s3FileInfo implements os.FileInfo for listed objects and common prefixes
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (f *s3FileInfo) Name() string       { return f.name }
+func (f *s3FileInfo) Size() int64        { return f.size }
+func (f *s3FileInfo) ModTime() time.Time { return f.modTime }
+func (f *s3FileInfo) IsDir() bool        { return f.dir }
+func (f *s3FileInfo) Sys() any           { return nil }
+
+func (f *s3FileInfo) Mode() fs.FileMode {
+	if f.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+/////////////////////////////////////////////////////////////////////
+// Requests & SigV4 signing
+/////////////////////////////////////////////////////////////////////
+
+// do sends a signed request and returns the response if the status code is 2xx
+func (c *S3Connector) do(method string, key string, query url.Values, headers map[string]string, body []byte) (*http.Response, error) {
+	u := c.objectURL(key, query)
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	req.ContentLength = int64(len(body))
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	c.sign(req, body, time.Now().UTC())
+
+	if c.client == nil {
+		c.client = utils.HTTPClient()
+	}
+
+	// The signature stays valid for 15 minutes, the same request can be sent again
+	resp, err := utils.DefaultRetryPolicy.Do(c.client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &utils.StatusError{StatusCode: resp.StatusCode, Description: strings.TrimSpace(string(msg))}
+	}
+
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to the request
+// Anonymous requests (no credentials) are sent unsigned, which allows reading public buckets
+func (c *S3Connector) sign(req *http.Request, body []byte, now time.Time) {
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return
+	}
+
+	amzDate := now.Format(s3AmzDateFormat)
+	shortDate := now.Format(s3AmzShortDateFormat)
+
+	payloadHash := s3EmptyPayloadSHA256
+	if len(body) > 0 {
+		payloadHash = utils.BytesSHA256(body)
+	}
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	// Canonical headers: lowercase names, sorted, trimmed values
+	signedHeaderNames := []string{}
+	canonicalHeaderValues := map[string]string{}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		signedHeaderNames = append(signedHeaderNames, lower)
+		canonicalHeaderValues[lower] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(signedHeaderNames)
+
+	canonicalHeaders := strings.Builder{}
+	for _, name := range signedHeaderNames {
+		canonicalHeaders.WriteString(name + ":" + canonicalHeaderValues[name] + "\n")
+	}
+	signedHeaders := strings.Join(signedHeaderNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{shortDate, c.Region, s3ServiceName, s3RequestTerminationName}, "/")
+	stringToSign := strings.Join([]string{
+		s3SigningAlgorithm,
+		amzDate,
+		scope,
+		utils.BytesSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := s3HMAC([]byte("AWS4"+c.SecretKey), shortDate)
+	signingKey = s3HMAC(signingKey, c.Region)
+	signingKey = s3HMAC(signingKey, s3ServiceName)
+	signingKey = s3HMAC(signingKey, s3RequestTerminationName)
+	signature := hex.EncodeToString(s3HMAC(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, c.AccessKey, scope, signedHeaders, signature))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape encodes a string following the AWS rules (RFC 3986 unreserved characters are kept)
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (keepSlash && ch == '/') {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string {
+	return s3Escape(p, true)
+}
+
+// s3CanonicalQuery encodes the query sorted by key, as required by SigV4
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,265 @@
+package connectors
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type HostKeyPolicy string
+
+const (
+	HostKeyStrict   HostKeyPolicy = "strict"   // The host key must already be in the known_hosts file
+	HostKeyTOFU     HostKeyPolicy = "tofu"     // Unknown hosts are trusted and added to the known_hosts file, changed keys are rejected
+	HostKeyInsecure HostKeyPolicy = "insecure" // No host key verification (MITM risk, for tests only)
+)
+
+/**
+* Authentication and host key verification options of the SFTP connector
+* They can also be set with the query parameters of the uri:
+* ```
+* sftp://user@host/path?key=~/.ssh/deploy_key&passphrase=secret
+* sftp://user@host/path?agent=true&known_hosts=~/.ssh/known_hosts&host_key=strict
+* sftp://user@host/path?proxy=socks5h://proxy.example:1080
+* ```
+ */
+type SFTPOptions struct {
+	KeyFiles   []string // Private key files (OpenSSH or PEM format), query: key (repeatable)
+	Passphrase string   // Passphrase of the encrypted private keys, query: passphrase
+	UseAgent   bool     // Use the keys of the ssh-agent listening on SSH_AUTH_SOCK, query: agent
+
+	KnownHostsFile string        // Default to ~/.ssh/known_hosts, query: known_hosts
+	HostKeyPolicy  HostKeyPolicy // Default to HostKeyTOFU, query: host_key
+
+	Proxy string // socks5:// or socks5h:// proxy, default to a socks ALL_PROXY (NO_PROXY honored), "direct" for none, query: proxy
+}
+
+// defaultIdentityFiles are tried when no password, key file nor agent is configured, like OpenSSH does
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// merge fills the unset options with the given ones
+func (o SFTPOptions) merge(other SFTPOptions) SFTPOptions {
+	o.KeyFiles = append(o.KeyFiles, other.KeyFiles...)
+	if o.Passphrase == "" {
+		o.Passphrase = other.Passphrase
+	}
+	o.UseAgent = o.UseAgent || other.UseAgent
+	if o.KnownHostsFile == "" {
+		o.KnownHostsFile = other.KnownHostsFile
+	}
+	if o.HostKeyPolicy == "" {
+		o.HostKeyPolicy = other.HostKeyPolicy
+	}
+	if o.Proxy == "" {
+		o.Proxy = other.Proxy
+	}
+	return o
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(p, "~"))
+		}
+	}
+	return p
+}
+
+// authMethods returns the auth methods in the order they are tried: agent, keys, then password
+func (c *SFTPConnector) authMethods() ([]ssh.AuthMethod, error) {
+	methods := []ssh.AuthMethod{}
+
+	if c.Options.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, fmt.Errorf("ssh-agent requested but SSH_AUTH_SOCK is not set")
+		}
+		// The agent connection is kept across the reconnections and closed by Close
+		if c.agentConn == nil {
+			conn, err := net.Dial("unix", sock)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+			}
+			c.agentConn = conn
+		}
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(c.agentConn).Signers))
+	}
+
+	signers := []ssh.Signer{}
+	for _, keyFile := range c.Options.KeyFiles {
+		signer, err := loadPrivateKey(expandHome(keyFile), c.Options.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	}
+
+	// Fallback to the default identities, keys which can't be loaded are skipped
+	if len(methods) == 0 && len(signers) == 0 && c.Password == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			for _, name := range defaultIdentityFiles {
+				if signer, err := loadPrivateKey(filepath.Join(home, ".ssh", name), c.Options.Passphrase); err == nil {
+					signers = append(signers, signer)
+				}
+			}
+		}
+	}
+
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if c.Password != "" || len(methods) == 0 {
+		methods = append(methods, ssh.Password(c.Password))
+	}
+	return methods, nil
+}
+
+func loadPrivateKey(keyFile string, passphrase string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key %s: %w", keyFile, err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) {
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key %s is encrypted, a passphrase is required", keyFile)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", keyFile, err)
+	}
+	return signer, nil
+}
+
+// hostKeyCallback verifies the server key against the known_hosts file following the host key policy
+// It also returns the algorithms of the known keys, so the server is asked for the key we can verify
+func (c *SFTPConnector) hostKeyCallback() (ssh.HostKeyCallback, []string, error) {
+	policy := c.Options.HostKeyPolicy
+	if policy == "" {
+		policy = HostKeyTOFU
+	}
+
+	switch policy {
+	case HostKeyInsecure:
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	case HostKeyStrict, HostKeyTOFU:
+	default:
+		return nil, nil, fmt.Errorf("unknown host key policy: %s", policy)
+	}
+
+	knownHostsFile := expandHome(c.Options.KnownHostsFile)
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	if _, err := os.Stat(knownHostsFile); os.IsNotExist(err) {
+		if policy == HostKeyStrict {
+			return nil, nil, fmt.Errorf("known_hosts file %s not found", knownHostsFile)
+		}
+		if err := os.MkdirAll(filepath.Dir(knownHostsFile), 0700); err != nil {
+			return nil, nil, fmt.Errorf("failed to create known_hosts directory: %w", err)
+		}
+		if err := os.WriteFile(knownHostsFile, nil, 0600); err != nil {
+			return nil, nil, fmt.Errorf("failed to create known_hosts file: %w", err)
+		}
+	}
+
+	verify, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read known_hosts file: %w", err)
+	}
+
+	var mu sync.Mutex
+	trusted := map[string]string{} // host => key trusted during this session (the pool dials several times)
+
+	callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := verify(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key of %s has changed, possible MITM attack (%s): %w", hostname, knownHostsFile, err)
+		}
+		if policy != HostKeyTOFU {
+			return fmt.Errorf("host %s is not in %s: %w", hostname, knownHostsFile, err)
+		}
+
+		// Unknown host, trust on first use
+		mu.Lock()
+		defer mu.Unlock()
+
+		marshaled := string(key.Marshal())
+		if known, ok := trusted[hostname]; ok {
+			if known != marshaled {
+				return fmt.Errorf("host key of %s has changed during the session", hostname)
+			}
+			return nil
+		}
+
+		f, err := os.OpenFile(knownHostsFile, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open known_hosts file: %w", err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(knownhosts.Line([]string{hostname}, key) + "\n"); err != nil {
+			return fmt.Errorf("failed to write known_hosts file: %w", err)
+		}
+
+		trusted[hostname] = marshaled
+		return nil
+	}
+
+	return callback, knownHostKeyAlgorithms(verify, net.JoinHostPort(c.Host, fmt.Sprint(c.Port))), nil
+}
+
+// knownHostKeyAlgorithms returns the algorithms of the keys known for the host
+// Without them the server may present a key of another type than the known one, which would be rejected
+func knownHostKeyAlgorithms(verify ssh.HostKeyCallback, address string) []string {
+	// Verifying a random key returns the known keys of the host
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(verify(address, &net.TCPAddr{}, probe.PublicKey()), &keyErr) {
+		return nil
+	}
+
+	algorithms := []string{}
+	for _, known := range keyErr.Want {
+		switch known.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, known.Key.Type())
+		}
+	}
+	return algorithms
+}
@@ -0,0 +1,226 @@
+package connectors
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// newTestSSHServer serves the sftp subsystem with the given host key to the user "user" with the password "secret"
+func newTestSSHServer(t *testing.T, hostKey ssh.Signer) string {
+	t.Helper()
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "user" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, config)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveTestSSHConn(conn net.Conn, config *ssh.ServerConfig) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				var subsystem struct{ Name string }
+				if req.Type != "subsystem" || ssh.Unmarshal(req.Payload, &subsystem) != nil || subsystem.Name != "sftp" {
+					// exec included, like a sftp only account
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					channel.Close()
+					return
+				}
+				go func() {
+					server.Serve()
+					server.Close()
+				}()
+			}
+		}()
+	}
+}
+
+func connectSFTP(t *testing.T, addr string, options SFTPOptions) (*SFTPConnector, error) {
+	t.Helper()
+	connector, err := NewSFTPConnector("sftp://user:secret@"+addr+filepath.ToSlash(t.TempDir()), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.SetPoolSize(1)
+	t.Cleanup(func() { connector.Close() })
+	return connector, connector.Connect()
+}
+
+func TestSFTPConnectorTrustOnFirstUse(t *testing.T) {
+	hostKey := newTestHostKey(t)
+	addr := newTestSSHServer(t, hostKey)
+	knownHosts := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+
+	// The known_hosts file is created with the key of the first connection
+	if _, err := connectSFTP(t, addr, SFTPOptions{KnownHostsFile: knownHosts, HostKeyPolicy: HostKeyTOFU}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(knownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey.PublicKey()) + "\n"
+	if string(data) != want {
+		t.Errorf("known_hosts = %q, want %q", data, want)
+	}
+
+	// The key is then known, even in strict mode, and isn't appended again
+	if _, err := connectSFTP(t, addr, SFTPOptions{KnownHostsFile: knownHosts, HostKeyPolicy: HostKeyStrict}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connectSFTP(t, addr, SFTPOptions{KnownHostsFile: knownHosts, HostKeyPolicy: HostKeyTOFU}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(knownHosts); string(data) != want {
+		t.Errorf("known_hosts = %q after the reconnections, want %q", data, want)
+	}
+}
+
+func TestSFTPConnectorChangedHostKey(t *testing.T) {
+	addr := newTestSSHServer(t, newTestHostKey(t))
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, newTestHostKey(t).PublicKey()) + "\n"
+	os.WriteFile(knownHosts, []byte(line), 0600)
+
+	for _, policy := range []HostKeyPolicy{HostKeyTOFU, HostKeyStrict} {
+		_, err := connectSFTP(t, addr, SFTPOptions{KnownHostsFile: knownHosts, HostKeyPolicy: policy})
+		if err == nil || !strings.Contains(err.Error(), "has changed") {
+			t.Errorf("%s: err = %v, want a changed host key", policy, err)
+		}
+	}
+	if data, _ := os.ReadFile(knownHosts); string(data) != line {
+		t.Errorf("known_hosts = %q, want it unchanged", data)
+	}
+}
+
+func TestSFTPConnectorStrictHostKey(t *testing.T) {
+	addr := newTestSSHServer(t, newTestHostKey(t))
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+
+	_, err := connectSFTP(t, addr, SFTPOptions{KnownHostsFile: knownHosts, HostKeyPolicy: HostKeyStrict})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("err = %v, want a missing known_hosts", err)
+	}
+	if _, err := os.Stat(knownHosts); !os.IsNotExist(err) {
+		t.Error("known_hosts created in strict mode")
+	}
+
+	os.WriteFile(knownHosts, nil, 0600)
+	_, err = connectSFTP(t, addr, SFTPOptions{KnownHostsFile: knownHosts, HostKeyPolicy: HostKeyStrict})
+	if err == nil || !strings.Contains(err.Error(), "is not in") {
+		t.Errorf("err = %v, want an unknown host", err)
+	}
+}
+
+func TestSFTPConnectorAgentConnection(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip("unix sockets not available:", err)
+	}
+	defer listener.Close()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	var dials atomic.Int32
+	closed := make(chan struct{}, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			dials.Add(1)
+			go func() {
+				agent.ServeAgent(agent.NewKeyring(), conn)
+				closed <- struct{}{}
+			}()
+		}
+	}()
+
+	// The agent has no key, the password is tried next
+	addr := newTestSSHServer(t, newTestHostKey(t))
+	connector, err := connectSFTP(t, addr, SFTPOptions{UseAgent: true, HostKeyPolicy: HostKeyInsecure})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dials.Load(); got != 1 {
+		t.Errorf("agent dialed %d times, want 1", got)
+	}
+
+	connector.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("agent connection not closed by Close")
+	}
+}
@@ -0,0 +1,41 @@
+package connectors
+
+import (
+	"testing"
+
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+func TestSFTPConnectorChecksumWithoutExec(t *testing.T) {
+	// The test server only allows the sftp subsystem, sha1sum can't run
+	addr := newTestSSHServer(t, newTestHostKey(t))
+	connector, err := connectSFTP(t, addr, SFTPOptions{HostKeyPolicy: HostKeyInsecure})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.SendFileFromBytes("mods/foo.jar", []byte("foo"))
+	connector.SendFileFromBytes("mods/bar.jar", []byte("bar"))
+
+	sha1Sum := utils.BytesSHA1([]byte("foo"))
+	if !connector.HasFileWithChecksum("mods/foo.jar", ChecksumTypeSHA1, sha1Sum) {
+		t.Error("checksum not verified by downloading the file")
+	}
+	if !connector.execUnavailable.Load() {
+		t.Error("exec still tried after being rejected")
+	}
+	if connector.HasFileWithChecksum("mods/foo.jar", ChecksumTypeSHA1, utils.BytesSHA1([]byte("bar"))) {
+		t.Error("wrong checksum accepted")
+	}
+	if connector.HasFileWithChecksum("mods/missing.jar", ChecksumTypeSHA1, sha1Sum) {
+		t.Error("missing file accepted")
+	}
+
+	// The sidecar file is used instead of the content
+	connector.SendFileFromBytes("mods/bar.jar.sha256", []byte(utils.BytesSHA256([]byte("foo"))+"  bar.jar\n"))
+	if !connector.HasFileWithChecksum("mods/bar.jar", ChecksumTypeSHA256, utils.BytesSHA256([]byte("foo"))) {
+		t.Error("sha256 sidecar not used")
+	}
+	if !connector.HasFileWithChecksum("mods/bar.jar", ChecksumTypeSHA1, utils.BytesSHA1([]byte("bar"))) {
+		t.Error("sha1 checksum not verified without its sidecar")
+	}
+}
@@ -0,0 +1,158 @@
+package connectors
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// newWebDAVServer serves dir under /dav, requestFilter answers instead of the WebDAV handler when it returns true
+func newWebDAVServer(t *testing.T, dir string, requestFilter func(w http.ResponseWriter, r *http.Request) bool) (*httptest.Server, *[]string) {
+	t.Helper()
+	handler := &webdav.Handler{Prefix: "/dav", FileSystem: webdav.Dir(dir), LockSystem: webdav.NewMemLS()}
+	var mu sync.Mutex
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		if user, password, _ := r.BasicAuth(); user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if requestFilter != nil && requestFilter(w, r) {
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func connectWebDAV(t *testing.T, server *httptest.Server, basePath string) Connector {
+	t.Helper()
+	connector, err := NewConnector("webdav://user:secret@" + strings.TrimPrefix(server.URL, "http://") + basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return connector
+}
+
+func TestWebDAVConnectorMissingBasePath(t *testing.T) {
+	dir := t.TempDir()
+	server, _ := newWebDAVServer(t, dir, nil)
+
+	// The first publish of a pack connects before the base path exists
+	connector := connectWebDAV(t, server, "/dav/packs/my-pack")
+	if connector.HasFile("manifest.json") {
+		t.Error("manifest.json found in a missing collection")
+	}
+	if err := connector.SendFileFromBytes("manifest.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := connector.SendFileFromBytes("mods/a.jar", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, content := range map[string]string{"packs/my-pack/manifest.json": "{}", "packs/my-pack/mods/a.jar": "a"} {
+		if data, err := os.ReadFile(filepath.Join(dir, path)); err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v, want %q", path, data, err, content)
+		}
+	}
+	if got := listNames(t, connector, ""); !slices.Equal(got, []string{"manifest.json", "mods"}) {
+		t.Errorf("root = %v", got)
+	}
+}
+
+func TestWebDAVConnectorCredentials(t *testing.T) {
+	server, _ := newWebDAVServer(t, t.TempDir(), nil)
+
+	connector, _ := NewConnector("webdav://user:wrong@" + strings.TrimPrefix(server.URL, "http://") + "/dav")
+	if err := connector.Connect(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("err = %v, want the 401 of the server", err)
+	}
+}
+
+func TestWebDAVConnectorExistingCollection(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "mods"), 0755)
+
+	// Some servers don't answer PROPFIND on every collection, MKCOL then answers 405 as it exists
+	server, requests := newWebDAVServer(t, dir, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PROPFIND" && r.URL.Path == "/dav/mods" {
+			w.WriteHeader(http.StatusNotFound)
+			return true
+		}
+		return false
+	})
+	connector := connectWebDAV(t, server, "/dav")
+
+	if err := connector.SendFileFromBytes("mods/a.jar", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(*requests, "MKCOL /dav/mods") {
+		t.Errorf("requests = %v, want a MKCOL of the collection", *requests)
+	}
+
+	// The collection is only checked once
+	mkcols := len(*requests)
+	connector.SendFileFromBytes("mods/b.jar", []byte("b"))
+	for _, request := range (*requests)[mkcols:] {
+		if strings.HasPrefix(request, "MKCOL") || strings.HasPrefix(request, "PROPFIND") {
+			t.Errorf("%s sent again", request)
+		}
+	}
+}
+
+func TestWebDAVConnectorStreams(t *testing.T) {
+	dir := t.TempDir()
+	server, _ := newWebDAVServer(t, dir, nil)
+	connector := connectWebDAV(t, server, "/dav")
+
+	w, err := connector.Create("libraries/net/foo.jar", 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "foo")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rc, _, err := connector.Open("libraries/net/foo.jar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "foo" {
+		t.Errorf("foo.jar = %q", data)
+	}
+
+	// A canceled upload leaves neither the file nor its .part
+	w, _ = connector.Create("libraries/net/bar.jar", 0644)
+	io.WriteString(w, "partial")
+	CancelWriter(w)
+	if got := listNames(t, connector, "libraries/net"); !slices.Equal(got, []string{"foo.jar"}) {
+		t.Errorf("libraries/net = %v, want only foo.jar", got)
+	}
+
+	if err := connector.Rename("libraries/net/foo.jar", "mods/foo.jar"); err != nil {
+		t.Fatal(err)
+	}
+	if connector.HasFile("libraries/net/foo.jar") || !connector.HasFile("mods/foo.jar") {
+		t.Error("file not moved")
+	}
+	if err := connector.Delete("mods/foo.jar"); err != nil || connector.HasFile("mods/foo.jar") {
+		t.Errorf("file not deleted: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package folder
+
+import (
+	"encoding/json"
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+// writeCatalogPack writes the pack in ./packs/<packName> with the manifest
+func writeCatalogPack(t *testing.T, packName string, manifest Manifest, files map[string]string) {
+	t.Helper()
+	dir := filepath.Join("packs", packName)
+	for path, content := range files {
+		writePackFile(t, dir, path, content)
+	}
+	manifest.McVersion, manifest.MainClass = "1.20.1", shared.MainClass
+	data, _ := json.Marshal(manifest)
+	writePackFile(t, dir, shared.MANIFEST_FILE, string(data))
+}
+
+func TestPublishUpdatesCatalog(t *testing.T) {
+	chdir(t, t.TempDir())
+	fsys := connectors.NewMemFS()
+	writeCatalogPack(t, "pack-a", Manifest{Name: "Pack A", Description: "Skyblock", Icon: "icon.png", Loader: LOADER_FABRIC},
+		map[string]string{"minecraft.jar": "a", "icon.png": "png"})
+	writeCatalogPack(t, "pack-b", Manifest{}, map[string]string{"minecraft.jar": "b"})
+
+	packA := connectors.NewMemoryConnector(fsys, "packs/pack-a")
+	if err := PublishGameFolder(packA, "pack-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishGameFolder(connectors.NewMemoryConnector(fsys, "packs/pack-b"), "pack-b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishGameFolder(packA, "pack-a", PublishOptions{Channel: "beta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	root := connectors.NewMemoryConnector(fsys, "packs")
+	catalog, err := ReadCatalog(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Packs) != 2 {
+		t.Fatalf("packs = %+v, want pack-a and pack-b", catalog.Packs)
+	}
+
+	a, b := catalog.Packs[0], catalog.Packs[1]
+	if a.Path != "pack-a" || a.Name != "Pack A" || a.Description != "Skyblock" || a.Loader != LOADER_FABRIC || a.McVersion != "1.20.1" {
+		t.Errorf("pack-a = %+v", a)
+	}
+	if a.Revision != 1 || !maps.Equal(a.Channels, Channels{"stable": 1, "beta": 2}) {
+		t.Errorf("pack-a revision %d channels %v, want the stable revision 1 and the beta 2", a.Revision, a.Channels)
+	}
+	if !root.HasFile(a.Icon) {
+		t.Errorf("icon %q not found from the catalog", a.Icon)
+	}
+	if b.Path != "pack-b" || b.Name != "pack-b" || b.Revision != 1 {
+		t.Errorf("pack-b = %+v, want the name of its directory", b)
+	}
+	if uri := a.URI("sftp://user@host/packs?key=deploy_key"); uri != "sftp://user@host/packs/pack-a?key=deploy_key" {
+		t.Errorf("uri = %s", uri)
+	}
+
+	// A new revision updates the entry of the pack
+	if err := PublishGameFolder(connectors.NewMemoryConnector(fsys, "packs/pack-b"), "pack-b"); err != nil {
+		t.Fatal(err)
+	}
+	if catalog, _ = ReadCatalog(root); len(catalog.Packs) != 2 || catalog.Packs[1].Revision != 2 {
+		t.Errorf("packs = %+v, want the revision 2 of pack-b", catalog.Packs)
+	}
+}
+
+func TestPublishWithoutCatalog(t *testing.T) {
+	chdir(t, t.TempDir())
+	fsys := connectors.NewMemFS()
+	writeCatalogPack(t, "my-pack", Manifest{}, map[string]string{"minecraft.jar": "a"})
+
+	connector := connectors.NewMemoryConnector(fsys, "packs/my-pack")
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{Catalog: NO_CATALOG}); err != nil {
+		t.Fatal(err)
+	}
+	if !connector.HasFile(shared.MANIFEST_FILE) || connector.HasFile("../"+shared.CATALOG_FILE) {
+		t.Error("catalog written with NO_CATALOG")
+	}
+
+	// The catalog is a file of the pack or of a parent directory
+	other := connectors.NewMemoryConnector(fsys, "packs/other")
+	if err := PublishGameFolder(other, "my-pack", PublishOptions{Catalog: "catalogs/index.json"}); err == nil || !strings.Contains(err.Error(), "invalid catalog path") {
+		t.Errorf("err = %v, want an invalid catalog path", err)
+	}
+	if other.HasFile(shared.MANIFEST_FILE) {
+		t.Error("published with an invalid catalog path")
+	}
+}
@@ -0,0 +1,162 @@
+package folder
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+// DEFAULT_CHANNEL is the channel of manifest.json, its files are the ones at their path on the remote
+// The files of the other channels which differ from it are stored in shared.ARCHIVE_DIR
+const DEFAULT_CHANNEL = "stable"
+
+var ErrUnknownChannel = errors.New("unknown channel")
+
+var channelRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Channels maps each release channel of the pack to its revision, see shared.CHANNELS_FILE
+type Channels map[string]int
+
+// ValidateChannel checks the name of a channel: lowercase letters, digits, ".", "_" and "-"
+func ValidateChannel(channel string) error {
+	if !channelRegex.MatchString(channel) {
+		return fmt.Errorf("invalid channel name %q", channel)
+	}
+	return nil
+}
+
+/**
+* Read the channels of the pack published on the connector, a pack published without channels only has the
+* default one. Like the manifests, the channels are verified with their signature when a signing key is trusted
+* Example:
+* ```
+* channels, err := folder.ReadChannels(connector)
+* fmt.Println(channels["beta"]) // 14
+* ```
+ */
+func ReadChannels(connector connectors.Connector) (Channels, error) {
+	return readChannels(connector, true)
+}
+
+// readChannels reads the channels, verified with their signature if verify is set
+func readChannels(connector connectors.Connector, verify bool) (Channels, error) {
+	channels := Channels{}
+	var data []byte
+	var err error
+	if verify {
+		data, err = readManifest(connector, shared.CHANNELS_FILE, shared.CHANNELS_SIGNATURE_FILE)
+	} else {
+		data, err = connector.ReadFileBytes(shared.CHANNELS_FILE, -1)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &channels)
+	}
+	if err != nil {
+		if connector.HasFile(shared.CHANNELS_FILE) {
+			return nil, fmt.Errorf("failed to read the channels: %w", err)
+		}
+		var manifest Manifest
+		if err := connector.ReadFile(shared.MANIFEST_FILE, &manifest); err != nil {
+			return nil, err
+		}
+		channels[DEFAULT_CHANNEL] = manifest.Revision
+	}
+	return channels, nil
+}
+
+// channelRevision returns the revision of the channel, 0 (the latest manifest) for the default channel
+func channelRevision(connector connectors.Connector, channel string) (int, error) {
+	if channel == "" || channel == DEFAULT_CHANNEL {
+		return 0, nil
+	}
+	channels, err := ReadChannels(connector)
+	if err != nil {
+		return 0, err
+	}
+	revision, ok := channels[channel]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownChannel, channel)
+	}
+	return revision, nil
+}
+
+// publishChannel points the channel to the revision in the channels of the pack, signed with the key of the manifest
+// Without signature, an attacker could point a channel to an older (signed) revision
+func publishChannel(connector connectors.Connector, channel string, revision int, signingKey ed25519.PrivateKey) error {
+	// The publisher doesn't need to trust its key, the channels are verified by the launchers
+	channels, err := readChannels(connector, false)
+	if err != nil {
+		if connector.HasFile(shared.CHANNELS_FILE) {
+			// The other channels would be lost
+			return err
+		}
+		channels = Channels{}
+	}
+	channels[channel] = revision
+	data, err := json.MarshalIndent(channels, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := connector.SendFileFromBytes(shared.CHANNELS_FILE, data); err != nil {
+		return err
+	}
+
+	if signingKey != nil {
+		return connector.SendFileFromBytes(shared.CHANNELS_SIGNATURE_FILE, SignManifest(data, signingKey))
+	}
+	if connector.HasFile(shared.CHANNELS_SIGNATURE_FILE) {
+		// The signature of the previous channels would reject the new ones
+		return connector.Delete(shared.CHANNELS_SIGNATURE_FILE)
+	}
+	return nil
+}
+
+/**
+* Init the game folder with the latest revision of a release channel of the pack (e.g. beta), see PublishOptions.Channel
+* Example:
+* ```
+* gameFolder, err := folder.InitGameFolderChannel(connector, "my-pack", "beta")
+* ```
+ */
+func InitGameFolderChannel(connector connectors.Connector, folderName string, channel string, testPackModeArgs ...bool) (*GameFolder, error) {
+	revision, err := channelRevision(connector, channel)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Failed to read channel %s: %w", channel, err)
+	}
+	gameFolder, err := InitGameFolderAt(connector, folderName, revision, testPackModeArgs...)
+	if err != nil {
+		return nil, err
+	}
+	gameFolder.Channel = channel
+	return gameFolder, nil
+}
+
+/**
+* Switch the game folder to the latest revision of another channel, the next Build only downloads the files whose
+* checksum differs from the local ones
+* Example:
+* ```
+* if err := gameFolder.SwitchChannel("beta"); err != nil {
+*     return err
+* }
+* err := gameFolder.Build(false, progressCallback)
+* ```
+ */
+func (g *GameFolder) SwitchChannel(channel string) error {
+	revision, err := channelRevision(g.Connector, channel)
+	if err != nil {
+		return fmt.Errorf("failed to read channel %s: %w", channel, err)
+	}
+	manifest, err := loadManifest(g.Connector, revision)
+	if err != nil {
+		return err
+	}
+	g.Manifest = manifest
+	g.Channel = channel
+	return nil
+}
@@ -0,0 +1,117 @@
+package folder
+
+import (
+	"errors"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+// publishBeta publishes the stable channel, then a beta changing mods/a.jar and adding mods/b.jar
+func publishBeta(t *testing.T) (string, *createRecorder) {
+	t.Helper()
+	dir := newLocalPack(t, map[string]string{"minecraft.jar": "v1", "mods/a.jar": "a"})
+	connector := &createRecorder{MemoryConnector: connectors.NewMemoryConnector(connectors.NewMemFS(), "")}
+	if err := PublishGameFolder(connector, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+
+	writePackFile(t, dir, "mods/a.jar", "a-beta")
+	writePackFile(t, dir, "mods/b.jar", "b")
+	connector.created = nil
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{Channel: "beta"}); err != nil {
+		t.Fatal(err)
+	}
+	return dir, connector
+}
+
+func TestPublishChannel(t *testing.T) {
+	_, connector := publishBeta(t)
+
+	// The stable channel is untouched, the beta files are only in the archive
+	if uploaded := withoutArchive(connector.created); len(uploaded) != 0 || len(connector.created) != 2 {
+		t.Errorf("uploaded = %v, want the 2 changed files in the archive", connector.created)
+	}
+	var manifest Manifest
+	connector.ReadFile(shared.MANIFEST_FILE, &manifest)
+	if manifest.Revision != 1 || manifest.Channel != DEFAULT_CHANNEL {
+		t.Errorf("manifest.json = revision %d of %q, want the stable revision 1", manifest.Revision, manifest.Channel)
+	}
+	if data, _ := connector.ReadFileBytes("mods/a.jar", -1); string(data) != "a" || connector.HasFile("mods/b.jar") {
+		t.Error("the beta replaced the stable files")
+	}
+
+	channels, err := ReadChannels(connector)
+	if err != nil || !maps.Equal(channels, Channels{"stable": 1, "beta": 2}) {
+		t.Errorf("channels = %v, %v, want stable 1 and beta 2", channels, err)
+	}
+	if _, err := InitGameFolderChannel(connector, "game", "dev", true); !errors.Is(err, ErrUnknownChannel) {
+		t.Errorf("err = %v, want ErrUnknownChannel", err)
+	}
+}
+
+func TestPublishChannelNeedsDefaultChannel(t *testing.T) {
+	newLocalPack(t, map[string]string{"minecraft.jar": "v1"})
+	connector := connectors.NewMemoryConnector(connectors.NewMemFS(), "")
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{Channel: "beta"}); err == nil {
+		t.Error("beta published without a stable channel")
+	}
+	if connector.HasFile(shared.CHANNELS_FILE) || connector.HasFile(revisionPath(1)) {
+		t.Error("beta published without a stable channel")
+	}
+}
+
+func TestSwitchChannel(t *testing.T) {
+	dir, published := publishBeta(t)
+	connector := &openRecorder{MemoryConnector: published.MemoryConnector}
+
+	gameFolder, err := InitGameFolderChannel(connector, "game", DEFAULT_CHANNEL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the files which differ from the stable ones are downloaded
+	connector.opened = nil
+	if err := gameFolder.SwitchChannel("beta"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if len(connector.opened) != 2 {
+		t.Errorf("downloaded %v, want mods/a.jar and mods/b.jar", connector.opened)
+	}
+	for path, content := range map[string]string{"minecraft.jar": "v1", "mods/a.jar": "a-beta", "mods/b.jar": "b"} {
+		if got := readFile(t, filepath.Join(gameFolder.Path, path)); got != content {
+			t.Errorf("%s = %q, want %q", path, got, content)
+		}
+	}
+
+	// A new stable revision doesn't change the files of the beta
+	writePackFile(t, dir, "minecraft.jar", "v2")
+	if err := PublishGameFolder(published, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gameFolder.SwitchChannel("beta"); err != nil {
+		t.Fatal(err)
+	}
+	if gameFolder.Manifest.Revision != 2 {
+		t.Errorf("revision = %d, want the beta revision 2", gameFolder.Manifest.Revision)
+	}
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "minecraft.jar")); got != "v1" {
+		t.Errorf("minecraft.jar = %q, want the beta version", got)
+	}
+	if got := listFiles(t, gameFolder.Path); !slices.Equal(got, []string{"minecraft.jar", "mods/a.jar", "mods/b.jar"}) {
+		t.Errorf("files = %v", got)
+	}
+}
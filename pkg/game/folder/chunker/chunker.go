@@ -0,0 +1,95 @@
+package chunker
+
+import (
+	"io"
+)
+
+// The chunks are cut where the content matches, so an insertion in a file only changes the chunks around it
+const (
+	MinSize = 16 * 1024  // No cut before MinSize bytes, except for the last chunk
+	AvgSize = 64 * 1024  // Expected size of the chunks
+	MaxSize = 256 * 1024 // The chunk is cut at MaxSize when no cut point is found
+)
+
+// Cut points: the masks are on the high bits, which depend on the last 64 bytes of the gear hash
+// The harder mask before AvgSize and the easier one after it keep the sizes close to AvgSize (normalized chunking)
+const (
+	maskSmall uint64 = (1<<18 - 1) << (64 - 18)
+	maskLarge uint64 = (1<<14 - 1) << (64 - 14)
+)
+
+// gear maps each byte to a random value, it must never change or the chunks of the published packs would not match
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0x6c61756e63687967) // "launchyg"
+	for i := range table {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+/**
+* Split the content of r in content-defined chunks (FastCDC), the same content always gives the same chunks
+* The chunk passed to fn is only valid during the call, copy it to keep it
+* Example:
+* ```
+* err := chunker.Split(f, func(chunk []byte) error {
+*     fmt.Println(len(chunk), utils.BytesSHA1(chunk))
+*     return nil
+* })
+* ```
+ */
+func Split(r io.Reader, fn func(chunk []byte) error) error {
+	buf := make([]byte, MaxSize)
+	n := 0 // Bytes read in buf
+	eof := false
+	for {
+		for !eof && n < len(buf) {
+			read, err := r.Read(buf[n:])
+			n += read
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+
+		size := cut(buf[:n])
+		if err := fn(buf[:size]); err != nil {
+			return err
+		}
+		n = copy(buf, buf[size:n])
+	}
+}
+
+// cut returns the size of the next chunk of data
+func cut(data []byte) int {
+	n := len(data)
+	if n <= MinSize {
+		return n
+	}
+
+	var h uint64
+	i := MinSize
+	for normal := min(AvgSize, n); i < normal; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,71 @@
+package chunker
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"math/rand"
+	"testing"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// split returns the sha1 of the chunks and checks that they rebuild the data
+func split(t *testing.T, data []byte) [][sha1.Size]byte {
+	t.Helper()
+	var rebuilt bytes.Buffer
+	sums := [][sha1.Size]byte{}
+	err := Split(bytes.NewReader(data), func(chunk []byte) error {
+		rebuilt.Write(chunk)
+		sums = append(sums, sha1.Sum(chunk))
+		if len(chunk) > MaxSize {
+			t.Errorf("chunk of %d bytes, max %d", len(chunk), MaxSize)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rebuilt.Bytes(), data) {
+		t.Fatal("the chunks don't rebuild the data")
+	}
+	return sums
+}
+
+func TestSplit(t *testing.T) {
+	data := randomBytes(1, 4*1024*1024)
+	sums := split(t, data)
+
+	// Around AvgSize on average
+	if avg := len(data) / len(sums); avg < AvgSize/2 || avg > AvgSize*2 {
+		t.Errorf("average chunk size %d, want about %d", avg, AvgSize)
+	}
+
+	// Bytes inserted in the middle only change the chunks around them
+	changed := append(append(append([]byte{}, data[:2*1024*1024]...), []byte("inserted")...), data[2*1024*1024:]...)
+	known := map[[sha1.Size]byte]bool{}
+	for _, sum := range sums {
+		known[sum] = true
+	}
+	newChunks := 0
+	for _, sum := range split(t, changed) {
+		if !known[sum] {
+			newChunks++
+		}
+	}
+	if newChunks > 2 {
+		t.Errorf("%d new chunks after an insertion, want at most 2", newChunks)
+	}
+
+	split(t, nil)
+	if sums := split(t, []byte("small")); len(sums) != 1 {
+		t.Errorf("%d chunks for a small file, want 1", len(sums))
+	}
+	// Content without cut point
+	if sums := split(t, make([]byte, 3*MaxSize)); len(sums) != 3 {
+		t.Errorf("%d chunks for zeros, want 3 chunks of MaxSize", len(sums))
+	}
+}
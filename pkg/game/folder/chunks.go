@@ -0,0 +1,235 @@
+package folder
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/chunker"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+// chunkPath returns the path of the chunk on the connector, relative to the pack
+func chunkPath(store string, sha string) (string, error) {
+	if len(sha) != sha1.Size*2 {
+		return "", fmt.Errorf("invalid chunk checksum %q", sha)
+	}
+	if store == "" {
+		store = shared.CHUNKS_DIR
+	}
+	return path.Join(store, sha[:2], sha), nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// Publish
+/////////////////////////////////////////////////////////////////////
+
+// publishChunks sends the chunks of the local file missing from the store and returns them with the sha1 of the file
+// known holds the chunks already in the store, it is updated with the sent chunks
+func publishChunks(connector connectors.Connector, store string, localPath string, known map[string]bool) ([]FileChunk, string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	chunks := []FileChunk{}
+	h := sha1.New()
+	err = chunker.Split(f, func(data []byte) error {
+		h.Write(data)
+		chunk := FileChunk{Sha: utils.BytesSHA1(data), Size: int64(len(data))}
+		chunks = append(chunks, chunk)
+		if known[chunk.Sha] {
+			return nil
+		}
+
+		remotePath, err := chunkPath(store, chunk.Sha)
+		if err != nil {
+			return err
+		}
+		// The chunks are named by their checksum, a chunk on the remote has the right content
+		if !connector.HasFile(remotePath) {
+			if err := connector.SendFileFromBytes(remotePath, data); err != nil {
+				return err
+			}
+		}
+		known[chunk.Sha] = true
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return chunks, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// Build
+/////////////////////////////////////////////////////////////////////
+
+// chunkSource is a chunk of a local file, its content is checked again when copied since the file can change
+type chunkSource struct {
+	path   string
+	offset int64
+	size   int64
+}
+
+// localChunks indexes the chunks of the local files, the chunks found locally are not downloaded
+type localChunks struct {
+	mu     sync.Mutex
+	chunks map[string]chunkSource // sha1 => source
+}
+
+func (l *localChunks) add(sha string, source chunkSource) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.chunks[sha]; !ok {
+		l.chunks[sha] = source
+	}
+}
+
+// indexFile adds the chunks of the local file
+func (l *localChunks) indexFile(localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset := int64(0)
+	return chunker.Split(f, func(data []byte) error {
+		l.add(utils.BytesSHA1(data), chunkSource{path: localPath, offset: offset, size: int64(len(data))})
+		offset += int64(len(data))
+		return nil
+	})
+}
+
+// read returns the content of the chunk from a local file, nil if it isn't available
+func (l *localChunks) read(chunk FileChunk) []byte {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	source, ok := l.chunks[chunk.Sha]
+	l.mu.Unlock()
+	if !ok || source.size != chunk.Size {
+		return nil
+	}
+
+	f, err := os.Open(source.path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	data := make([]byte, source.size)
+	if _, err := f.ReadAt(data, source.offset); err != nil || utils.BytesSHA1(data) != chunk.Sha {
+		return nil
+	}
+	return data
+}
+
+// indexLocalChunks indexes the local files which will be replaced or removed by the build, their chunks are reused
+// by the chunked files to download. It returns nil when no file to download is chunked
+func (g *GameFolder) indexLocalChunks(filesToDownload []FolderFile, allowedFiles map[string]bool) *localChunks {
+	chunked := false
+	outdated := make(map[string]bool, len(filesToDownload))
+	for _, file := range filesToDownload {
+		chunked = chunked || len(file.Chunks) > 0
+		outdated[filepath.Join(g.Path, file.Path)] = true
+	}
+	if !chunked {
+		return nil
+	}
+
+	// The up to date and the kept files (saves, logs...) are not read
+	index := &localChunks{chunks: map[string]chunkSource{}}
+	filepath.WalkDir(g.Path, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.IsDir() && g.isState(path) {
+			return filepath.SkipDir
+		}
+		if err == nil && !d.IsDir() && (outdated[path] || (!allowedFiles[path] && !g.isKept(path))) {
+			index.indexFile(path)
+		}
+		return nil
+	})
+	return index
+}
+
+// downloadChunks rebuilds the chunked file from the local chunks and downloads the missing ones
+// The file is written in the .part file, then checked like a download
+func (g *GameFolder) downloadChunks(file FolderFile, destPath string, tmpPath string, mode fs.FileMode, limiter *utils.RateLimiter) error {
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", file.Path, err)
+	}
+
+	h := sha1.New()
+	w := io.MultiWriter(out, h)
+	for _, chunk := range file.Chunks {
+		data := g.chunks.read(chunk)
+		if data == nil {
+			if data, err = g.fetchChunk(chunk, limiter); err != nil {
+				break
+			}
+		}
+		if _, err = w.Write(data); err != nil {
+			break
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && file.Sha != "" && hex.EncodeToString(h.Sum(nil)) != file.Sha {
+		err = fmt.Errorf("checksum mismatch for %s", file.Path)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, destPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file %s: %w", file.Path, err)
+	}
+
+	// The next files can copy the chunks of this one
+	if g.chunks != nil {
+		offset := int64(0)
+		for _, chunk := range file.Chunks {
+			g.chunks.add(chunk.Sha, chunkSource{path: destPath, offset: offset, size: chunk.Size})
+			offset += chunk.Size
+		}
+	}
+	return nil
+}
+
+// fetchChunk downloads the chunk from the chunk store and checks its content
+func (g *GameFolder) fetchChunk(chunk FileChunk, limiter *utils.RateLimiter) ([]byte, error) {
+	remotePath, err := chunkPath(g.Manifest.ChunkStore, chunk.Sha)
+	if err != nil {
+		return nil, err
+	}
+	rc, _, err := g.Connector.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", remotePath, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(limiter.Reader(rc), chunk.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", remotePath, err)
+	}
+	if utils.BytesSHA1(data) != chunk.Sha {
+		// With mirrors, the next attempt downloads the chunk from another source
+		if failover, ok := connectors.As[connectors.FailoverConnector](g.Connector); ok {
+			failover.ReportBadFile(remotePath)
+		}
+		return nil, fmt.Errorf("checksum mismatch for chunk %s", remotePath)
+	}
+	return data, nil
+}
@@ -0,0 +1,134 @@
+package folder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+// publishChunked writes the pack in ./packs/<packName> and publishes it with chunks in ../.chunks
+func publishChunked(t *testing.T, fsys *connectors.MemFS, packName string, files map[string]string) (*connectors.MemoryConnector, Manifest) {
+	t.Helper()
+	dir := filepath.Join("packs", packName)
+	os.RemoveAll(dir)
+	for path, content := range files {
+		writePackFile(t, dir, path, content)
+	}
+	data, _ := json.Marshal(Manifest{Version: "1.0.0", McVersion: "1.20.1", MainClass: shared.MainClass})
+	writePackFile(t, dir, shared.MANIFEST_FILE, string(data))
+
+	connector := connectors.NewMemoryConnector(fsys, "packs/"+packName)
+	if err := PublishGameFolder(connector, packName, PublishOptions{Chunks: true, ChunkStore: "../.chunks"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest Manifest
+	if err := connector.ReadFile(shared.MANIFEST_FILE, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	return connector, manifest
+}
+
+// storedChunks returns the paths of the chunks of the store
+func storedChunks(fsys *connectors.MemFS) []string {
+	chunks := []string{}
+	connectors.NewMemoryConnector(fsys, "packs").Walk(".chunks", func(remotePath string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			chunks = append(chunks, remotePath)
+		}
+		return err
+	})
+	return chunks
+}
+
+func TestPublishChunks(t *testing.T) {
+	chdir(t, t.TempDir())
+	common := randomContent(1, 512*1024)
+
+	fsys := connectors.NewMemFS()
+	connector, manifest := publishChunked(t, fsys, "pack-a", map[string]string{"mods/big.jar": common, "options.txt": "a"})
+	file := findFile(manifest, "mods/big.jar")
+	if manifest.ChunkStore != "../.chunks" || len(file.Chunks) < 2 {
+		t.Fatalf("manifest = %+v, want the chunks of mods/big.jar", manifest)
+	}
+	size := int64(0)
+	for _, chunk := range file.Chunks {
+		size += chunk.Size
+	}
+	if size != file.Size {
+		t.Errorf("chunks size = %d, want %d", size, file.Size)
+	}
+	// The chunked files are only in the chunk store
+	if connector.HasFile("mods/big.jar") {
+		t.Error("mods/big.jar stored as a whole file")
+	}
+	stored := len(storedChunks(fsys))
+
+	// A variant of the pack only stores its own chunks
+	_, variant := publishChunked(t, fsys, "pack-b", map[string]string{"mods/big.jar": common, "mods/other.jar": "other"})
+	if added := len(storedChunks(fsys)) - stored; added != 1 {
+		t.Errorf("%d chunks added by the variant, want 1", added)
+	}
+	if len(findFile(variant, "mods/big.jar").Chunks) != len(file.Chunks) {
+		t.Error("the variant doesn't reuse the chunks")
+	}
+}
+
+func TestBuildChunksReusesLocalChunks(t *testing.T) {
+	chdir(t, t.TempDir())
+	v1 := randomContent(1, 1024*1024)
+	v2 := v1[:500000] + "new entry" + v1[500000:]
+
+	fsys := connectors.NewMemFS()
+	_, manifest := publishChunked(t, fsys, "my-pack", map[string]string{"mods/foo-1.0.jar": v1})
+	connector := &openRecorder{MemoryConnector: connectors.NewMemoryConnector(fsys, "packs/my-pack")}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "mods", "foo-1.0.jar")); got != v1 {
+		t.Fatal("rebuilt file differs from the published one")
+	}
+	if len(connector.opened) != len(findFile(manifest, "mods/foo-1.0.jar").Chunks) {
+		t.Errorf("%d files downloaded, want the chunks", len(connector.opened))
+	}
+
+	// The new version of the mod only downloads the chunks missing from the previous one
+	_, manifest = publishChunked(t, fsys, "my-pack", map[string]string{"mods/foo-1.1.jar": v2})
+	connector.opened = nil
+	gameFolder.Manifest = manifest
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "mods", "foo-1.1.jar")); got != v2 {
+		t.Fatal("rebuilt file differs from the published one")
+	}
+	if len(connector.opened) > 2 {
+		t.Errorf("downloaded %v, want at most the 2 changed chunks", connector.opened)
+	}
+	if got := listFiles(t, gameFolder.Path); len(got) != 1 || got[0] != "mods/foo-1.1.jar" {
+		t.Errorf("files = %v, want only the new version", got)
+	}
+}
+
+func TestBuildChunksChecksumMismatch(t *testing.T) {
+	chdir(t, t.TempDir())
+	fsys := connectors.NewMemFS()
+	connector, manifest := publishChunked(t, fsys, "my-pack", map[string]string{"mods/foo.jar": randomContent(1, 100*1024)})
+
+	for _, path := range storedChunks(fsys) {
+		connectors.NewMemoryConnector(fsys, "packs").SendFileFromBytes(path, []byte("corrupted"))
+	}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	if err := gameFolder.Build(false, noProgress); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("err = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(gameFolder.Path, "mods", "foo.jar")); !os.IsNotExist(err) {
+		t.Error("corrupted file written in the game folder")
+	}
+}
@@ -0,0 +1,199 @@
+package folder
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"limeal.fr/launchygo/pkg/connectors"
+)
+
+// Compression is the format of a file stored compressed on the remote, see FolderFile.Compression
+type Compression string
+
+const (
+	COMPRESSION_NONE Compression = ""
+	COMPRESSION_GZIP Compression = "gzip"
+	COMPRESSION_ZSTD Compression = "zstd" // Needs a codec, see RegisterCompression
+)
+
+// maxCompressionRatio is the max size of a compressed file compared to the original one, above it
+// (jars, ogg, png...) the file is stored as is
+const maxCompressionRatio = 0.9
+
+// Codec compresses and decompresses the files of a Compression
+type Codec struct {
+	Extension string // Added to the path of the compressed files on the remote, e.g. ".gz"
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[Compression]Codec{}
+)
+
+func init() {
+	RegisterCompression(COMPRESSION_GZIP, Codec{
+		Extension: ".gz",
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, gzip.BestCompression) },
+	})
+}
+
+/**
+* Register the codec of a compression, both the publisher and the launcher need it
+* zstd has no built-in codec, register one from a zstd library to use it
+* Example:
+* ```
+* folder.RegisterCompression(folder.COMPRESSION_ZSTD, folder.Codec{
+*     Extension: ".zst",
+*     NewReader: func(r io.Reader) (io.ReadCloser, error) {
+*         d, err := zstd.NewReader(r)
+*         if err != nil {
+*             return nil, err
+*         }
+*         return d.IOReadCloser(), nil
+*     },
+*     NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+* })
+* ```
+ */
+func RegisterCompression(compression Compression, codec Codec) {
+	if compression == COMPRESSION_NONE || codec.NewReader == nil || codec.NewWriter == nil || codec.Extension == "" {
+		panic("folder: invalid codec for compression " + string(compression))
+	}
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	codecs[compression] = codec
+}
+
+// RegisteredCompressions returns the compressions with a codec, sorted
+func RegisteredCompressions() []Compression {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	compressions := make([]Compression, 0, len(codecs))
+	for compression := range codecs {
+		compressions = append(compressions, compression)
+	}
+	sort.Slice(compressions, func(i, j int) bool { return compressions[i] < compressions[j] })
+	return compressions
+}
+
+func (c Compression) codec() (Codec, error) {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	codec, ok := codecs[c]
+	if !ok {
+		return Codec{}, fmt.Errorf("unsupported compression %q", c)
+	}
+	return codec, nil
+}
+
+// extension returns the extension of the compression of the file on the remote, e.g. .gz
+func (f FolderFile) extension() string {
+	if f.Compression == COMPRESSION_NONE {
+		return ""
+	}
+	codec, err := f.Compression.codec()
+	if err != nil {
+		return ""
+	}
+	return codec.Extension
+}
+
+// remotePath returns the path of the file on the remote, with the extension of its compression
+func (f FolderFile) remotePath() string {
+	if f.archived {
+		return f.archivePath()
+	}
+	return f.Path + f.extension()
+}
+
+// decompress returns the uncompressed content of r, closing it doesn't close r
+func (f FolderFile) decompress(r io.Reader) (io.ReadCloser, error) {
+	if f.Compression == COMPRESSION_NONE {
+		return io.NopCloser(r), nil
+	}
+	codec, err := f.Compression.codec()
+	if err != nil {
+		return nil, err
+	}
+	return codec.NewReader(r)
+}
+
+// decompressedReader closes both the decompressor and the remote file
+type decompressedReader struct {
+	io.ReadCloser
+	remote io.Closer
+}
+
+func (r *decompressedReader) Close() error {
+	err := r.ReadCloser.Close()
+	if remoteErr := r.remote.Close(); err == nil {
+		err = remoteErr
+	}
+	return err
+}
+
+// openFolderFile opens the remote file and returns its uncompressed content
+func openFolderFile(connector connectors.Connector, file FolderFile) (io.ReadCloser, error) {
+	rc, _, err := connector.Open(file.remotePath())
+	if err != nil {
+		return nil, err
+	}
+	reader, err := file.decompress(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &decompressedReader{ReadCloser: reader, remote: rc}, nil
+}
+
+// compressFile compresses the local file in a temporary file, the caller removes it
+// It returns an empty path when the compression doesn't save enough space
+func compressFile(localPath string, compression Compression) (string, int64, error) {
+	codec, err := compression.codec()
+	if err != nil {
+		return "", 0, err
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	stats, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	tmp, err := os.CreateTemp("", "launchygo-compressed-*")
+	if err != nil {
+		return "", 0, err
+	}
+	w, err := codec.NewWriter(tmp)
+	if err == nil {
+		_, err = io.Copy(w, f)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	var size int64
+	if err == nil {
+		var compressed os.FileInfo
+		if compressed, err = os.Stat(tmp.Name()); err == nil {
+			size = compressed.Size()
+		}
+	}
+	if err != nil || float64(size) > float64(stats.Size())*maxCompressionRatio {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return tmp.Name(), size, nil
+}
@@ -0,0 +1,113 @@
+package folder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+func TestPublishCompressed(t *testing.T) {
+	text := strings.Repeat("key=value\n", 1000)
+	random := randomContent(1, 10*1024)
+	newLocalPack(t, map[string]string{"config/big.cfg": text, "mods/random.jar": random})
+
+	connector := &createRecorder{MemoryConnector: connectors.NewMemoryConnector(connectors.NewMemFS(), "")}
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{Compression: COMPRESSION_GZIP}); err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest Manifest
+	connector.ReadFile(shared.MANIFEST_FILE, &manifest)
+	config := findFile(manifest, "config/big.cfg")
+	if config.Compression != COMPRESSION_GZIP || config.CompressedSize == 0 || config.CompressedSize >= config.Size {
+		t.Errorf("config/big.cfg = %+v, want gzip compressed", config)
+	}
+	// Incompressible files are stored as is
+	if jar := findFile(manifest, "mods/random.jar"); jar.Compression != COMPRESSION_NONE {
+		t.Errorf("mods/random.jar = %+v, want not compressed", jar)
+	}
+
+	data, err := connector.ReadFileBytes("config/big.cfg.gz", -1)
+	if err != nil || int64(len(data)) != config.CompressedSize {
+		t.Fatalf("config/big.cfg.gz = %d bytes, %v", len(data), err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := io.ReadAll(zr); string(content) != text {
+		t.Error("the compressed file differs from the local one")
+	}
+
+	// The unchanged files are not sent again, a publish without compression keeps the compressed files
+	connector.created = nil
+	if err := PublishGameFolder(connector, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+	if len(connector.created) != 0 {
+		t.Errorf("uploaded = %v, want nothing", connector.created)
+	}
+	connector.ReadFile(shared.MANIFEST_FILE, &manifest)
+	if findFile(manifest, "config/big.cfg").Compression != COMPRESSION_GZIP {
+		t.Error("the compression of the unchanged file is lost")
+	}
+
+	// The changed file is sent as is and its compressed version pruned
+	writePackFile(t, filepath.Join("packs", "my-pack"), "config/big.cfg", text+"other=1\n")
+	if err := PublishGameFolder(connector, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(withoutArchive(connector.created), []string{"config/big.cfg"}) || connector.HasFile("config/big.cfg.gz") {
+		t.Errorf("uploaded = %v, want config/big.cfg and the .gz file pruned", connector.created)
+	}
+}
+
+func TestBuildDecompresses(t *testing.T) {
+	text := strings.Repeat("key=value\n", 1000)
+	newLocalPack(t, map[string]string{"config/big.cfg": text})
+
+	fsys := connectors.NewMemFS()
+	if err := PublishGameFolder(connectors.NewMemoryConnector(fsys, ""), "my-pack", PublishOptions{Compression: COMPRESSION_GZIP}); err != nil {
+		t.Fatal(err)
+	}
+
+	connector := connectors.NewMemoryConnector(fsys, "")
+	var manifest Manifest
+	connector.ReadFile(shared.MANIFEST_FILE, &manifest)
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "config", "big.cfg")); got != text {
+		t.Error("the downloaded file is not decompressed")
+	}
+
+	// The checksum is the one of the uncompressed content
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(strings.Repeat("other=1\n", 1000)))
+	zw.Close()
+	connector.SendFileFromBytes("config/big.cfg.gz", compressed.Bytes())
+	gameFolder = newTestGameFolder(t, connector, manifest)
+	if err := gameFolder.Build(false, noProgress); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("err = %v, want a checksum mismatch", err)
+	}
+}
+
+func TestPublishUnknownCompression(t *testing.T) {
+	newLocalPack(t, map[string]string{"config/big.cfg": "a=b"})
+	connector := connectors.NewMemoryConnector(connectors.NewMemFS(), "")
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{Compression: COMPRESSION_ZSTD}); err == nil || !strings.Contains(err.Error(), "zstd") {
+		t.Errorf("err = %v, want an unsupported compression", err)
+	}
+	if connector.HasFile(shared.MANIFEST_FILE) {
+		t.Error("pack published without a zstd codec")
+	}
+}
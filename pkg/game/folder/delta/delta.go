@@ -0,0 +1,271 @@
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// magic starts every patch, the version is part of it
+const magic = "LGDELTA1"
+
+// BlockSize is the size of the blocks of the base file looked up in the new file
+// Smaller blocks find more matches but make the index bigger
+const BlockSize = 2048
+
+const (
+	opCopy   = 'C' // offset, length: copy bytes of the base file
+	opInsert = 'I' // length, data: bytes which are not in the base file
+	opEnd    = 'E'
+)
+
+// ErrInvalidPatch is returned when the patch is corrupted or not a patch
+var ErrInvalidPatch = errors.New("invalid patch")
+
+/////////////////////////////////////////////////////////////////////
+// Diff
+/////////////////////////////////////////////////////////////////////
+
+type block struct {
+	offset int64
+	strong uint64
+}
+
+/**
+* Compute the patch turning base into target, like rsync the blocks of base are found at any offset of target
+* so inserted or removed data (e.g. an updated entry of a jar) only costs the changed bytes
+* The patch is deflate compressed
+* Example:
+* ```
+* patch, err := delta.Diff(oldFile, oldSize, newContent)
+* ```
+ */
+func Diff(base io.ReaderAt, baseSize int64, target []byte) ([]byte, error) {
+	index, err := indexBlocks(base, baseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(target))))
+
+	zw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w := &opWriter{w: bufio.NewWriter(zw)}
+
+	pending := 0 // Start of the data not matched yet
+	pos := 0
+	var weak rollingHash
+	if len(target) >= BlockSize {
+		weak.init(target[:BlockSize])
+	}
+	for pos+BlockSize <= len(target) {
+		if offset, ok := index.match(weak.sum(), target[pos:pos+BlockSize]); ok {
+			w.insert(target[pending:pos])
+			w.copy(offset, BlockSize)
+			pos += BlockSize
+			pending = pos
+			if pos+BlockSize <= len(target) {
+				weak.init(target[pos : pos+BlockSize])
+			}
+			continue
+		}
+
+		if pos+BlockSize < len(target) {
+			weak.roll(target[pos], target[pos+BlockSize])
+		}
+		pos++
+	}
+	w.insert(target[pending:])
+	w.end()
+
+	if w.err != nil {
+		return nil, w.err
+	}
+	if err := w.w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type blockIndex map[uint32][]block
+
+func indexBlocks(base io.ReaderAt, baseSize int64) (blockIndex, error) {
+	index := blockIndex{}
+	data := make([]byte, BlockSize)
+	for offset := int64(0); offset+BlockSize <= baseSize; offset += BlockSize {
+		if _, err := base.ReadAt(data, offset); err != nil {
+			return nil, fmt.Errorf("failed to read the base file: %w", err)
+		}
+		var weak rollingHash
+		weak.init(data)
+		index[weak.sum()] = append(index[weak.sum()], block{offset: offset, strong: strongHash(data)})
+	}
+	return index, nil
+}
+
+// match returns the offset of a block of the base file with the same content, checked with the strong hash
+func (index blockIndex) match(weak uint32, data []byte) (int64, bool) {
+	candidates, ok := index[weak]
+	if !ok {
+		return 0, false
+	}
+	strong := strongHash(data)
+	for _, candidate := range candidates {
+		if candidate.strong == strong {
+			return candidate.offset, true
+		}
+	}
+	return 0, false
+}
+
+func strongHash(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// rollingHash is the adler-32 like checksum of rsync, updated in constant time when the window moves by one byte
+type rollingHash struct {
+	a, b uint32
+	n    uint32
+}
+
+func (h *rollingHash) init(data []byte) {
+	h.a, h.b, h.n = 0, 0, uint32(len(data))
+	for i, c := range data {
+		h.a += uint32(c)
+		h.b += uint32(len(data)-i) * uint32(c)
+	}
+}
+
+func (h *rollingHash) roll(out byte, in byte) {
+	h.a += uint32(in) - uint32(out)
+	h.b += h.a - h.n*uint32(out)
+}
+
+func (h *rollingHash) sum() uint32 {
+	return (h.a & 0xffff) | (h.b << 16)
+}
+
+// opWriter writes the operations, the contiguous copies are merged
+type opWriter struct {
+	w   *bufio.Writer
+	err error
+
+	copyOffset int64
+	copyLength int64
+}
+
+func (w *opWriter) write(data ...[]byte) {
+	for _, d := range data {
+		if w.err == nil {
+			_, w.err = w.w.Write(d)
+		}
+	}
+}
+
+func (w *opWriter) flushCopy() {
+	if w.copyLength == 0 {
+		return
+	}
+	op := []byte{opCopy}
+	op = binary.AppendUvarint(op, uint64(w.copyOffset))
+	op = binary.AppendUvarint(op, uint64(w.copyLength))
+	w.write(op)
+	w.copyLength = 0
+}
+
+func (w *opWriter) copy(offset int64, length int64) {
+	if w.copyLength > 0 && w.copyOffset+w.copyLength == offset {
+		w.copyLength += length
+		return
+	}
+	w.flushCopy()
+	w.copyOffset, w.copyLength = offset, length
+}
+
+func (w *opWriter) insert(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	w.flushCopy()
+	w.write(binary.AppendUvarint([]byte{opInsert}, uint64(len(data))), data)
+}
+
+func (w *opWriter) end() {
+	w.flushCopy()
+	w.write([]byte{opEnd})
+}
+
+/////////////////////////////////////////////////////////////////////
+// Apply
+/////////////////////////////////////////////////////////////////////
+
+/**
+* Apply a patch made by Diff to base and write the new file to w
+* The result must still be checked against the expected checksum, the patch doesn't know the base file
+* Example:
+* ```
+* err := delta.Apply(localFile, localSize, patchReader, partFile)
+* ```
+ */
+func Apply(base io.ReaderAt, baseSize int64, patch io.Reader, w io.Writer) (int64, error) {
+	r := bufio.NewReader(patch)
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != magic {
+		return 0, ErrInvalidPatch
+	}
+	targetSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, ErrInvalidPatch
+	}
+
+	zr := bufio.NewReader(flate.NewReader(r))
+	written := int64(0)
+	for {
+		op, err := zr.ReadByte()
+		if err != nil {
+			return written, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch op {
+		case opCopy:
+			offset, err1 := binary.ReadUvarint(zr)
+			length, err2 := binary.ReadUvarint(zr)
+			if err1 != nil || err2 != nil || offset+length > uint64(baseSize) {
+				return written, ErrInvalidPatch
+			}
+			n, err := io.Copy(w, io.NewSectionReader(base, int64(offset), int64(length)))
+			written += n
+			if err != nil {
+				return written, err
+			}
+		case opInsert:
+			length, err := binary.ReadUvarint(zr)
+			if err != nil || written+int64(length) > int64(targetSize) {
+				return written, ErrInvalidPatch
+			}
+			n, err := io.CopyN(w, zr, int64(length))
+			written += n
+			if err != nil {
+				return written, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+			}
+		case opEnd:
+			if written != int64(targetSize) {
+				return written, fmt.Errorf("%w: %d bytes written, want %d", ErrInvalidPatch, written, targetSize)
+			}
+			return written, nil
+		default:
+			return written, ErrInvalidPatch
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func roundTrip(t *testing.T, base []byte, target []byte) []byte {
+	t.Helper()
+	patch, err := Diff(bytes.NewReader(base), int64(len(base)), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	n, err := Apply(bytes.NewReader(base), int64(len(base)), bytes.NewReader(patch), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(target)) || !bytes.Equal(out.Bytes(), target) {
+		t.Fatalf("patched file differs from the target (%d bytes, want %d)", n, len(target))
+	}
+	return patch
+}
+
+func TestDiffApply(t *testing.T) {
+	base := randomBytes(1, 256*1024)
+
+	// Bytes inserted, modified and removed in the middle of the file
+	target := append([]byte{}, base[:10000]...)
+	target = append(target, []byte("inserted data")...)
+	target = append(target, base[10000:50000]...)
+	target = append(target, randomBytes(2, 3000)...)
+	target = append(target, base[60000:]...)
+
+	patch := roundTrip(t, base, target)
+	if len(patch) > 16*1024 {
+		t.Errorf("patch is %d bytes, the unchanged blocks are not reused", len(patch))
+	}
+
+	// Unrelated, empty and smaller than a block
+	roundTrip(t, base, randomBytes(3, 100*1024))
+	roundTrip(t, base, nil)
+	roundTrip(t, nil, []byte("small"))
+	roundTrip(t, []byte("small"), []byte("smaller"))
+}
+
+func TestApplyInvalidPatch(t *testing.T) {
+	base := randomBytes(1, 8*1024)
+	target := append(append([]byte{}, base...), []byte("tail")...)
+	patch, err := Diff(bytes.NewReader(base), int64(len(base)), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"not a patch": []byte("hello world"),
+		"truncated":   patch[:len(patch)/2],
+		"empty":       nil,
+	} {
+		var out bytes.Buffer
+		if _, err := Apply(bytes.NewReader(base), int64(len(base)), bytes.NewReader(data), &out); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("%s: err = %v, want ErrInvalidPatch", name, err)
+		}
+	}
+
+	// A smaller base file than the one of the patch
+	var out bytes.Buffer
+	if _, err := Apply(bytes.NewReader(base[:1000]), 1000, bytes.NewReader(patch), &out); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("err = %v, want ErrInvalidPatch", err)
+	}
+}
@@ -1,8 +1,12 @@
 package folder
 
 import (
+	"crypto/ed25519"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
@@ -12,6 +16,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"limeal.fr/launchygo/pkg/connectors"
 	"limeal.fr/launchygo/pkg/game/authenticator"
@@ -26,6 +31,12 @@ type GameFolder struct {
 	Connector connectors.Connector
 
 	KeepFiles []string // Files to keep in the game folder, even if they are not in the manifest, must be dynamic
+
+	Scheduler DownloadScheduler // Concurrency, bandwidth and order of the downloads of Build
+
+	Channel string // Release channel of the manifest, empty for the latest or a pinned revision (see SwitchChannel)
+
+	chunks *localChunks // Chunks of the local files during Build
 }
 
 func GetGameFolderPathForFolder(folderName string) (string, error) {
@@ -41,30 +52,26 @@ func GetGameFolderPathForFolder(folderName string) (string, error) {
 }
 
 func InitGameFolder(connector connectors.Connector, folderName string, testPackModeArgs ...bool) (*GameFolder, error) {
-	testPackMode := false
-	if len(testPackModeArgs) > 0 {
-		testPackMode = testPackModeArgs[0]
-	}
+	return InitGameFolderAt(connector, folderName, 0, testPackModeArgs...)
+}
 
-	var path string
-	if testPackMode == false {
-		var err error
-		path, err = GetGameFolderPathForFolder(folderName)
-		if err != nil {
-			return nil, fmt.Errorf("❌ Failed to get game folder path: %w", err)
-		}
-	} else {
-		pwd, err := os.Getwd()
-		if err != nil {
-			return nil, fmt.Errorf("❌ Failed to get pwd: %w", err)
-		}
-		path = filepath.Join(pwd, "packs", folderName)
+/**
+* Init the game folder with a revision of the pack (see ListRevisions) instead of the latest one, to pin or downgrade it
+* The revision 0 is the latest one
+* Example:
+* ```
+* gameFolder, err := folder.InitGameFolderAt(connector, "my-pack", 12)
+* ```
+ */
+func InitGameFolderAt(connector connectors.Connector, folderName string, revision int, testPackModeArgs ...bool) (*GameFolder, error) {
+	path, err := gameFolderPath(folderName, testPackModeArgs...)
+	if err != nil {
+		return nil, err
 	}
 
-	var manifest Manifest
-	err := connector.ReadFile(shared.MANIFEST_FILE, &manifest)
+	manifest, err := loadManifest(connector, revision)
 	if err != nil {
-		return nil, fmt.Errorf("❌ Failed to read manifest at location %s: %w", shared.MANIFEST_FILE, err)
+		return nil, err
 	}
 
 	keepFiles := []string{"options.txt", "logs/*", "resourcepacks/*"}
@@ -77,6 +84,80 @@ func InitGameFolder(connector connectors.Connector, folderName string, testPackM
 	}, nil
 }
 
+/**
+* Open the game folder installed on this computer with its installed manifest, without reaching the pack server
+* e.g. to Rollback a broken update when the server is down. It has no connector, Build can't be used
+* Example:
+* ```
+* gameFolder, err := folder.OpenLocalGameFolder("my-pack")
+* if err == nil {
+*     err = gameFolder.Rollback()
+* }
+* ```
+ */
+func OpenLocalGameFolder(folderName string, testPackModeArgs ...bool) (*GameFolder, error) {
+	path, err := gameFolderPath(folderName, testPackModeArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	gameFolder := &GameFolder{
+		Path:      path,
+		KeepFiles: []string{"options.txt", "logs/*", "resourcepacks/*"},
+	}
+	// An update interrupted by the launcher being closed is completed first
+	if err := gameFolder.recover(); err != nil {
+		return nil, fmt.Errorf("❌ Failed to recover the game folder: %w", err)
+	}
+	if err := readStateFile(gameFolder.statePath(installedFile), &gameFolder.Manifest); err != nil {
+		return nil, fmt.Errorf("❌ The game folder %s is not installed: %w", path, err)
+	}
+	return gameFolder, nil
+}
+
+// gameFolderPath returns the path of the game folder, in ./packs in test pack mode
+func gameFolderPath(folderName string, testPackModeArgs ...bool) (string, error) {
+	if len(testPackModeArgs) == 0 || !testPackModeArgs[0] {
+		path, err := GetGameFolderPathForFolder(folderName)
+		if err != nil {
+			return "", fmt.Errorf("❌ Failed to get game folder path: %w", err)
+		}
+		return path, nil
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("❌ Failed to get pwd: %w", err)
+	}
+	return filepath.Join(pwd, "packs", folderName), nil
+}
+
+// loadManifest reads the manifest of the revision, 0 for the latest one
+func loadManifest(connector connectors.Connector, revision int) (Manifest, error) {
+	// The signature is checked before anything is downloaded
+	var manifest Manifest
+	data, err := readManifest(connector, shared.MANIFEST_FILE, shared.MANIFEST_SIGNATURE_FILE)
+	if err != nil {
+		return manifest, fmt.Errorf("❌ Failed to read manifest at location %s: %w", shared.MANIFEST_FILE, err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("❌ Failed to read manifest at location %s: %w", shared.MANIFEST_FILE, err)
+	}
+	normalizeLegacyPaths(&manifest)
+	if err := ValidateManifest(manifest); err != nil {
+		return manifest, fmt.Errorf("❌ Failed to read manifest at location %s: %w", shared.MANIFEST_FILE, err)
+	}
+
+	if revision != 0 && revision != manifest.Revision {
+		pinned, err := readRevision(connector, revision)
+		if err != nil {
+			return manifest, fmt.Errorf("❌ Failed to read manifest at location %s: %w", revisionPath(revision), err)
+		}
+		manifest = pinRevision(manifest, pinned)
+	}
+	return manifest, nil
+}
+
 func (d *GameFolder) GetPath() string {
 	return d.Path
 }
@@ -143,7 +224,7 @@ func (g *GameFolder) GetRuntime() (string, error) {
 	}
 
 	if _, ok := g.Manifest.JavaBinaries[shared.PLATFORM]; ok {
-		return filepath.Join(g.Path, g.Manifest.JavaBinaries[shared.PLATFORM]), nil
+		return filepath.Join(g.Path, filepath.FromSlash(g.Manifest.JavaBinaries[shared.PLATFORM])), nil
 	}
 	return "", fmt.Errorf("java binaries not found")
 }
@@ -213,47 +294,188 @@ func (g *GameFolder) SaveSession(username string, password string) error {
 // Publish
 /////////////////////////////////////////////////////////////////////
 
-func PublishGameFolder(connector connectors.Connector, packName string) {
+// PublishOptions are the optional features of PublishGameFolder
+type PublishOptions struct {
+	Deltas bool // Publish binary patches from the previous version of the changed files (see FolderFile.Patches)
+
+	// Store the files as content-defined chunks (see FolderFile.Chunks), the chunks already stored are not sent again
+	// Deltas are not needed with chunks, the unchanged chunks of a file are already reused
+	Chunks     bool
+	ChunkStore string // Directory of the chunks relative to the pack, shared.CHUNKS_DIR by default (see Manifest.ChunkStore)
+
+	// Store the changed files compressed (see FolderFile.Compression), unless the compression saves less than 10%
+	// The chunked files are not compressed
+	Compression Compression
+
+	// Sign the manifest (shared.MANIFEST_SIGNATURE_FILE), the launchers trusting the public key reject the other manifests
+	SigningKey ed25519.PrivateKey
+
+	Changelog string // Changes of the new revision, the one of the local manifest is kept if empty
+
+	// Release channel of the revision, DEFAULT_CHANNEL if empty. Only the default channel updates manifest.json and the
+	// files at their path, the changed files of the other channels are stored in shared.ARCHIVE_DIR
+	Channel string
+
+	// Path of the catalog of the packs relative to the pack, ../index.json by default (see ReadCatalog)
+	// NO_CATALOG leaves the catalog as is
+	Catalog string
+}
+
+/**
+* Publish the pack ./packs/<packName> to the connector, the files are uploaded then the manifest is committed
+* The remote is left as is when a file can't be uploaded, the launchers keep the previous manifest
+* Example:
+* ```
+* if err := folder.PublishGameFolder(connector, "my-pack", folder.PublishOptions{Deltas: true}); err != nil {
+*     log.Fatal(err)
+* }
+* ```
+ */
+func PublishGameFolder(connector connectors.Connector, packName string, options ...PublishOptions) error {
+	var publishOptions PublishOptions
+	if len(options) > 0 {
+		publishOptions = options[0]
+	}
+
+	p, err := newPublication(connector, packName, publishOptions)
+	if err != nil {
+		return err
+	}
+	if err := p.stage(); err != nil {
+		return err
+	}
+	manifestStr, signature, err := p.sign()
+	if err != nil {
+		return err
+	}
+	return p.commit(manifestStr, signature)
+}
+
+// publication is a pack being published by PublishGameFolder
+type publication struct {
+	connector   connectors.Connector
+	packName    string
+	dir         string // Local folder of the pack
+	options     PublishOptions
+	channel     string
+	stable      bool // Publish of the default channel
+	catalogPath string
+
+	manifest            Manifest
+	manifestFiles       map[string]int // path => index in manifest.Files
+	previousManifest    Manifest
+	hasPreviousManifest bool
+	previousFiles       map[string]FolderFile
+	archive             bool            // The content replaced by the publish is kept for the previous revisions
+	knownChunks         map[string]bool // Chunks already in the chunk store
+}
+
+// newPublication checks the options and reads the local manifest and the published one
+func newPublication(connector connectors.Connector, packName string, options PublishOptions) (*publication, error) {
+	if options.Compression != COMPRESSION_NONE {
+		if _, err := options.Compression.codec(); err != nil {
+			return nil, err
+		}
+	}
+	p := &publication{connector: connector, packName: packName, options: options, channel: options.Channel, catalogPath: options.Catalog}
+	if p.channel == "" {
+		p.channel = DEFAULT_CHANNEL
+	}
+	if err := ValidateChannel(p.channel); err != nil {
+		return nil, err
+	}
+	p.stable = p.channel == DEFAULT_CHANNEL
+	if p.catalogPath == "" {
+		p.catalogPath = "../" + shared.CATALOG_FILE
+	}
+	if p.catalogPath != NO_CATALOG {
+		if err := validateCatalogFile(p.catalogPath); err != nil {
+			return nil, err
+		}
+	}
+
 	pwd, err := os.Getwd()
 	if err != nil {
-		fmt.Println("Error getting pwd: ", err)
-		return
+		return nil, fmt.Errorf("failed to get the working directory: %w", err)
 	}
-	// Walk dir the "packs/<pack_name>" folder and check if already in manifest if so skip, if not add to manifest
-	dir := filepath.Join(pwd, "packs", packName)
-	fmt.Println("Publishing game folder: ", dir)
+	p.dir = filepath.Join(pwd, "packs", packName)
+	fmt.Println("Publishing game folder: ", p.dir)
 
-	//  Read the manifest inside the dir
-	var manifest Manifest
-	f, err := os.Open(filepath.Join(dir, shared.MANIFEST_FILE))
+	f, err := os.Open(filepath.Join(p.dir, shared.MANIFEST_FILE))
 	if err != nil {
-		fmt.Println("Error opening manifest: ", err)
-		return
+		return nil, fmt.Errorf("failed to open the manifest: %w", err)
 	}
 	defer f.Close()
-	err = json.NewDecoder(f).Decode(&manifest)
-	if err != nil {
-		fmt.Println("Error decoding manifest: ", err)
-		return
+	if err := json.NewDecoder(f).Decode(&p.manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode the manifest: %w", err)
 	}
+	normalizeLegacyPaths(&p.manifest)
 
-	// First create a map of the files in the manifest for fast lookup
-	manifestFiles := make(map[string]FolderFile)
-	for _, file := range manifest.Files {
-		manifestFiles[file.Path] = file
+	p.manifestFiles = make(map[string]int, len(p.manifest.Files))
+	for i, file := range p.manifest.Files {
+		p.manifestFiles[file.Path] = i
 	}
 
+	// Read the previously published manifest, files which are not part of the pack anymore are removed from the remote
+	p.hasPreviousManifest = connector.ReadFile(shared.MANIFEST_FILE, &p.previousManifest) == nil
+	normalizeLegacyPaths(&p.previousManifest)
+	p.previousFiles = make(map[string]FolderFile, len(p.previousManifest.Files))
+	for _, file := range p.previousManifest.Files {
+		p.previousFiles[file.Path] = file
+	}
+
+	// The other channels use the files of the default one when they don't differ
+	if !p.stable && !p.hasPreviousManifest {
+		return nil, fmt.Errorf("publish the %s channel before the %s one", DEFAULT_CHANNEL, p.channel)
+	}
+
+	// Each publish is a new revision, the previous ones stay downloadable (see InitGameFolderAt)
+	lastRevision := p.previousManifest.Revision
+	if revisions, err := ListRevisions(connector); err == nil && len(revisions) > 0 {
+		lastRevision = max(lastRevision, revisions[len(revisions)-1])
+	}
+	p.manifest.Revision = max(p.manifest.Revision, lastRevision+1)
+	p.manifest.ReleaseDate = time.Now().UTC().Format(time.RFC3339)
+	p.manifest.Channel = p.channel
+	if options.Changelog != "" {
+		p.manifest.Changelog = options.Changelog
+	}
+	// The manifests published before the revisions can't be pinned, their files are not archived
+	// The other channels don't replace any file
+	p.archive = p.stable && p.hasPreviousManifest && lastRevision > 0
+
+	// The chunks of the previous manifest are already in the store
+	p.knownChunks = map[string]bool{}
+	if options.Chunks {
+		p.manifest.ChunkStore = options.ChunkStore
+		if p.previousManifest.ChunkStore == p.manifest.ChunkStore {
+			for _, file := range p.previousManifest.Files {
+				for _, chunk := range file.Chunks {
+					p.knownChunks[chunk.Sha] = true
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// stage uploads the files of the pack which are not already on the remote and lists them in the manifest
+// The published manifest isn't changed yet, an error leaves the remote as is
+func (p *publication) stage() error {
 	// Count total files first for progress tracking
 	totalFiles := 0
-	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+	filepath.WalkDir(p.dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		relPath, err := filepath.Rel(dir, path)
+		relPath, err := filepath.Rel(p.dir, path)
 		if err != nil {
 			return err
 		}
-		if relPath != "manifest.json" && !d.IsDir() {
+		if d.IsDir() && filepath.ToSlash(relPath) == shared.STATE_DIR {
+			return filepath.SkipDir
+		}
+		if relPath != shared.MANIFEST_FILE && !d.IsDir() {
 			totalFiles++
 		}
 		return nil
@@ -261,84 +483,452 @@ func PublishGameFolder(connector connectors.Connector, packName string) {
 
 	fmt.Printf("Found %d files to process\n", totalFiles)
 
-	// Progress tracking variables
 	processedFiles := 0
+	localFiles := make(map[string]bool)
 
-	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+	err := filepath.WalkDir(p.dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
-			fmt.Println("Error walking dir: ", err)
 			return err
 		}
 
-		relPath, err := filepath.Rel(dir, path)
+		relPath, err := filepath.Rel(p.dir, path)
 		if err != nil {
-			fmt.Println("Error getting rel path: ", err)
 			return err
 		}
+		// The manifest paths use forward slashes on every OS
+		relPath = filepath.ToSlash(relPath)
 
-		if relPath == "manifest.json" {
+		if relPath == shared.MANIFEST_FILE {
+			return nil
+		}
+		// The update state of a pack built in its own folder isn't published
+		if d.IsDir() && relPath == shared.STATE_DIR {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
 			return nil
 		}
 
-		if !d.IsDir() {
-			// Show progress
-			utils.PrintProgress("Publishing", processedFiles, totalFiles, relPath)
+		utils.PrintProgress("Publishing", processedFiles, totalFiles, relPath)
+		if err := p.stageFile(path, relPath); err != nil {
+			return fmt.Errorf("failed to publish %s: %w", relPath, err)
+		}
+		// Only the uploaded files are kept in the manifest
+		localFiles[relPath] = true
+		processedFiles++
+		return nil
+	})
+	if err != nil {
+		// The files not walked yet would be missing from the manifest and pruned from the remote
+		fmt.Println()
+		return fmt.Errorf("the remote is left as is: %w", err)
+	}
+
+	utils.PrintProgress("Publishing", totalFiles, totalFiles, "Complete!")
+	fmt.Println() // New line after progress bar
+
+	// Drop the files deleted from the pack folder
+	files := []FolderFile{}
+	for _, file := range p.manifest.Files {
+		if localFiles[file.Path] {
+			files = append(files, file)
+		}
+	}
+	p.manifest.Files = files
+
+	// The launchers would refuse the manifest, the remote is left as is
+	return ValidateManifest(p.manifest)
+}
+
+// stageFile uploads the local file if the remote doesn't have it and updates its entry of the manifest
+func (p *publication) stageFile(path string, relPath string) error {
+	stats, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	// Skip the files already on the remote, the connectors check the checksum without downloading when possible
+	sha := utils.FileSHA1(path)
+	previous, hasPrevious := p.previousFiles[relPath]
+	var patches []FilePatch
+	var chunks []FileChunk
+	compression, compressedSize := COMPRESSION_NONE, int64(0)
+	if hasPrevious && previous.Sha == sha {
+		// The patches to the current version are still valid
+		patches = previous.Patches
+	} else if hasPrevious && p.archive {
+		// The previous revisions still use the replaced content
+		if err := archiveFile(p.connector, previous); err != nil {
+			return fmt.Errorf("failed to archive the previous version: %w", err)
+		}
+	}
+	if p.options.Chunks {
+		patches = nil
+		if hasPrevious && previous.Sha == sha && len(previous.Chunks) > 0 && p.knownChunks[previous.Chunks[0].Sha] {
+			chunks = previous.Chunks
+		} else if chunks, sha, err = publishChunks(p.connector, p.manifest.ChunkStore, path, p.knownChunks); err != nil {
+			return fmt.Errorf("failed to send the chunks: %w", err)
+		}
+	} else if published, ok := publishedFile(p.connector, previous, hasPrevious, relPath, sha); ok {
+		compression, compressedSize = published.Compression, published.CompressedSize
+	} else if !p.stable && p.connector.HasFile(FolderFile{Path: relPath, Sha: sha}.archivePath()) {
+		// Already published by another channel or revision
+	} else {
+		// The other channels store the files in the archive, the default one keeps its files at their path
+		remotePath := relPath
+		if !p.stable {
+			remotePath = FolderFile{Path: relPath, Sha: sha}.archivePath()
+		}
 
-			// Publish the file to the connector
-			bytes, err := os.ReadFile(path)
+		// The patch is computed from the previous version before it is replaced
+		if p.options.Deltas && hasPrevious && p.stable {
+			patch, err := publishPatch(p.connector, previous, path, sha)
 			if err != nil {
-				fmt.Println("Error reading file: ", err)
-				return err
+				fmt.Println("Error creating patch, the whole file will be downloaded: ", err)
+			} else if patch != nil {
+				patches = []FilePatch{*patch}
 			}
+		}
 
-			if err := connector.SendFileFromBytes(relPath, bytes); err != nil {
-				fmt.Println("Error sending file to connector: ", err)
-				return err
-			}
+		if p.options.Compression != COMPRESSION_NONE {
+			compression, compressedSize, err = publishCompressedFile(p.connector, path, remotePath, stats.Mode().Perm(), p.options.Compression)
+		} else {
+			sha, err = publishFile(p.connector, path, remotePath, stats.Mode().Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-			if _, ok := manifestFiles[relPath]; ok {
-				processedFiles++
-				return nil
-			}
+	// The checksum is computed while streaming, keep the manifest in sync if the file changed locally
+	i, ok := p.manifestFiles[relPath]
+	if !ok {
+		p.manifest.Files = append(p.manifest.Files, FolderFile{Path: relPath, Type: "extra"})
+		i = len(p.manifest.Files) - 1
+		p.manifestFiles[relPath] = i
+	}
+	file := &p.manifest.Files[i]
+	file.Sha = sha
+	file.Size = stats.Size()
+	file.Patches = patches
+	file.Chunks = chunks
+	file.Compression = compression
+	file.CompressedSize = compressedSize
+	return nil
+}
 
-			// Read the file stats
-			stats, err := os.Stat(path)
-			if err != nil {
-				fmt.Println("Error stat file: ", err)
-				return err
+// sign returns the manifest to publish and its signature (nil without signing key)
+func (p *publication) sign() ([]byte, []byte, error) {
+	manifestStr, err := json.MarshalIndent(p.manifest, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal the manifest: %w", err)
+	}
+
+	var signature []byte
+	if p.options.SigningKey != nil {
+		signature = SignManifest(manifestStr, p.options.SigningKey)
+	}
+	return manifestStr, signature, nil
+}
+
+// commit sends the manifest, the launchers then update to the new revision
+// The files removed from the pack are deleted once the manifest no longer uses them
+func (p *publication) commit(manifestStr []byte, signature []byte) error {
+	// The revision is sent first, the latest manifest is always in the history
+	if err := publishRevision(p.connector, p.manifest, manifestStr, signature); err != nil {
+		return fmt.Errorf("failed to send the manifest revision: %w", err)
+	}
+
+	if p.stable {
+		if err := p.connector.SendFileFromBytes(shared.MANIFEST_FILE, manifestStr); err != nil {
+			return fmt.Errorf("failed to send the manifest: %w", err)
+		}
+
+		if signature != nil {
+			if err := p.connector.SendFileFromBytes(shared.MANIFEST_SIGNATURE_FILE, signature); err != nil {
+				return fmt.Errorf("failed to send the manifest signature: %w", err)
 			}
+		} else if p.connector.HasFile(shared.MANIFEST_SIGNATURE_FILE) {
+			// The signature of the previous manifest would reject the new one
+			p.connector.Delete(shared.MANIFEST_SIGNATURE_FILE)
+		}
+	}
+
+	if err := publishChannel(p.connector, p.channel, p.manifest.Revision, p.options.SigningKey); err != nil {
+		return fmt.Errorf("failed to send the channels: %w", err)
+	}
+
+	if p.hasPreviousManifest && p.stable {
+		pruneRemovedFiles(p.connector, p.previousManifest, p.manifest, p.archive)
+	}
 
-			folderFile := FolderFile{Path: relPath, Sha: utils.BytesSHA1(bytes), Type: "extra", Rules: nil, Size: stats.Size()}
-			manifest.Files = append(manifest.Files, folderFile)
-			manifestFiles[relPath] = folderFile
-			processedFiles++
+	// The pack is published, a launcher which knows its uri can already use it
+	if p.catalogPath != NO_CATALOG {
+		if err := updateCatalog(p.connector, p.catalogPath, p.packName); err != nil {
+			return fmt.Errorf("the pack is published but the catalog isn't updated: %w", err)
 		}
-		return nil
-	})
+	}
 
-	// Show completion
-	utils.PrintProgress("Publishing", totalFiles, totalFiles, "Complete!")
-	fmt.Println() // New line after progress bar
+	fmt.Printf("Manifest sent to connector (revision %d, channel %s)\n", p.manifest.Revision, p.channel)
+	return nil
+}
+
+// pruneRemovedFiles deletes from the remote the files (and patches) of the previous manifest which are not in the new one
+// With archive, the content of the removed files is kept for the previous revisions
+func pruneRemovedFiles(connector connectors.Connector, previous Manifest, current Manifest, archive bool) {
+	currentFiles := make(map[string]bool, len(current.Files))
+	for _, path := range remotePaths(current) {
+		currentFiles[path] = true
+	}
+
+	for _, file := range previous.Files {
+		if !archive || len(file.Chunks) > 0 || currentFiles[file.remotePath()] {
+			continue
+		}
+		if err := archiveFile(connector, file); err != nil {
+			// Removing it would break the previous revisions
+			fmt.Println("Error archiving file, it is kept: ", err)
+			currentFiles[file.remotePath()] = true
+		}
+	}
+
+	for _, path := range remotePaths(previous) {
+		if currentFiles[path] {
+			continue
+		}
+
+		fmt.Println("Removing file deleted from the pack: ", path)
+		if err := connector.Delete(path); err != nil && connector.HasFile(path) {
+			fmt.Println("Error deleting file from connector: ", err)
+		}
+	}
+}
+
+// remotePaths returns the paths of the files and of the patches of the manifest
+// The chunks are never removed, they can be used by the other packs of the chunk store
+func remotePaths(manifest Manifest) []string {
+	paths := []string{}
+	for _, file := range manifest.Files {
+		if len(file.Chunks) == 0 {
+			paths = append(paths, file.remotePath())
+		}
+		for _, patch := range file.Patches {
+			paths = append(paths, patch.Path)
+		}
+	}
+	return paths
+}
 
-	// Send the updated manifest to the connector
-	manifestStr, err := json.MarshalIndent(manifest, "", "  ")
+// publishedFile returns the version of the file on the remote if it is up to date, compressed or not
+func publishedFile(connector connectors.Connector, previous FolderFile, hasPrevious bool, relPath string, sha string) (FolderFile, bool) {
+	if hasPrevious && previous.Sha == sha && previous.Compression != COMPRESSION_NONE {
+		return previous, connector.HasFile(previous.remotePath())
+	}
+	// The connectors check the checksum without downloading when possible
+	return FolderFile{}, sha != "" && connector.HasFileWithChecksum(relPath, connectors.ChecksumTypeSHA1, sha)
+}
+
+// publishCompressedFile sends the compressed local file, or the file as is if the compression isn't worth it
+func publishCompressedFile(connector connectors.Connector, localPath string, remotePath string, perm fs.FileMode, compression Compression) (Compression, int64, error) {
+	compressedPath, size, err := compressFile(localPath, compression)
 	if err != nil {
-		fmt.Println("Error marshalling manifest: ", err)
-		return
+		return COMPRESSION_NONE, 0, err
 	}
+	if compressedPath == "" {
+		_, err := publishFile(connector, localPath, remotePath, perm)
+		return COMPRESSION_NONE, 0, err
+	}
+	defer os.Remove(compressedPath)
 
-	if err := connector.SendFileFromBytes(shared.MANIFEST_FILE, manifestStr); err != nil {
-		fmt.Println("Error sending manifest to connector: ", err)
-		return
+	file := FolderFile{Path: remotePath, Compression: compression}
+	if _, err := publishFile(connector, compressedPath, file.remotePath(), perm); err != nil {
+		return COMPRESSION_NONE, 0, err
 	}
+	return compression, size, nil
+}
+
+// publishFile streams a local file to the connector and returns its sha1
+func publishFile(connector connectors.Connector, localPath string, remotePath string, perm fs.FileMode) (string, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
 
-	fmt.Println("Manifest sent to connector")
+	w, err := connector.Create(remotePath, perm)
+	if err != nil {
+		return "", err
+	}
+
+	reader := utils.NewSHA1Reader(f)
+	if _, err := io.Copy(w, reader); err != nil {
+		connectors.CancelWriter(w)
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return reader.Sum(), nil
 }
 
 // ///////////////////////////////////////////////////////////////////
 // Build
 // ///////////////////////////////////////////////////////////////////
 
+// downloadFile streams the remote file to the staging area while hashing it
+// The data is written in a .part file which is only renamed once the checksum is verified
+// If a .part file is left by an interrupted download, the download is resumed when the connector supports it
+// The limiter is shared by the workers to cap the bandwidth of the whole build (nil for no limit)
+func (g *GameFolder) downloadFile(file FolderFile, limiter *utils.RateLimiter) error {
+	// The file is created in the staging area, the game folder is only changed once every file is verified
+	// The links of the game folder can't lead the files outside of it
+	livePath, err := ResolvePath(g.Path, file.Path)
+	if err != nil {
+		return err
+	}
+	destPath, err := g.stagedPath(file.Path)
+	if err != nil {
+		return err
+	}
+	// Already staged by an interrupted build
+	if utils.FileSHA1(destPath) == file.Sha {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", file.Path, err)
+	}
+
+	mode := 0644
+	if file.Executable {
+		mode = 0755
+	}
+
+	tmpPath := destPath + ".part"
+	if info, err := os.Lstat(tmpPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		// The .part file is opened for writing, it would follow the link
+		os.Remove(tmpPath)
+	}
+
+	// A changed file is patched when the manifest has a delta from the local version, downloaded otherwise
+	if len(file.Patches) > 0 && g.patchFile(file, livePath, destPath, tmpPath, fs.FileMode(mode), limiter) == nil {
+		return nil
+	}
+
+	// A chunked file is rebuilt from the chunks, only the ones missing locally are downloaded
+	if len(file.Chunks) > 0 {
+		return g.downloadChunks(file, destPath, tmpPath, fs.FileMode(mode), limiter)
+	}
+
+	rc, offset, err := g.openRemoteFile(file, tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", file.Path, err)
+	}
+	defer rc.Close()
+
+	flags := os.O_CREATE | os.O_RDWR | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_RDWR
+	}
+	f, err := os.OpenFile(tmpPath, flags, fs.FileMode(mode))
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", file.Path, err)
+	}
+
+	// Hash the already downloaded part, then the remaining data while streaming
+	h := sha1.New()
+	if offset > 0 {
+		if _, err := io.CopyN(h, f, offset); err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+			os.Remove(tmpPath + validatorExtension)
+			return fmt.Errorf("failed to read partial file %s: %w", file.Path, err)
+		}
+	}
+
+	// The compressed files are decompressed while streaming, the checksum is the one of the uncompressed content
+	reader, err := file.decompress(limiter.Reader(rc))
+	if err == nil {
+		var src io.Reader = reader
+		if file.Compression != COMPRESSION_NONE && file.Size > 0 {
+			// A corrupted stream can't fill the disk, one more byte fails the checksum
+			src = io.LimitReader(reader, file.Size+1)
+		}
+		_, err = io.Copy(io.MultiWriter(f, h), src)
+		reader.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// The .part file is kept, the next attempt resumes from there
+		return fmt.Errorf("failed to write file %s: %w", file.Path, err)
+	}
+
+	// The part is complete, it is either verified or downloaded again
+	os.Remove(tmpPath + validatorExtension)
+
+	sha := hex.EncodeToString(h.Sum(nil))
+	if file.Sha != "" && sha != file.Sha {
+		os.Remove(tmpPath)
+		// With mirrors, the next attempt downloads the file from another source
+		if failover, ok := connectors.As[connectors.FailoverConnector](g.Connector); ok {
+			failover.ReportBadFile(file.remotePath())
+		}
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", file.Path, file.Sha, sha)
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file %s: %w", file.Path, err)
+	}
+	return nil
+}
+
+// validatorExtension is the extension of the file next to the .part file holding the validator of the remote file
+const validatorExtension = ".validator"
+
+// openRemoteFile opens the remote file, starting after the content of the .part file if the connector can resume
+// The validator of the remote file (ETag or Last-Modified) is saved next to the .part file when the download starts,
+// the part is only resumed if the remote file didn't change since
+// It returns the offset at which the content starts, the compressed files are not resumed
+func (g *GameFolder) openRemoteFile(file FolderFile, tmpPath string) (io.ReadCloser, int64, error) {
+	rangeConnector, ok := g.Connector.(connectors.RangeConnector)
+	if !ok || file.Compression != COMPRESSION_NONE {
+		rc, _, err := g.Connector.Open(file.remotePath())
+		return rc, 0, err
+	}
+
+	// A part without validator wasn't started by this function (or the validator was lost), it is downloaded again
+	validatorPath := tmpPath + validatorExtension
+	offset := int64(0)
+	ifRange, validatorErr := os.ReadFile(validatorPath)
+	if stats, err := os.Stat(tmpPath); err == nil && validatorErr == nil && (file.Size <= 0 || stats.Size() < file.Size) {
+		offset = stats.Size()
+	}
+
+	rc, _, validator, resumed, err := rangeConnector.OpenRange(file.remotePath(), offset, string(ifRange))
+	if err != nil {
+		os.Remove(validatorPath)
+		rc, _, err := g.Connector.Open(file.remotePath())
+		return rc, 0, err
+	}
+	if resumed && offset > 0 {
+		return rc, offset, nil
+	}
+
+	// The whole file is sent, an empty validator resumes it without If-Range (connectors without versions)
+	// The old file is removed first so a link isn't followed, like the .part file
+	os.Remove(validatorPath)
+	if err := os.WriteFile(validatorPath, []byte(validator), 0644); err != nil {
+		os.Remove(validatorPath)
+	}
+	return rc, 0, nil
+}
+
+// downloadAttempts is the number of times a file is downloaded before failing the build
+const downloadAttempts = 3
+
 func (g *GameFolder) downloadMissingFiles(filesToDownload []FolderFile, pCb shared.ProgressCallback) error {
 	totalFilesToDownload := len(filesToDownload)
 
@@ -348,16 +938,10 @@ func (g *GameFolder) downloadMissingFiles(filesToDownload []FolderFile, pCb shar
 
 	var downloadedFiles int64
 
-	// Create a worker pool with number of CPUs
-	numWorkers := runtime.NumCPU()
-	if numWorkers > totalFilesToDownload {
-		numWorkers = totalFilesToDownload
-	}
-
-	// Configure SFTP connection pool if using SFTP connector
-	if sftpConn, ok := g.Connector.(*connectors.SFTPConnector); ok {
-		sftpConn.SetPoolSize(numWorkers)
-	}
+	// The workers take the files by priority (client jar and libraries before the assets)
+	numWorkers := g.Scheduler.concurrency(g.Connector, totalFilesToDownload)
+	filesToDownload = g.Scheduler.order(filesToDownload)
+	limiter := utils.NewRateLimiter(g.Scheduler.BytesPerSecond)
 
 	// Create channels for work distribution
 	fileChan := make(chan FolderFile, totalFilesToDownload)
@@ -371,39 +955,18 @@ func (g *GameFolder) downloadMissingFiles(filesToDownload []FolderFile, pCb shar
 		go func() {
 			defer wg.Done()
 			for file := range fileChan {
-				// Download the file with connector
-				bytes, err := g.Connector.ReadFileBytes(file.Path, file.Size)
-				if err != nil {
-					mu.Lock()
-					if firstError == nil {
-						firstError = fmt.Errorf("failed to read file %s: %w", file.Path, err)
-					}
-					mu.Unlock()
-					continue
-				}
-
-				// Create the file in the game folder
-				destPath := filepath.Join(g.Path, file.Path)
-				err = os.MkdirAll(filepath.Dir(destPath), 0755)
-				if err != nil {
-					mu.Lock()
-					if firstError == nil {
-						firstError = fmt.Errorf("failed to create directory for %s: %w", file.Path, err)
+				// Download the file with connector, a failed download is resumed from its .part file
+				var err error
+				for attempt := 1; attempt <= downloadAttempts; attempt++ {
+					if err = g.downloadFile(file, limiter); err == nil || attempt == downloadAttempts {
+						break
 					}
-					mu.Unlock()
-					continue
-				}
-
-				mode := 0644
-				if file.Executable {
-					mode = 0755
+					time.Sleep(utils.DefaultRetryPolicy.Backoff(attempt, 0))
 				}
-
-				err = os.WriteFile(destPath, bytes, fs.FileMode(mode))
 				if err != nil {
 					mu.Lock()
 					if firstError == nil {
-						firstError = fmt.Errorf("failed to write file %s: %w", file.Path, err)
+						firstError = err
 					}
 					mu.Unlock()
 					continue
@@ -438,6 +1001,15 @@ func (g *GameFolder) downloadMissingFiles(filesToDownload []FolderFile, pCb shar
 }
 
 func (g *GameFolder) Build(debug bool, pCb shared.ProgressCallback) error {
+	// Nothing is written on disk for a manifest with a path leading outside of the game folder
+	normalizeLegacyPaths(&g.Manifest)
+	if err := ValidateManifest(g.Manifest); err != nil {
+		return err
+	}
+	// An update interrupted while swapping the files is finished first
+	if err := g.recover(); err != nil {
+		return err
+	}
 
 	// 1. Don't download know just skip already downloaded file or file not supported for the current os
 	filesToDownload := []FolderFile{}
@@ -448,7 +1020,10 @@ func (g *GameFolder) Build(debug bool, pCb shared.ProgressCallback) error {
 			continue
 		}
 
-		dest := filepath.Join(g.Path, file.Path)
+		dest, err := ResolvePath(g.Path, file.Path)
+		if err != nil {
+			return err
+		}
 		// Check if a file at dest exists with same checksum
 		if _, err := os.Stat(dest); err == nil {
 			// Check if the file at dest has the same checksum as the file in the manifest
@@ -462,44 +1037,63 @@ func (g *GameFolder) Build(debug bool, pCb shared.ProgressCallback) error {
 		allowedFiles[dest] = true
 	}
 
+	// The chunks of the outdated and removed local files are reused by the chunked files
+	g.chunks = g.indexLocalChunks(filesToDownload, allowedFiles)
+	defer func() { g.chunks = nil }()
+
 	err := g.downloadMissingFiles(filesToDownload, pCb)
 	if err != nil {
 		return fmt.Errorf("failed to download missing files: %w", err)
 	}
 
-	// Then with waldir go through each file in the game folder and check if it's allowed
+	// 2. Every file is downloaded and verified, they are swapped in the game folder with the files which aren't allowed
+	entries := make([]journalEntry, 0, len(filesToDownload))
+	for _, file := range filesToDownload {
+		entries = append(entries, journalEntry{Path: file.Path, Action: actionInstall})
+	}
 	filepath.WalkDir(g.Path, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if d.IsDir() && g.isState(path) {
+			return filepath.SkipDir
+		}
 
-		if !d.IsDir() && !allowedFiles[path] {
-			// Check if it matches a pattern in KeepFiles
-			shouldKeep := false
-			for _, keepFile := range g.KeepFiles {
-				// Check for exact match first
-				if path == keepFile {
-					shouldKeep = true
-					break
-				}
-				// Check for glob pattern match (e.g., "logs/*")
-				if matched, err := filepath.Match(keepFile, path); err == nil && matched {
-					shouldKeep = true
-					break
-				}
-				// Check for regex pattern match (for backward compatibility)
-				if match, err := regexp.MatchString(keepFile, path); err == nil && match {
-					shouldKeep = true
-					break
-				}
-			}
-
-			if !shouldKeep {
-				os.Remove(path)
+		if !d.IsDir() && !allowedFiles[path] && !g.isKept(path) {
+			relPath, err := filepath.Rel(g.Path, path)
+			if err != nil {
+				return err
 			}
+			entries = append(entries, journalEntry{Path: filepath.ToSlash(relPath), Action: actionRemove})
 		}
 		return nil
 	})
 
+	if len(entries) == 0 {
+		// Nothing to swap, the last update can still be rolled back
+		return writeStateFile(g.statePath(installedFile), g.Manifest)
+	}
+	if err := g.commit(entries); err != nil {
+		return fmt.Errorf("failed to update the game folder: %w", err)
+	}
 	return nil
 }
+
+// isKept tells if the local file matches a pattern of KeepFiles
+func (g *GameFolder) isKept(path string) bool {
+	for _, keepFile := range g.KeepFiles {
+		// Check for exact match first
+		if path == keepFile {
+			return true
+		}
+		// Check for glob pattern match (e.g., "logs/*")
+		if matched, err := filepath.Match(keepFile, path); err == nil && matched {
+			return true
+		}
+		// Check for regex pattern match (for backward compatibility)
+		if match, err := regexp.MatchString(keepFile, path); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,546 @@
+package folder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+func noProgress(string, int, int, string) {}
+
+// chdir changes the working directory until the end of the test (PublishGameFolder works in ./packs)
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(pwd) })
+}
+
+// newRemotePack serves the files (path => content) and their manifest from an in-memory connector
+func newRemotePack(t *testing.T, files map[string]string) (*connectors.MemoryConnector, Manifest) {
+	t.Helper()
+
+	connector := connectors.NewMemoryConnector(connectors.NewMemFS(), "packs/my-pack")
+	manifest := Manifest{Version: "1.0.0", McVersion: "1.20.1", MainClass: shared.MainClass}
+	for _, path := range sortedKeys(files) {
+		connector.SendFileFromBytes(path, []byte(files[path]))
+		manifest.Files = append(manifest.Files, FolderFile{
+			Path: path,
+			Sha:  utils.BytesSHA1([]byte(files[path])),
+			Size: int64(len(files[path])),
+			Type: "libraries",
+		})
+	}
+
+	data, _ := json.Marshal(manifest)
+	connector.SendFileFromBytes(shared.MANIFEST_FILE, data)
+	return connector, manifest
+}
+
+func newTestGameFolder(t *testing.T, connector connectors.Connector, manifest Manifest) *GameFolder {
+	return &GameFolder{
+		Path:      t.TempDir(),
+		Manifest:  manifest,
+		Connector: connector,
+		KeepFiles: []string{"options.txt", "logs/*", "resourcepacks/*"},
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// listFiles returns the files of the directory, relative and with forward slashes
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files := []string{}
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		// The update state isn't part of the game files
+		if err == nil && d.IsDir() && d.Name() == shared.STATE_DIR {
+			return filepath.SkipDir
+		}
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	slices.Sort(files)
+	return files
+}
+
+/////////////////////////////////////////////////////////////////////
+// Build
+/////////////////////////////////////////////////////////////////////
+
+func TestInitGameFolderReadsManifest(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{"minecraft.jar": "client"})
+	chdir(t, t.TempDir())
+
+	gameFolder, err := InitGameFolder(connector, "my-pack", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gameFolder.GetVersion() != manifest.Version || gameFolder.GetMCVersion() != manifest.McVersion {
+		t.Errorf("manifest = %+v, want %+v", gameFolder.Manifest, manifest)
+	}
+	if !strings.HasSuffix(gameFolder.GetPath(), filepath.Join("packs", "my-pack")) {
+		t.Errorf("path = %s, want packs/my-pack in the working directory", gameFolder.GetPath())
+	}
+
+	if _, err := InitGameFolder(connectors.NewMemoryConnector(connectors.NewMemFS(), ""), "my-pack", true); err == nil {
+		t.Error("expected an error without manifest")
+	}
+}
+
+func TestBuildDownloadsFiles(t *testing.T) {
+	files := map[string]string{
+		"minecraft.jar":              "client",
+		"libraries/com/foo/foo.jar":  "foo",
+		"assets/objects/ab/abcdef":   "asset",
+		"assets/indexes/1.20.1.json": "{}",
+	}
+	connector, manifest := newRemotePack(t, files)
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := listFiles(t, gameFolder.Path), sortedKeys(files); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	for path, content := range files {
+		if got := readFile(t, filepath.Join(gameFolder.Path, path)); got != content {
+			t.Errorf("%s = %q, want %q", path, got, content)
+		}
+	}
+}
+
+func TestBuildSkipsUpToDateFiles(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{"minecraft.jar": "client", "mods/foo.jar": "foo"})
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files are already there, the build must not read them from the remote again
+	connector.Delete("minecraft.jar")
+	connector.Delete("mods/foo.jar")
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Errorf("second build downloaded the files again: %v", err)
+	}
+}
+
+func TestBuildReplacesModifiedFiles(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{"mods/foo.jar": "foo"})
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	dest := filepath.Join(gameFolder.Path, "mods", "foo.jar")
+	os.MkdirAll(filepath.Dir(dest), 0755)
+	os.WriteFile(dest, []byte("tampered"), 0644)
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dest); got != "foo" {
+		t.Errorf("mods/foo.jar = %q, want foo", got)
+	}
+}
+
+func TestBuildFailsOnChecksumMismatch(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{"mods/foo.jar": "foo"})
+	connector.SendFileFromBytes("mods/foo.jar", []byte("corrupted"))
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	err := gameFolder.Build(false, noProgress)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("err = %v, want a checksum mismatch", err)
+	}
+
+	// Neither the file nor its .part file are kept
+	if files := listFiles(t, gameFolder.Path); len(files) != 0 {
+		t.Errorf("files = %v, want none", files)
+	}
+}
+
+func TestBuildRemovesUnknownFiles(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{"mods/foo.jar": "foo"})
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	for _, path := range []string{"mods/removed.jar", "options.txt", "logs/latest.log"} {
+		dest := filepath.Join(gameFolder.Path, path)
+		os.MkdirAll(filepath.Dir(dest), 0755)
+		os.WriteFile(dest, []byte(path), 0644)
+	}
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"logs/latest.log", "mods/foo.jar", "options.txt"}
+	if got := listFiles(t, gameFolder.Path); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestBuildSkipsFilesOfOtherPlatforms(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{"natives/lib.so": "so", "natives/lib.dll": "dll"})
+
+	otherPlatform := shared.PlatformWindows
+	if runtime.GOOS == "windows" {
+		otherPlatform = shared.PlatformLinux
+	}
+	for i, file := range manifest.Files {
+		if file.Path == "natives/lib.dll" {
+			manifest.Files[i].Rules = otherPlatform.CreateRules()
+		}
+	}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := listFiles(t, gameFolder.Path); !slices.Equal(got, []string{"natives/lib.so"}) {
+		t.Errorf("files = %v, want [natives/lib.so]", got)
+	}
+}
+
+func TestBuildSetsExecutablePermission(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no executable bit on windows")
+	}
+
+	connector, manifest := newRemotePack(t, map[string]string{"runtime/linux/bin/java": "java"})
+	manifest.Files[0].Executable = true
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(filepath.Join(gameFolder.Path, "runtime", "linux", "bin", "java"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm()&0100 == 0 {
+		t.Errorf("mode = %v, want executable", st.Mode())
+	}
+}
+
+// rangeRecorder records the ranges at which the files are opened, its files have the validator "v1"
+// The first download is interrupted after cutAt bytes (0 for none)
+type rangeRecorder struct {
+	*connectors.MemoryConnector
+	cutAt  int64
+	mu     sync.Mutex
+	ranges []string // "<path> <offset> <ifRange>"
+}
+
+func (c *rangeRecorder) OpenRange(remotePath string, offset int64, ifRange string) (io.ReadCloser, int64, string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ranges = append(c.ranges, fmt.Sprintf("%s %d %s", remotePath, offset, ifRange))
+
+	// A part of another version of the file is sent whole, like with a If-Range mismatch
+	if ifRange != "v1" {
+		offset = 0
+	}
+	rc, size, _, resumed, err := c.MemoryConnector.OpenRange(remotePath, offset, ifRange)
+	if err == nil && len(c.ranges) == 1 && c.cutAt > 0 {
+		rc = io.NopCloser(io.MultiReader(io.LimitReader(rc, c.cutAt), iotest.ErrReader(errors.New("connection reset"))))
+	}
+	return rc, size, "v1", resumed, err
+}
+
+func TestBuildResumesPartialDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	memConnector, manifest := newRemotePack(t, map[string]string{"minecraft.jar": content})
+	connector := &rangeRecorder{MemoryConnector: memConnector, cutAt: 400}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	// The first download is interrupted after 400 bytes, the next attempt resumes it if the file didn't change
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"minecraft.jar 0 ", "minecraft.jar 400 v1"}; !slices.Equal(connector.ranges, want) {
+		t.Errorf("ranges = %q, want %q", connector.ranges, want)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "minecraft.jar")); got != content {
+		t.Error("resumed file is corrupted")
+	}
+	if exists(filepath.Join(gameFolder.Path, "minecraft.jar.part.validator")) {
+		t.Error("validator left in the game folder")
+	}
+}
+
+func TestBuildRestartsPartialDownloadWithoutValidator(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	memConnector, manifest := newRemotePack(t, map[string]string{"minecraft.jar": content})
+	connector := &rangeRecorder{MemoryConnector: memConnector}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	// The version of the remote file of the part is unknown, it may have changed since
+	writeStagedFile(t, gameFolder, "minecraft.jar.part", content[:400])
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"minecraft.jar 0 "}; !slices.Equal(connector.ranges, want) {
+		t.Errorf("ranges = %q, want %q", connector.ranges, want)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "minecraft.jar")); got != content {
+		t.Error("file is corrupted")
+	}
+}
+
+func TestBuildRestartsCorruptedPartialDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	connector, manifest := newRemotePack(t, map[string]string{"minecraft.jar": content})
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	// The .part file doesn't match the remote file, the resumed download fails its checksum then starts over
+	// The memory connector has no validator, the part is resumed without If-Range
+	writeStagedFile(t, gameFolder, "minecraft.jar.part", strings.Repeat("x", 400))
+	writeStagedFile(t, gameFolder, "minecraft.jar.part.validator", "")
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "minecraft.jar")); got != content {
+		t.Error("file is corrupted")
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// Publish
+/////////////////////////////////////////////////////////////////////
+
+// newLocalPack writes the pack in ./packs/my-pack of a temporary working directory, with a generated manifest
+func newLocalPack(t *testing.T, files map[string]string, generated ...string) string {
+	t.Helper()
+	chdir(t, t.TempDir())
+
+	dir := filepath.Join("packs", "my-pack")
+	manifest := Manifest{Version: "1.0.0", McVersion: "1.20.1", MainClass: shared.MainClass}
+	for _, path := range sortedKeys(files) {
+		writePackFile(t, dir, path, files[path])
+		if slices.Contains(generated, path) {
+			manifest.Files = append(manifest.Files, FolderFile{Path: path, Type: "libraries"})
+		}
+	}
+
+	data, _ := json.Marshal(manifest)
+	writePackFile(t, dir, shared.MANIFEST_FILE, string(data))
+	return dir
+}
+
+func writePackFile(t *testing.T, dir string, path string, content string) {
+	t.Helper()
+	dest := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createRecorder records the files uploaded through Create
+type createRecorder struct {
+	*connectors.MemoryConnector
+	created []string
+}
+
+func (c *createRecorder) Create(remotePath string, perm os.FileMode) (io.WriteCloser, error) {
+	c.created = append(c.created, filepath.ToSlash(remotePath))
+	return c.MemoryConnector.Create(remotePath, perm)
+}
+
+func TestPublishGameFolder(t *testing.T) {
+	newLocalPack(t, map[string]string{
+		"minecraft.jar":     "client",
+		"libraries/foo.jar": "foo",
+		"mods/extra.jar":    "extra",
+	}, "minecraft.jar", "libraries/foo.jar")
+
+	connector := connectors.NewMemoryConnector(connectors.NewMemFS(), "")
+	if err := PublishGameFolder(connector, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest Manifest
+	if err := connector.ReadFile(shared.MANIFEST_FILE, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"minecraft.jar": "client", "libraries/foo.jar": "foo", "mods/extra.jar": "extra"}
+	if len(manifest.Files) != len(want) {
+		t.Fatalf("manifest files = %+v, want %v", manifest.Files, sortedKeys(want))
+	}
+	for _, file := range manifest.Files {
+		content, ok := want[file.Path]
+		if !ok {
+			t.Errorf("unexpected file %s in the manifest", file.Path)
+			continue
+		}
+		if file.Sha != utils.BytesSHA1([]byte(content)) || file.Size != int64(len(content)) {
+			t.Errorf("%s: sha %s size %d, want the checksum and size of %q", file.Path, file.Sha, file.Size, content)
+		}
+		if file.Path == "mods/extra.jar" && file.Type != "extra" {
+			t.Errorf("mods/extra.jar type = %s, want extra", file.Type)
+		}
+
+		remote, err := connector.ReadFileBytes(file.Path, -1)
+		if err != nil || string(remote) != content {
+			t.Errorf("remote %s = %q, %v, want %q", file.Path, remote, err, content)
+		}
+	}
+}
+
+func TestPublishGameFolderUpdatesRemote(t *testing.T) {
+	dir := newLocalPack(t, map[string]string{
+		"minecraft.jar":  "client",
+		"mods/a.jar":     "a",
+		"mods/b.jar":     "b",
+		"config/foo.cfg": "foo=1",
+	})
+
+	connector := &createRecorder{MemoryConnector: connectors.NewMemoryConnector(connectors.NewMemFS(), "")}
+	if err := PublishGameFolder(connector, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove a mod and change a config, only the changed file is uploaded and the removed one is pruned
+	// Their previous content is archived for the first revision
+	os.Remove(filepath.Join(dir, "mods", "b.jar"))
+	writePackFile(t, dir, "config/foo.cfg", "foo=2")
+	connector.created = nil
+	if err := PublishGameFolder(connector, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(withoutArchive(connector.created), []string{"config/foo.cfg"}) {
+		t.Errorf("uploaded = %v, want [config/foo.cfg]", connector.created)
+	}
+	if connector.HasFile("mods/b.jar") {
+		t.Error("mods/b.jar was not removed from the remote")
+	}
+
+	var manifest Manifest
+	connector.ReadFile(shared.MANIFEST_FILE, &manifest)
+	paths := []string{}
+	for _, file := range manifest.Files {
+		paths = append(paths, file.Path)
+		if file.Path == "config/foo.cfg" && file.Sha != utils.BytesSHA1([]byte("foo=2")) {
+			t.Error("manifest checksum of config/foo.cfg not updated")
+		}
+	}
+	slices.Sort(paths)
+	if want := []string{"config/foo.cfg", "minecraft.jar", "mods/a.jar"}; !slices.Equal(paths, want) {
+		t.Errorf("manifest files = %v, want %v", paths, want)
+	}
+}
+
+// failingCreate fails the uploads of a file
+type failingCreate struct {
+	*connectors.MemoryConnector
+	path string
+}
+
+func (c *failingCreate) Create(remotePath string, perm os.FileMode) (io.WriteCloser, error) {
+	if filepath.ToSlash(remotePath) == c.path {
+		return nil, errors.New("connection lost")
+	}
+	return c.MemoryConnector.Create(remotePath, perm)
+}
+
+func TestPublishGameFolderFailedUpload(t *testing.T) {
+	dir := newLocalPack(t, map[string]string{
+		"config/foo.cfg": "foo=1",
+		"minecraft.jar":  "client",
+		"mods/a.jar":     "a",
+	})
+	memory := connectors.NewMemoryConnector(connectors.NewMemFS(), "")
+	if err := PublishGameFolder(memory, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first file walked fails, the next ones are neither published nor pruned
+	writePackFile(t, dir, "config/foo.cfg", "foo=2")
+	if err := PublishGameFolder(&failingCreate{MemoryConnector: memory, path: "config/foo.cfg"}, "my-pack"); err == nil || !strings.Contains(err.Error(), "config/foo.cfg") {
+		t.Errorf("err = %v, want the failed upload", err)
+	}
+
+	for path, content := range map[string]string{"config/foo.cfg": "foo=1", "minecraft.jar": "client", "mods/a.jar": "a"} {
+		if data, err := memory.ReadFileBytes(path, -1); err != nil || string(data) != content {
+			t.Errorf("remote %s = %q, %v, want %q", path, data, err, content)
+		}
+	}
+	var manifest Manifest
+	memory.ReadFile(shared.MANIFEST_FILE, &manifest)
+	if manifest.Revision != 1 || len(manifest.Files) != 3 {
+		t.Errorf("manifest = revision %d with %d files, want the first one", manifest.Revision, len(manifest.Files))
+	}
+}
+
+func TestPublishThenBuild(t *testing.T) {
+	files := map[string]string{
+		"minecraft.jar":      "client",
+		"libraries/foo.jar":  "foo",
+		"mods/extra.jar":     "extra",
+		"config/options.cfg": "a=b",
+	}
+	newLocalPack(t, files, "minecraft.jar", "libraries/foo.jar")
+
+	fsys := connectors.NewMemFS()
+	if err := PublishGameFolder(connectors.NewMemoryConnector(fsys, "packs/my-pack"), "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+
+	connector := connectors.NewMemoryConnector(fsys, "packs/my-pack")
+	var manifest Manifest
+	if err := connector.ReadFile(shared.MANIFEST_FILE, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listFiles(t, gameFolder.Path), sortedKeys(files); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
@@ -2,8 +2,7 @@ package builders
 
 import (
 	"encoding/json"
-	"log"
-	"net/http"
+	"fmt"
 	"path/filepath"
 	"slices"
 
@@ -14,8 +13,6 @@ import (
 	"limeal.fr/launchygo/pkg/utils"
 )
 
-const resourcesBase = "https://resources.download.minecraft.net"
-
 type AssetBuilder struct {
 	Connector      connectors.Connector
 	AssetsManifest *manifests.AssetsManifest
@@ -58,7 +55,7 @@ func (a *AssetBuilder) filterElements() []string {
 func (a *AssetBuilder) Download(pcb shared.ProgressCallback) ([]folder.FolderFile, error) {
 	assetsStr, err := json.Marshal(a.AssetsManifest)
 	if err != nil {
-		log.Fatal("failed to marshal assets manifest")
+		return nil, fmt.Errorf("failed to marshal assets manifest: %w", err)
 	}
 
 	assets := []folder.FolderFile{}
@@ -69,7 +66,9 @@ func (a *AssetBuilder) Download(pcb shared.ProgressCallback) ([]folder.FolderFil
 		Type: "assets",
 	})
 
-	a.Connector.SendFileFromBytes(a.GetAssetsIndexPath(), assetsStr)
+	if err := a.Connector.SendFileFromBytes(a.GetAssetsIndexPath(), assetsStr); err != nil {
+		return nil, fmt.Errorf("failed to write assets index: %w", err)
+	}
 
 	assetsObjectsDir := filepath.Join(a.GetFolderPath(), "objects")
 
@@ -94,14 +93,11 @@ func (a *AssetBuilder) Download(pcb shared.ProgressCallback) ([]folder.FolderFil
 		}
 
 		dest := filepath.Join(assetsObjectsDir, hashMin, asset.Hash)
-		url := resourcesBase + "/" + hashMin + "/" + asset.Hash
-		bytes, err := utils.DoRequest[[]byte](http.MethodGet, url, nil)
-		if err != nil {
-			log.Fatal("\nFailed to download asset: ", url)
+		url := shared.RESOURCES_URL + "/" + hashMin + "/" + asset.Hash
+		if err := DownloadToConnector(a.Connector, url, dest, asset.Hash, 0644); err != nil {
+			return nil, fmt.Errorf("failed to download asset %s: %w", url, err)
 		}
 
-		a.Connector.SendFileFromBytes(dest, bytes)
-
 		downloadedAssets++
 		if pcb != nil {
 			pcb("Downloading assets", downloadedAssets, totalAssets, asset.Hash)
@@ -0,0 +1,245 @@
+package builders
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder"
+	"limeal.fr/launchygo/pkg/game/folder/generator/manifests"
+	"limeal.fr/launchygo/pkg/game/folder/rules"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+	"limeal.fr/launchygo/pkg/game/folder/shared/mojangtest"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+func noProgress(string, int, int, string) {}
+
+func newTestConnector() *connectors.MemoryConnector {
+	return connectors.NewMemoryConnector(connectors.NewMemFS(), "packs/my-pack")
+}
+
+// filePaths returns the paths of the manifest files, sorted
+func filePaths(files []folder.FolderFile) []string {
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// checkFiles verifies that the connector holds the files of the manifest with their checksum
+func checkFiles(t *testing.T, connector connectors.Connector, files []folder.FolderFile) {
+	t.Helper()
+	for _, file := range files {
+		if !connector.HasFileWithChecksum(file.Path, connectors.ChecksumTypeSHA1, file.Sha) {
+			t.Errorf("%s missing or with a wrong checksum", file.Path)
+		}
+	}
+}
+
+func TestAssetBuilderDownload(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	icon := server.AddAsset([]byte("icon"))
+	sound := server.AddAsset([]byte("sound"))
+	assetsManifest := &manifests.AssetsManifest{Objects: map[string]manifests.AssetObject{"icon.png": icon, "sound.ogg": sound}}
+
+	connector := newTestConnector()
+	files, err := NewAssetBuilder(connector, assetsManifest, "1.20.1").Download(noProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"assets/indexes/1.20.1.json",
+		"assets/objects/" + icon.Hash[:2] + "/" + icon.Hash,
+		"assets/objects/" + sound.Hash[:2] + "/" + sound.Hash,
+	}
+	slices.Sort(want)
+	if got := filePaths(files); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	checkFiles(t, connector, files)
+
+	// The index is the assets manifest, read by the game
+	var index manifests.AssetsManifest
+	if err := connector.ReadFile("assets/indexes/1.20.1.json", &index); err != nil || index.Objects["icon.png"] != icon {
+		t.Errorf("index = %+v, %v", index, err)
+	}
+
+	// The assets already in the pack are not downloaded again
+	if _, err := NewAssetBuilder(connector, assetsManifest, "1.20.1").Download(noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.Requests("/resources/" + icon.Hash[:2] + "/" + icon.Hash); n != 1 {
+		t.Errorf("asset requested %d times, want 1", n)
+	}
+}
+
+func TestLibrairiesBuilderDownload(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	foo := server.AddLibrary("com.example:foo:1.0", []byte("foo"))
+	bar := server.AddLibrary("com.example:bar:2.0", []byte("bar"))
+	bar.Rules = shared.PlatformLinux.CreateRules()
+	lwjgl := server.AddNativeLibrary("org.lwjgl:lwjgl:3.3.1", "linux", map[string][]byte{"liblwjgl.so": []byte("so")})
+	withoutArtifact := manifests.Library{Name: "com.example:empty:1.0"}
+
+	connector := newTestConnector()
+	builder := NewLibrairiesBuilder(connector, []manifests.Library{foo, bar, lwjgl, withoutArtifact})
+	files, natives, err := builder.Download(noProgress, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"libraries/com/example/bar/2.0/bar-2.0.jar", "libraries/com/example/foo/1.0/foo-1.0.jar"}
+	if got := filePaths(files); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	checkFiles(t, connector, files)
+
+	for _, file := range files {
+		if strings.Contains(file.Path, "bar") && len(file.Rules) == 0 {
+			t.Error("the os rules of the library are not kept")
+		}
+	}
+
+	if len(natives) != 1 || natives[0].Artifact.Path != lwjgl.Downloads.Classifiers["natives-linux"].Path {
+		t.Errorf("natives = %+v, want the natives-linux classifier", natives)
+	}
+}
+
+func TestLibrairiesBuilderChecksumMismatch(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	foo := server.AddLibrary("com.example:foo:1.0", []byte("foo"))
+	server.SetFile(foo.Downloads.Artifact.URL, []byte("corrupted"))
+
+	connector := newTestConnector()
+	_, _, err := NewLibrairiesBuilder(connector, []manifests.Library{foo}).Download(noProgress, false)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("err = %v, want a checksum mismatch", err)
+	}
+	if connector.HasFile("libraries/" + foo.Downloads.Artifact.Path) {
+		t.Error("the corrupted library was written")
+	}
+}
+
+func TestNativesBuilderDownload(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	lwjgl := server.AddNativeLibrary("org.lwjgl:lwjgl:3.3.1", "linux", map[string][]byte{
+		"liblwjgl.so":          []byte("so"),
+		"linux/x64/libglfw.so": []byte("glfw"),
+		"META-INF/MANIFEST.MF": []byte("manifest"),
+	})
+	natives, ok := rules.ExtractNativeClassifier(lwjgl.Downloads.Artifact, lwjgl.Downloads.Classifiers)
+	if !ok {
+		t.Fatal("no native classifier")
+	}
+
+	connector := newTestConnector()
+	files, err := NewNativesBuilder(connector, natives).Download(noProgress, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"natives/liblwjgl.so", "natives/linux/x64/libglfw.so"}
+	if got := filePaths(files); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	checkFiles(t, connector, files)
+
+	for _, file := range files {
+		if !rules.ShouldInclude(file.Rules, rules.Env{Platform: shared.PlatformLinux, Arch: "x86_64"}) {
+			t.Errorf("%s is not restricted to linux: %+v", file.Path, file.Rules)
+		}
+	}
+}
+
+func TestNativesBuilderRejectsTraversal(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	lwjgl := server.AddNativeLibrary("org.lwjgl:lwjgl:3.3.1", "linux", map[string][]byte{
+		"../../../evil.so": []byte("so"),
+	})
+	natives, _ := rules.ExtractNativeClassifier(lwjgl.Downloads.Artifact, lwjgl.Downloads.Classifiers)
+
+	connector := newTestConnector()
+	if _, err := NewNativesBuilder(connector, natives).Download(noProgress, false); err == nil || !strings.Contains(err.Error(), "invalid native entry") {
+		t.Errorf("err = %v, want an invalid native entry", err)
+	}
+	if connectors.NewMemoryConnector(connector.FS, "").HasFile("evil.so") {
+		t.Error("the entry was written outside of the natives")
+	}
+}
+
+func TestRuntimeBuilderDownload(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	server.AddRuntime("java-runtime-gamma", map[string][]byte{
+		"bin/java":      []byte("java"),
+		"lib/rt.jar":    []byte("rt"),
+		"release":       []byte("JAVA_VERSION=17"),
+		"legal/LICENSE": []byte("license"),
+	})
+
+	connector := newTestConnector()
+	builder, err := NewRuntimeBuilder(connector, "java-runtime-gamma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := builder.Download(noProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The runtime is downloaded for every platform, the files are restricted to their platform
+	if len(files) != 4*len(builder.RuntimeManifests) {
+		t.Errorf("%d files, want %d", len(files), 4*len(builder.RuntimeManifests))
+	}
+	checkFiles(t, connector, files)
+
+	for _, file := range files {
+		if file.Executable != strings.Contains(file.Path, "bin") {
+			t.Errorf("%s executable = %v", file.Path, file.Executable)
+		}
+		if len(file.Rules) == 0 {
+			t.Errorf("%s has no platform rules", file.Path)
+		}
+	}
+
+	if _, err := NewRuntimeBuilder(connector, "java-runtime-unknown"); err == nil {
+		t.Error("expected an error for an unknown runtime")
+	}
+}
+
+func TestCopyToConnectorVerifiesChecksum(t *testing.T) {
+	connector := newTestConnector()
+
+	if err := copyToConnector(connector, strings.NewReader("foo"), "mods/foo.jar", utils.BytesSHA1([]byte("foo")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !connector.HasFile("mods/foo.jar") {
+		t.Error("file not written")
+	}
+
+	err := copyToConnector(connector, strings.NewReader("bar"), "mods/bar.jar", utils.BytesSHA1([]byte("foo")), 0644)
+	if err == nil || connector.HasFile("mods/bar.jar") {
+		t.Errorf("err = %v, the file with a wrong checksum must be discarded", err)
+	}
+}
+
+func TestAssetsIndexIsValidJSON(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	assetsManifest := &manifests.AssetsManifest{Objects: map[string]manifests.AssetObject{"a": server.AddAsset([]byte("a"))}}
+
+	connector := newTestConnector()
+	files, err := NewAssetBuilder(connector, assetsManifest, "legacy").Download(noProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := connector.ReadFileBytes("assets/indexes/legacy.json", -1)
+	if !json.Valid(data) || files[0].Sha != utils.BytesSHA1(data) || files[0].Size != int64(len(data)) {
+		t.Errorf("index entry %+v doesn't match the written index", files[0])
+	}
+}
@@ -0,0 +1,82 @@
+package builders
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+// DownloadToConnector streams the url to the connector, the sha1 is verified while streaming
+// If the checksum doesn't match, the remote file is discarded
+// The whole download is tried again if it fails with a transient error (see utils.DefaultRetryPolicy)
+func DownloadToConnector(connector connectors.Connector, url string, dest string, sha1 string, perm fs.FileMode) error {
+	return utils.DefaultRetryPolicy.Retry(func() error {
+		resp, err := utils.DoStreamRequest[[]byte](http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", url, err)
+		}
+		defer resp.Body.Close()
+
+		return copyToConnector(connector, resp.Body, dest, sha1, perm)
+	})
+}
+
+// copyToConnector streams the reader to the connector, the sha1 is verified while streaming (if not empty)
+func copyToConnector(connector connectors.Connector, r io.Reader, dest string, sha1 string, perm fs.FileMode) error {
+	w, err := connector.Create(dest, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+
+	reader := utils.NewSHA1Reader(r)
+	if _, err := io.Copy(w, reader); err != nil {
+		connectors.CancelWriter(w)
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+
+	if sha1 != "" && reader.Sum() != sha1 {
+		connectors.CancelWriter(w)
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", dest, sha1, reader.Sum())
+	}
+
+	return w.Close()
+}
+
+// downloadToTempFile streams the url to a temporary file, used for archives which need random access
+// The caller must close and remove the file
+func downloadToTempFile(url string) (*os.File, int64, error) {
+	var f *os.File
+	var size int64
+	err := utils.DefaultRetryPolicy.Retry(func() error {
+		var err error
+		f, size, err = downloadToTempFileOnce(url)
+		return err
+	})
+	return f, size, err
+}
+
+func downloadToTempFileOnce(url string) (*os.File, int64, error) {
+	resp, err := utils.DoStreamRequest[[]byte](http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	f, err := os.CreateTemp("", "launchygo-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	size, err := io.Copy(f, resp.Body)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	return f, size, nil
+}
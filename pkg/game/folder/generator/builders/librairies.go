@@ -72,7 +72,8 @@ func (l *LibrairiesBuilder) Download(pcb shared.ProgressCallback, debug bool) ([
 		nativeClassifiers, ok := rules.ExtractNativeClassifier(artifact, classifiers)
 		if ok {
 			nativesArtifacts = append(nativesArtifacts, nativeClassifiers...)
-			if nativeClassifiers != nil && len(nativeClassifiers) > 0 && nativeClassifiers[0].Artifact.Path == artifact.Path {
+			// Libraries with only native classifiers have no artifact
+			if artifact != nil && len(nativeClassifiers) > 0 && nativeClassifiers[0].Artifact.Path == artifact.Path {
 				continue
 			}
 		}
@@ -102,13 +103,10 @@ func (l *LibrairiesBuilder) Download(pcb shared.ProgressCallback, debug bool) ([
 			continue
 		}
 
-		dlBytes, err := shared.DownloadArtifact(artifact)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to download artifact")
+		if err := DownloadToConnector(l.Connector, artifact.URL, distPath, artifact.Sha1, 0644); err != nil {
+			return nil, nil, fmt.Errorf("failed to download artifact: %w", err)
 		}
 
-		l.Connector.SendFileFromBytes(distPath, dlBytes)
-
 		if pcb != nil {
 			pcb("Downloading libraries", downloadedLibrairies, totalLibrairies, library.Name)
 		} else if !debug {
@@ -2,18 +2,16 @@ package builders
 
 import (
 	"archive/zip"
-	"bytes"
 	"fmt"
-	"io"
-	"log"
+	"os"
 	"path/filepath"
 	"slices"
 
+	"limeal.fr/launchygo/pkg/connectors"
 	"limeal.fr/launchygo/pkg/game/folder"
 	"limeal.fr/launchygo/pkg/game/folder/generator/manifests"
 	"limeal.fr/launchygo/pkg/game/folder/rules"
 	"limeal.fr/launchygo/pkg/game/folder/shared"
-	"limeal.fr/launchygo/pkg/connectors"
 	"limeal.fr/launchygo/pkg/utils"
 )
 
@@ -48,33 +46,39 @@ func (l *NativesBuilder) constructDynamicLibrary(zipReader *zip.Reader, rules []
 			continue
 		}
 
-		destPath := filepath.Join(l.GetFolderPath(), file.Name)
-
-		sourceFile, err := file.Open()
-		if err != nil {
-			return nil, fmt.Errorf("failed to open file in zip: %w", err)
+		// The entry names of the jar become paths of the game folder
+		if err := folder.ValidatePath(file.Name); err != nil {
+			return nil, fmt.Errorf("invalid native entry: %w", err)
 		}
-		defer sourceFile.Close()
+		destPath := filepath.Join(l.GetFolderPath(), file.Name)
 
-		bytes, err := io.ReadAll(sourceFile)
+		// Hash the entry while streaming it, the zip is only read once more if it must be uploaded
+		checksum, err := zipEntrySHA1(file)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read file: %w", err)
+			return nil, err
 		}
 
-		checksum := utils.BytesSHA1(bytes)
 		if l.Connector.HasFileWithChecksum(destPath, connectors.ChecksumTypeSHA1, checksum) {
 			continue
 		}
 
 		nativeFilesLocalized = append(nativeFilesLocalized, folder.FolderFile{
-			Size:  int64(len(bytes)),
+			Size:  int64(file.UncompressedSize64),
 			Path:  destPath,
 			Sha:   checksum,
 			Type:  "natives",
 			Rules: rules,
 		})
 
-		l.Connector.SendFileFromBytes(destPath, bytes)
+		sourceFile, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file in zip: %w", err)
+		}
+		err = copyToConnector(l.Connector, sourceFile, destPath, checksum, 0644)
+		sourceFile.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to send native to connector: %w", err)
+		}
 		foundCount++
 
 	}
@@ -82,27 +86,42 @@ func (l *NativesBuilder) constructDynamicLibrary(zipReader *zip.Reader, rules []
 	return nativeFilesLocalized, nil
 }
 
+func zipEntrySHA1(file *zip.File) (string, error) {
+	sourceFile, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file in zip: %w", err)
+	}
+	checksum, err := utils.ReaderSHA1(sourceFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return checksum, nil
+}
+
 func (l *NativesBuilder) Download(pcb shared.ProgressCallback, debug bool) ([]folder.FolderFile, error) {
 	totalNatives := len(l.Natives)
 	processedNatives := 0
 
 	natives := []folder.FolderFile{}
 	for _, artifact := range l.Natives {
-		artifactBytes, err := shared.DownloadArtifact(&artifact.Artifact)
+		// The jar is stored on disk instead of memory, zip needs random access
+		jarFile, size, err := downloadToTempFile(artifact.Artifact.URL)
 		if err != nil {
-			log.Fatal("failed to download artifact")
+			return nil, fmt.Errorf("failed to download artifact: %w", err)
 		}
 
-		readCloser := bytes.NewReader(artifactBytes)
-
-		zipReader, err := zip.NewReader(readCloser, int64(len(artifactBytes)))
+		zipReader, err := zip.NewReader(jarFile, size)
 		if err != nil {
-			log.Fatal("failed to create zip reader")
+			jarFile.Close()
+			os.Remove(jarFile.Name())
+			return nil, fmt.Errorf("failed to create zip reader for %s: %w", artifact.Artifact.Path, err)
 		}
 
 		nativeFilesLocalized, err := l.constructDynamicLibrary(zipReader, artifact.Rules)
+		jarFile.Close()
+		os.Remove(jarFile.Name())
 		if err != nil {
-			log.Fatal("failed to construct dynamic library")
+			return nil, fmt.Errorf("failed to construct dynamic library %s: %w", artifact.Artifact.Path, err)
 		}
 
 		natives = append(natives, nativeFilesLocalized...)
@@ -8,10 +8,10 @@ import (
 	"path/filepath"
 	"slices"
 
+	"limeal.fr/launchygo/pkg/connectors"
 	"limeal.fr/launchygo/pkg/game/folder"
 	"limeal.fr/launchygo/pkg/game/folder/generator/manifests"
 	"limeal.fr/launchygo/pkg/game/folder/shared"
-	"limeal.fr/launchygo/pkg/connectors"
 	"limeal.fr/launchygo/pkg/utils"
 )
 
@@ -21,6 +21,10 @@ type RuntimeBuilder struct {
 }
 
 func getJavaRuntimeFromVersion(platform shared.Platform, javaVersion string) (*manifests.JavaRuntime, error) {
+	if err := shared.LoadManifests(); err != nil {
+		return nil, err
+	}
+
 	var runtimes manifests.JavaRuntimes
 	switch platform {
 	case shared.PlatformMacosIntel:
@@ -123,19 +127,14 @@ func (r *RuntimeBuilder) Download(pcb shared.ProgressCallback) ([]folder.FolderF
 				continue
 			}
 
-			bytes, err := utils.DoRequest[[]byte](http.MethodGet, file.Downloads.Raw.URL, nil)
-			if err != nil {
-				return nil, fmt.Errorf("failed to download runtime file: %s", err)
-			}
-
 			mode := 0644
 			if file.Executable {
 				mode = 0755
 			}
 
-			err = r.Connector.SendFileFromBytes(filePath, bytes, fs.FileMode(mode))
+			err := DownloadToConnector(r.Connector, file.Downloads.Raw.URL, filePath, file.Downloads.Raw.Sha1, fs.FileMode(mode))
 			if err != nil {
-				return nil, fmt.Errorf("failed to send runtime file to connector: %s", err)
+				return nil, fmt.Errorf("failed to download runtime file: %s", err)
 			}
 
 			files = append(files, folder.FolderFile{
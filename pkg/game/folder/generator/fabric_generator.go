@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"limeal.fr/launchygo/pkg/game/folder"
 	"limeal.fr/launchygo/pkg/game/folder/generator/manifests"
 	"limeal.fr/launchygo/pkg/game/folder/shared"
 )
@@ -32,6 +33,7 @@ func InitFabricGenerator(packName string, fabricVersion string) *FabricGenerator
 	}
 
 	vanillaGenerator := InitVanillaGenerator(packName, manifest.InheritsFrom)
+	vanillaGenerator.Loader = folder.LOADER_FABRIC
 	return &FabricGenerator{
 		PackPath:         filepath.Join("packs", packName),
 		Version:          manifest.InheritsFrom,
@@ -44,7 +46,7 @@ func InitFabricGenerator(packName string, fabricVersion string) *FabricGenerator
 // Build
 // ///////////////////////////////////////////////////////////////////
 
-func (g *FabricGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
+func (g *FabricGenerator) Generate(debug bool, pCb shared.ProgressCallback) error {
 	libraries := g.VanillaGenerator.Manifest.Libraries
 	for _, library := range g.FabricManifest.Libraries {
 		libraries = append(libraries, library.ToVanillaLibrary())
@@ -62,5 +64,5 @@ func (g *FabricGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
 		g.VanillaGenerator.Manifest.Arguments.JVM = append(g.VanillaGenerator.Manifest.Arguments.JVM, arg)
 	}
 
-	g.VanillaGenerator.Generate(debug, pCb)
+	return g.VanillaGenerator.Generate(debug, pCb)
 }
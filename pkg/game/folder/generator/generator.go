@@ -5,5 +5,5 @@ import "limeal.fr/launchygo/pkg/game/folder/shared"
 // NOTE: A generator build the game
 
 type Generator interface {
-	Generate(debug bool, pCb shared.ProgressCallback)
+	Generate(debug bool, pCb shared.ProgressCallback) error
 }
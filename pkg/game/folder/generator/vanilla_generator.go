@@ -19,6 +19,7 @@ import (
 type VanillaGenerator struct {
 	PackPath string
 	Version  string
+	Loader   string // Loader of the generated pack, see folder.Manifest.Loader
 	Manifest manifests.VVersionManifest
 	Assets   manifests.AssetsManifest
 }
@@ -27,6 +28,10 @@ func InitVanillaGenerator(packName string, version string) *VanillaGenerator {
 	fmt.Println("[*] Initializing vanilla generator for version: ", version)
 	fmt.Println("[*] Pack name: ", packName)
 
+	if err := shared.LoadManifests(); err != nil {
+		log.Fatal(err)
+	}
+
 	versionInfo := manifests.VersionInfo{}
 	for _, v := range shared.MC_GLOBAL_MANIFEST.Versions {
 		if v.ID == version {
@@ -58,6 +63,7 @@ func InitVanillaGenerator(packName string, version string) *VanillaGenerator {
 	return &VanillaGenerator{
 		PackPath: filepath.Join("packs", packName),
 		Version:  version,
+		Loader:   folder.LOADER_VANILLA,
 		Manifest: manifest,
 		Assets:   assetsManifest,
 	}
@@ -67,23 +73,21 @@ func InitVanillaGenerator(packName string, version string) *VanillaGenerator {
 // Build
 // ///////////////////////////////////////////////////////////////////
 
-func (g *VanillaGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
-
-	targetChecksum := g.Manifest.Downloads["client"].Sha1
+func (g *VanillaGenerator) Generate(debug bool, pCb shared.ProgressCallback) error {
+	client := g.Manifest.Downloads["client"]
 
 	// Dont use connector here, we want to write the files in the pack folder
 	// or we can simulate a file connector
-	fileConnector := connectors.FindConnectorFromURI(fmt.Sprintf("file://./%s", g.PackPath))
+	fileConnector, err := connectors.NewConnector(fmt.Sprintf("file://./%s", g.PackPath))
+	if err != nil {
+		return fmt.Errorf("failed to open pack folder: %w", err)
+	}
 
-	exists := fileConnector.HasFileWithChecksum(shared.JAR_FILE, connectors.ChecksumTypeSHA1, targetChecksum)
-	if !exists {
+	if !fileConnector.HasFileWithChecksum(shared.JAR_FILE, connectors.ChecksumTypeSHA1, client.Sha1) {
 		fmt.Println("[*] Downloading client jar")
-		bytes, err := utils.DoRequest[[]byte](http.MethodGet, g.Manifest.Downloads["client"].URL, nil)
-		if err != nil {
-			log.Fatal("failed to download client jar")
+		if err := builders.DownloadToConnector(fileConnector, client.URL, shared.JAR_FILE, client.Sha1, 0644); err != nil {
+			return fmt.Errorf("failed to download client jar: %w", err)
 		}
-		fmt.Println("[*] Sending client jar to connector")
-		fileConnector.SendFileFromBytes(shared.JAR_FILE, bytes)
 	}
 
 	// If Java version is defined in manifest, add the runtime builder
@@ -92,12 +96,12 @@ func (g *VanillaGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
 		fmt.Println("[*] Downloading runtime")
 		runtimeBuilder, err := builders.NewRuntimeBuilder(fileConnector, g.Manifest.JavaVersion.Component)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		runtimeFiles, err = runtimeBuilder.Download(pCb)
 		if err != nil {
-			log.Fatal("failed to download runtime: ", err)
+			return fmt.Errorf("failed to download runtime: %w", err)
 		}
 
 		fmt.Println("[*] Number of runtime files: ", len(runtimeFiles))
@@ -108,7 +112,7 @@ func (g *VanillaGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
 	assetsBuilder := builders.NewAssetBuilder(fileConnector, &g.Assets, g.Manifest.AssetIndex.ID)
 	assets, err := assetsBuilder.Download(pCb)
 	if err != nil {
-		log.Fatal("failed to download assets")
+		return fmt.Errorf("failed to download assets: %w", err)
 	}
 
 	fmt.Println("[*] Number of assets: ", len(assets))
@@ -117,7 +121,7 @@ func (g *VanillaGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
 	librariesBuilder := builders.NewLibrairiesBuilder(fileConnector, g.Manifest.Libraries)
 	librairies, natives, err := librariesBuilder.Download(pCb, debug)
 	if err != nil {
-		log.Fatal("failed to download libraries")
+		return fmt.Errorf("failed to download libraries: %w", err)
 	}
 
 	fmt.Println("[*] Number of libraries: ", len(librairies))
@@ -126,16 +130,16 @@ func (g *VanillaGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
 	nativesBuilder := builders.NewNativesBuilder(fileConnector, natives)
 	nativeFiles, err := nativesBuilder.Download(pCb, debug)
 	if err != nil {
-		log.Fatal("failed to download natives")
+		return fmt.Errorf("failed to download natives: %w", err)
 	}
 
 	fmt.Println("[*] Number of natives: ", len(nativeFiles))
 
 	// Also append the client jar
 	files := []folder.FolderFile{{
-		Size: g.Manifest.Downloads["client"].Size,
+		Size: client.Size,
 		Path: shared.JAR_FILE,
-		Sha:  g.Manifest.Downloads["client"].Sha1,
+		Sha:  client.Sha1,
 		Type: "jar",
 	}}
 
@@ -149,6 +153,8 @@ func (g *VanillaGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
 
 	// Create the manifest and send it to the connector
 	manifest := folder.Manifest{
+		Name:       filepath.Base(g.PackPath),
+		Loader:     g.Loader,
 		Version:    g.Version,
 		MainClass:  g.Manifest.MainClass,
 		McVersion:  g.Manifest.Version,
@@ -161,13 +167,16 @@ func (g *VanillaGenerator) Generate(debug bool, pCb shared.ProgressCallback) {
 		manifest.JavaBinaries = make(map[shared.Platform]string)
 		manifest.JavaBinaries[shared.PlatformMacosArm] = fmt.Sprintf("runtime/%s/jre.bundle/Contents/Home/bin/java", shared.PlatformMacosArm)
 		manifest.JavaBinaries[shared.PlatformMacosIntel] = fmt.Sprintf("runtime/%s/jre.bundle/Contents/Home/bin/java", shared.PlatformMacosIntel)
-		manifest.JavaBinaries[shared.PlatformWindows] = fmt.Sprintf("runtime\\%s\\bin\\java.exe", shared.PlatformWindows)
+		manifest.JavaBinaries[shared.PlatformWindows] = fmt.Sprintf("runtime/%s/bin/java.exe", shared.PlatformWindows)
 		manifest.JavaBinaries[shared.PlatformLinux] = fmt.Sprintf("runtime/%s/bin/java", shared.PlatformLinux)
 	}
 
 	manifestStr, err := json.MarshalIndent(manifest, "", "\t")
 	if err != nil {
-		log.Fatal("failed to marshal manifest")
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := fileConnector.SendFileFromBytes(shared.MANIFEST_FILE, manifestStr); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
 	}
-	fileConnector.SendFileFromBytes(shared.MANIFEST_FILE, manifestStr)
+	return nil
 }
@@ -0,0 +1,141 @@
+package generator
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder"
+	"limeal.fr/launchygo/pkg/game/folder/generator/manifests"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+	"limeal.fr/launchygo/pkg/game/folder/shared/mojangtest"
+)
+
+func noProgress(string, int, int, string) {}
+
+// chdir changes the working directory until the end of the test (the packs are generated in ./packs)
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(pwd) })
+}
+
+func TestVanillaGeneratorThenBuild(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	libraries := []manifests.Library{
+		server.AddLibrary("com.example:foo:1.0", []byte("foo")),
+		server.AddNativeLibrary("org.lwjgl:lwjgl:3.3.1", "linux", map[string][]byte{"liblwjgl.so": []byte("so")}),
+	}
+	server.AddVersion("1.20.1", []byte("client"), libraries, map[string][]byte{"icon.png": []byte("icon")})
+	chdir(t, t.TempDir())
+
+	if versions := shared.GetVersions(true); len(versions) != 1 || versions[0] != "1.20.1" {
+		t.Fatalf("versions = %v, want [1.20.1]", versions)
+	}
+
+	if err := InitVanillaGenerator("my-pack", "1.20.1").Generate(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+
+	connector, err := connectors.NewConnector("file://./packs/my-pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest folder.Manifest
+	if err := connector.ReadFile(shared.MANIFEST_FILE, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Version != "1.20.1" || manifest.MainClass != shared.MainClass || manifest.AssetIndex != "1.20.1" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if len(manifest.Arguments.Game) == 0 || len(manifest.Arguments.JVM) == 0 {
+		t.Error("the arguments of the version are not in the manifest")
+	}
+
+	types := map[string]int{}
+	for _, file := range manifest.Files {
+		types[file.Type]++
+		if !connector.HasFileWithChecksum(file.Path, connectors.ChecksumTypeSHA1, file.Sha) {
+			t.Errorf("%s missing or with a wrong checksum", file.Path)
+		}
+	}
+	// assets: the index and one object
+	if want := map[string]int{"jar": 1, "assets": 2, "libraries": 1, "natives": 1}; !maps.Equal(types, want) {
+		t.Errorf("files by type = %v, want %v", types, want)
+	}
+
+	// The generated pack can be built as is
+	gameFolder := &folder.GameFolder{Path: t.TempDir(), Manifest: manifest, Connector: connector}
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(gameFolder.Path, shared.JAR_FILE)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVanillaGeneratorWithRuntime(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	version := server.AddVersion("1.20.1", []byte("client"), nil, nil)
+	json.Unmarshal([]byte(`{"component":"java-runtime-gamma","majorVersion":17}`), &version.JavaVersion)
+	server.SetVersionManifest(version)
+	server.AddRuntime("java-runtime-gamma", map[string][]byte{"bin/java": []byte("java"), "bin/java.exe": []byte("java.exe")})
+	chdir(t, t.TempDir())
+
+	if err := InitVanillaGenerator("my-pack", "1.20.1").Generate(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+
+	connector, err := connectors.NewConnector("file://./packs/my-pack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameFolder, err := folder.InitGameFolder(connector, "game", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The paths of the java binaries are valid on every platform
+	if binary := gameFolder.Manifest.JavaBinaries[shared.PlatformWindows]; binary != "runtime/windows/bin/java.exe" {
+		t.Errorf("windows java binary = %q", binary)
+	}
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	runtime, err := gameFolder.GetRuntime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(runtime); err != nil {
+		t.Errorf("java binary of %s not installed: %v", shared.PLATFORM, err)
+	}
+}
+
+func TestVanillaGeneratorClientChecksumMismatch(t *testing.T) {
+	server := mojangtest.NewServer(t)
+	version := server.AddVersion("1.20.1", []byte("client"), nil, nil)
+	server.SetFile(version.Downloads["client"].URL, []byte("corrupted"))
+	chdir(t, t.TempDir())
+
+	err := InitVanillaGenerator("my-pack", "1.20.1").Generate(false, noProgress)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("err = %v, want a checksum mismatch", err)
+	}
+	// Neither the corrupted jar nor a manifest referencing it are written
+	for _, file := range []string{shared.JAR_FILE, shared.MANIFEST_FILE} {
+		if _, err := os.Stat(filepath.Join("packs", "my-pack", file)); !os.IsNotExist(err) {
+			t.Errorf("%s written: %v", file, err)
+		}
+	}
+}
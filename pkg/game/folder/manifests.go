@@ -16,6 +16,29 @@ type FolderFile struct {
 	Type       string           `json:"type"` // assets, libraries, natives
 	Rules      []manifests.Rule `json:"rules,omitempty"`
 	Executable bool             `json:"executable,omitempty"` // If set to true, on dl set the file with 0755 permissions
+	Patches    []FilePatch      `json:"patches,omitempty"`    // Binary deltas from the previous versions of the file
+	Chunks     []FileChunk      `json:"chunks,omitempty"`     // If set, the file is stored as chunks in the chunk store instead of at Path
+
+	// If set, the file is stored compressed at Path + the extension of the compression (e.g. .gz)
+	// Size and Sha are the ones of the uncompressed file
+	Compression    Compression `json:"compression,omitempty"`
+	CompressedSize int64       `json:"compressedSize,omitempty"`
+
+	archived bool // The content isn't at Path anymore, it is downloaded from shared.ARCHIVE_DIR (pinned revisions)
+}
+
+// FilePatch turns a previous version of the file (BaseSha) into the current one, see the delta package
+type FilePatch struct {
+	Path    string `json:"path"`    // Path of the patch on the connector, e.g. patches/<baseSha>-<sha>.patch
+	BaseSha string `json:"baseSha"` // sha1 of the file the patch applies to
+	Sha     string `json:"sha"`     // sha1 of the patch
+	Size    int64  `json:"size"`
+}
+
+// FileChunk is a part of a file, stored once in the chunk store whatever the number of files, versions and packs using it
+type FileChunk struct {
+	Sha  string `json:"sha"` // sha1 of the chunk, its path is <chunkStore>/<sha[:2]>/<sha>
+	Size int64  `json:"size"`
 }
 
 type ManifestArgumentWithRules struct {
@@ -28,6 +51,12 @@ type ManifestArguments struct {
 	JVM  []any `json:"jvm"`  // Either a string or a ManifestArgumentWithRules
 }
 
+// Loaders of the generated packs, see Manifest.Loader
+const (
+	LOADER_VANILLA = "vanilla"
+	LOADER_FABRIC  = "fabric"
+)
+
 type Manifest struct {
 	MainClass  string            `json:"mainClass"`
 	Version    string            `json:"version"`
@@ -40,6 +69,22 @@ type Manifest struct {
 	// "windows": "runtime/windows/bin/java.exe"
 	// "linux": "runtime/linux/bin/java"
 
+	// Directory of the chunks relative to the pack (shared.CHUNKS_DIR by default)
+	// Ex: "../.chunks" to share the chunks between the packs published next to each other
+	ChunkStore string `json:"chunkStore,omitempty"`
+
+	// Shown by the launchers in the catalog of the packs (see ReadCatalog)
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`   // Path of the icon in the pack, e.g. icon.png
+	Loader      string `json:"loader,omitempty"` // vanilla, fabric...
+
+	// Set by PublishGameFolder: the revision increases with each publish, the previous ones stay in shared.MANIFESTS_DIR
+	Revision    int    `json:"revision,omitempty"`
+	ReleaseDate string `json:"releaseDate,omitempty"` // RFC 3339
+	Changelog   string `json:"changelog,omitempty"`
+	Channel     string `json:"channel,omitempty"` // Release channel of the revision, see PublishOptions.Channel
+
 	// Served has "os book" to only pick elements for the current os
 	Files []FolderFile `json:"files"`
 }
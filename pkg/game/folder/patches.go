@@ -0,0 +1,158 @@
+package folder
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/delta"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+// minDeltaFileSize is the size under which the changed files are downloaded again instead of patched
+const minDeltaFileSize = 64 * 1024
+
+// maxDeltaRatio is the max size of a patch compared to its file, bigger patches are not worth it
+const maxDeltaRatio = 0.5
+
+// errNoPatch is returned when no patch applies to the local file, the file is downloaded instead
+var errNoPatch = errors.New("no patch for the local file")
+
+/////////////////////////////////////////////////////////////////////
+// Publish
+/////////////////////////////////////////////////////////////////////
+
+// publishPatch sends the patch from the previous version of the file (still on the connector) to the local file
+// It returns nil when a patch isn't worth it: small file, unknown previous version, too many changes...
+func publishPatch(connector connectors.Connector, previous FolderFile, localPath string, sha string) (*FilePatch, error) {
+	if previous.Sha == "" || previous.Sha == sha {
+		return nil, nil
+	}
+	target, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(target) < minDeltaFileSize {
+		return nil, nil
+	}
+
+	// The previous version is downloaded before being replaced
+	base, err := os.CreateTemp("", "launchygo-base-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(base.Name())
+	defer base.Close()
+
+	rc, err := openFolderFile(connector, previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the previous version: %w", err)
+	}
+	reader := utils.NewSHA1Reader(rc)
+	baseSize, err := io.Copy(base, reader)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the previous version: %w", err)
+	}
+	if reader.Sum() != previous.Sha {
+		// The remote file doesn't match the previous manifest, the players don't have this version either
+		return nil, nil
+	}
+
+	patch, err := delta.Diff(base, baseSize, target)
+	if err != nil {
+		return nil, err
+	}
+	if float64(len(patch)) > float64(len(target))*maxDeltaRatio {
+		return nil, nil
+	}
+
+	filePatch := &FilePatch{
+		Path:    path.Join(shared.PATCHES_DIR, previous.Sha+"-"+sha+".patch"),
+		BaseSha: previous.Sha,
+		Sha:     utils.BytesSHA1(patch),
+		Size:    int64(len(patch)),
+	}
+	if err := connector.SendFileFromBytes(filePatch.Path, patch); err != nil {
+		return nil, err
+	}
+	return filePatch, nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// Build
+/////////////////////////////////////////////////////////////////////
+
+// patchFile updates the local file with the patch from its version, instead of downloading the whole file
+// The result is written in the .part file, then checked like a download and renamed to destPath
+func (g *GameFolder) patchFile(file FolderFile, basePath string, destPath string, tmpPath string, mode fs.FileMode, limiter *utils.RateLimiter) error {
+	// An interrupted download is resumed instead
+	if _, err := os.Stat(tmpPath); err == nil {
+		return errNoPatch
+	}
+	localSha := utils.FileSHA1(basePath)
+	var patch *FilePatch
+	for i := range file.Patches {
+		if file.Patches[i].BaseSha == localSha {
+			patch = &file.Patches[i]
+			break
+		}
+	}
+	if patch == nil {
+		return errNoPatch
+	}
+
+	rc, _, err := g.Connector.Open(patch.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read patch %s: %w", patch.Path, err)
+	}
+	data, err := io.ReadAll(limiter.Reader(rc))
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read patch %s: %w", patch.Path, err)
+	}
+	if utils.BytesSHA1(data) != patch.Sha {
+		return fmt.Errorf("checksum mismatch for patch %s", patch.Path)
+	}
+
+	base, err := os.Open(basePath)
+	if err != nil {
+		return err
+	}
+	stats, err := base.Stat()
+	if err != nil {
+		base.Close()
+		return err
+	}
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		base.Close()
+		return err
+	}
+
+	h := sha1.New()
+	_, err = delta.Apply(base, stats.Size(), bytes.NewReader(data), io.MultiWriter(out, h))
+	base.Close()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != file.Sha {
+		err = fmt.Errorf("checksum mismatch for %s after patch", file.Path)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, destPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to patch %s: %w", file.Path, err)
+	}
+	return nil
+}
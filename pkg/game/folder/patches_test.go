@@ -0,0 +1,138 @@
+package folder
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+func randomContent(seed int64, n int) string {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return string(data)
+}
+
+// publishTwice publishes the pack, then changes mods/big.jar and publishes it again with deltas
+func publishTwice(t *testing.T, v1 string, v2 string) (*connectors.MemFS, Manifest) {
+	t.Helper()
+	dir := newLocalPack(t, map[string]string{"minecraft.jar": "client", "mods/big.jar": v1})
+
+	fsys := connectors.NewMemFS()
+	if err := PublishGameFolder(connectors.NewMemoryConnector(fsys, ""), "my-pack", PublishOptions{Deltas: true}); err != nil {
+		t.Fatal(err)
+	}
+	writePackFile(t, dir, "mods/big.jar", v2)
+	if err := PublishGameFolder(connectors.NewMemoryConnector(fsys, ""), "my-pack", PublishOptions{Deltas: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest Manifest
+	if err := connectors.NewMemoryConnector(fsys, "").ReadFile(shared.MANIFEST_FILE, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	return fsys, manifest
+}
+
+func findFile(manifest Manifest, path string) FolderFile {
+	for _, file := range manifest.Files {
+		if file.Path == path {
+			return file
+		}
+	}
+	return FolderFile{}
+}
+
+func TestPublishDeltas(t *testing.T) {
+	v1 := randomContent(1, 200*1024)
+	v2 := v1[:100000] + "new entry" + v1[100000:]
+	fsys, manifest := publishTwice(t, v1, v2)
+	connector := connectors.NewMemoryConnector(fsys, "")
+
+	patches := findFile(manifest, "mods/big.jar").Patches
+	if len(patches) != 1 {
+		t.Fatalf("patches = %+v, want one patch", patches)
+	}
+	if patches[0].Size > 8*1024 || !connector.HasFile(patches[0].Path) {
+		t.Errorf("patch = %+v, want a small patch on the remote", patches[0])
+	}
+	if patches := findFile(manifest, "minecraft.jar").Patches; len(patches) != 0 {
+		t.Errorf("unchanged file has patches %+v", patches)
+	}
+
+	// The patch is kept while the file doesn't change, then pruned
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{Deltas: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !connector.HasFile(patches[0].Path) {
+		t.Error("patch of the current version removed")
+	}
+	os.Remove(filepath.Join("packs", "my-pack", "mods", "big.jar"))
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{Deltas: true}); err != nil {
+		t.Fatal(err)
+	}
+	if connector.HasFile(patches[0].Path) {
+		t.Error("patch of a removed file not pruned")
+	}
+}
+
+func TestPublishSkipsSmallDeltas(t *testing.T) {
+	_, manifest := publishTwice(t, "small v1", "small v2")
+	if patches := findFile(manifest, "mods/big.jar").Patches; len(patches) != 0 {
+		t.Errorf("patches = %+v, want none for a small file", patches)
+	}
+}
+
+func TestBuildAppliesPatch(t *testing.T) {
+	v1 := randomContent(1, 200*1024)
+	v2 := v1[:100000] + "new entry" + v1[100000:]
+	fsys, manifest := publishTwice(t, v1, v2)
+
+	connector := &openRecorder{MemoryConnector: connectors.NewMemoryConnector(fsys, "")}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	writePackFile(t, gameFolder.Path, "minecraft.jar", "client")
+	writePackFile(t, gameFolder.Path, "mods/big.jar", v1)
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "mods", "big.jar")); got != v2 {
+		t.Error("patched file differs from the new version")
+	}
+	patch := findFile(manifest, "mods/big.jar").Patches[0]
+	if len(connector.opened) != 1 || connector.opened[0] != patch.Path {
+		t.Errorf("opened = %v, want only %s", connector.opened, patch.Path)
+	}
+}
+
+func TestBuildFallsBackWithoutPatch(t *testing.T) {
+	v1 := randomContent(1, 200*1024)
+	v2 := v1[:100000] + "new entry" + v1[100000:]
+	fsys, manifest := publishTwice(t, v1, v2)
+
+	// The local file is neither the previous version nor the new one
+	connector := &openRecorder{MemoryConnector: connectors.NewMemoryConnector(fsys, "")}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	writePackFile(t, gameFolder.Path, "mods/big.jar", randomContent(2, 1000))
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "mods", "big.jar")); got != v2 {
+		t.Error("downloaded file differs from the new version")
+	}
+
+	// A corrupted patch is refused and the file downloaded
+	patch := findFile(manifest, "mods/big.jar").Patches[0]
+	connector.SendFileFromBytes(patch.Path, []byte("corrupted"))
+	writePackFile(t, gameFolder.Path, "mods/big.jar", v1)
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "mods", "big.jar")); got != v2 {
+		t.Error("downloaded file differs from the new version")
+	}
+}
@@ -0,0 +1,157 @@
+package folder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+// revisionPath returns the path of the manifest of the revision on the connector, relative to the pack
+func revisionPath(revision int) string {
+	return path.Join(shared.MANIFESTS_DIR, strconv.Itoa(revision)+".json")
+}
+
+// revisionSignaturePath returns the path of the signature of the manifest of the revision
+func revisionSignaturePath(revision int) string {
+	return revisionPath(revision) + ".sig"
+}
+
+// archivePath returns the path of the archived content of the file, named by its checksum
+func (f FolderFile) archivePath() string {
+	if len(f.Sha) < 2 {
+		return path.Join(shared.ARCHIVE_DIR, f.Sha+f.extension())
+	}
+	return path.Join(shared.ARCHIVE_DIR, f.Sha[:2], f.Sha+f.extension())
+}
+
+/////////////////////////////////////////////////////////////////////
+// Publish
+/////////////////////////////////////////////////////////////////////
+
+// archiveFile copies the published content of the file in the archive before it is replaced or removed,
+// the manifests of the previous revisions still use it. The chunks are never removed, they aren't archived
+func archiveFile(connector connectors.Connector, file FolderFile) error {
+	if len(file.Chunks) > 0 || file.Sha == "" {
+		return nil
+	}
+	dest := file.archivePath()
+	if connector.HasFile(dest) {
+		return nil
+	}
+
+	rc, _, err := connector.Open(file.remotePath())
+	if err != nil {
+		if !connector.HasFile(file.remotePath()) {
+			// Nothing to keep, the previous publish didn't send it
+			return nil
+		}
+		return fmt.Errorf("failed to archive %s: %w", file.Path, err)
+	}
+	defer rc.Close()
+
+	w, err := connector.Create(dest, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %w", file.Path, err)
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		connectors.CancelWriter(w)
+		return fmt.Errorf("failed to archive %s: %w", file.Path, err)
+	}
+	return w.Close()
+}
+
+// publishRevision sends the manifest of the revision next to the others, with its signature
+func publishRevision(connector connectors.Connector, manifest Manifest, data []byte, signature []byte) error {
+	if err := connector.SendFileFromBytes(revisionPath(manifest.Revision), data); err != nil {
+		return err
+	}
+	if signature != nil {
+		return connector.SendFileFromBytes(revisionSignaturePath(manifest.Revision), signature)
+	}
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// Launch
+/////////////////////////////////////////////////////////////////////
+
+/**
+* List the revisions of the pack published on the connector, sorted from the oldest
+* Example:
+* ```
+* revisions, err := folder.ListRevisions(connector)
+* gameFolder, err := folder.InitGameFolderAt(connector, "my-pack", revisions[len(revisions)-2])
+* ```
+ */
+func ListRevisions(connector connectors.Connector) ([]int, error) {
+	entries, err := connector.List(shared.MANIFESTS_DIR)
+	if err != nil {
+		if !connector.HasFile(shared.MANIFEST_FILE) {
+			return nil, err
+		}
+		// Published before the revisions
+		return []int{}, nil
+	}
+
+	revisions := []int{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		if revision, err := strconv.Atoi(name); err == nil && revision > 0 {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Ints(revisions)
+	return revisions, nil
+}
+
+// readRevision reads, verifies and validates the manifest of the revision
+func readRevision(connector connectors.Connector, revision int) (Manifest, error) {
+	var manifest Manifest
+	data, err := readManifest(connector, revisionPath(revision), revisionSignaturePath(revision))
+	if err != nil {
+		return manifest, fmt.Errorf("revision %d: %w", revision, err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("revision %d: %w", revision, err)
+	}
+	normalizeLegacyPaths(&manifest)
+	if manifest.Revision != revision {
+		return manifest, fmt.Errorf("revision %d: the manifest is the revision %d", revision, manifest.Revision)
+	}
+	if err := ValidateManifest(manifest); err != nil {
+		return manifest, fmt.Errorf("revision %d: %w", revision, err)
+	}
+	return manifest, nil
+}
+
+// pinRevision downloads the files of the pinned revision which were replaced since from the archive
+func pinRevision(latest Manifest, pinned Manifest) Manifest {
+	published := make(map[string]FolderFile, len(latest.Files))
+	for _, file := range latest.Files {
+		published[file.Path] = file
+	}
+
+	files := make([]FolderFile, len(pinned.Files))
+	for i, file := range pinned.Files {
+		current, ok := published[file.Path]
+		live := ok && current.Sha == file.Sha && current.Compression == file.Compression && len(current.Chunks) == 0
+		if len(file.Chunks) == 0 && !live {
+			file.archived = true
+			// The patches of the revision may have been removed since, the whole file is downloaded
+			file.Patches = nil
+		}
+		files[i] = file
+	}
+	pinned.Files = files
+	return pinned
+}
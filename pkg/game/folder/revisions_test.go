@@ -0,0 +1,130 @@
+package folder
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+// withoutArchive drops the archived files from the uploaded paths
+func withoutArchive(paths []string) []string {
+	return slices.DeleteFunc(slices.Clone(paths), func(p string) bool {
+		return strings.HasPrefix(p, shared.ARCHIVE_DIR+"/")
+	})
+}
+
+// publishRevisions publishes two revisions of the pack: minecraft.jar is replaced and mods/a.jar removed by the second
+func publishRevisions(t *testing.T, options PublishOptions) *connectors.MemoryConnector {
+	t.Helper()
+	dir := newLocalPack(t, map[string]string{"minecraft.jar": "v1", "mods/a.jar": "a"})
+	connector := connectors.NewMemoryConnector(connectors.NewMemFS(), "")
+
+	options.Changelog = "First release"
+	if err := PublishGameFolder(connector, "my-pack", options); err != nil {
+		t.Fatal(err)
+	}
+	writePackFile(t, dir, "minecraft.jar", "v2")
+	os.Remove(filepath.Join(dir, "mods", "a.jar"))
+	options.Changelog = "Remove a.jar"
+	if err := PublishGameFolder(connector, "my-pack", options); err != nil {
+		t.Fatal(err)
+	}
+	return connector
+}
+
+func TestPublishRevisions(t *testing.T) {
+	connector := publishRevisions(t, PublishOptions{})
+
+	var manifest Manifest
+	if err := connector.ReadFile(shared.MANIFEST_FILE, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Revision != 2 || manifest.Changelog != "Remove a.jar" {
+		t.Errorf("revision %d %q, want 2 with its changelog", manifest.Revision, manifest.Changelog)
+	}
+	if _, err := time.Parse(time.RFC3339, manifest.ReleaseDate); err != nil {
+		t.Errorf("release date: %v", err)
+	}
+
+	revisions, err := ListRevisions(connector)
+	if err != nil || !slices.Equal(revisions, []int{1, 2}) {
+		t.Fatalf("revisions = %v, %v, want [1 2]", revisions, err)
+	}
+	var first Manifest
+	if err := connector.ReadFile(revisionPath(1), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Revision != 1 || first.Changelog != "First release" || len(first.Files) != 2 {
+		t.Errorf("revision 1 = %+v, want the first publish", first)
+	}
+
+	// The replaced and removed files are archived
+	for _, file := range first.Files {
+		if !connector.HasFile(file.archivePath()) {
+			t.Errorf("%s not archived", file.Path)
+		}
+	}
+	if connector.HasFile("mods/a.jar") {
+		t.Error("mods/a.jar was not removed from the pack")
+	}
+}
+
+func TestInitGameFolderAtRevision(t *testing.T) {
+	connector := publishRevisions(t, PublishOptions{})
+
+	gameFolder, err := InitGameFolderAt(connector, "pinned", 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gameFolder.Manifest.Revision != 1 {
+		t.Fatalf("revision = %d, want 1", gameFolder.Manifest.Revision)
+	}
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{"minecraft.jar": "v1", "mods/a.jar": "a"} {
+		if got := readFile(t, filepath.Join(gameFolder.Path, path)); got != content {
+			t.Errorf("%s = %q, want %q", path, got, content)
+		}
+	}
+
+	// The latest revision upgrades the pinned one
+	latest, err := InitGameFolder(connector, "pinned", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := latest.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := listFiles(t, latest.Path); !slices.Equal(got, []string{"minecraft.jar"}) {
+		t.Errorf("files = %v, want [minecraft.jar]", got)
+	}
+
+	if _, err := InitGameFolderAt(connector, "pinned", 7, true); err == nil {
+		t.Error("missing revision accepted")
+	}
+}
+
+func TestInitGameFolderAtRevisionVerifiesSignature(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	connector := publishRevisions(t, PublishOptions{SigningKey: private})
+	trustKey(t, public)
+
+	if _, err := InitGameFolderAt(connector, "pinned", 1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := connector.ReadFileBytes(revisionPath(1), -1)
+	connector.SendFileFromBytes(revisionPath(1), []byte(strings.Replace(string(data), "First release", "Tampered", 1)))
+	if _, err := InitGameFolderAt(connector, "pinned", 1, true); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("err = %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,75 @@
+package folder
+
+import (
+	"runtime"
+	"slices"
+
+	"limeal.fr/launchygo/pkg/connectors"
+)
+
+// DefaultDownloadPriorities downloads what the game needs to start first, the assets last
+// The files of an unknown type are downloaded with the extra files
+var DefaultDownloadPriorities = map[string]int{
+	"jar":       0,
+	"libraries": 1,
+	"natives":   2,
+	"runtime":   3,
+	"extra":     4,
+	"assets":    5,
+}
+
+/**
+* Settings of the downloads of GameFolder.Build, the zero value downloads with one worker per CPU without bandwidth limit
+* Example:
+* ```
+* gameFolder.Scheduler = folder.DownloadScheduler{
+*     MaxConcurrency:       8,
+*     ConnectorConcurrency: map[string]int{connectors.SFTP_SCHEME: 2},
+*     BytesPerSecond:       2 * 1024 * 1024, // 2 MiB/s
+* }
+* ```
+ */
+type DownloadScheduler struct {
+	MaxConcurrency       int            // Number of parallel downloads, 0 for one per CPU
+	ConnectorConcurrency map[string]int // Max parallel downloads by connector scheme (e.g. "sftp"), on top of the limit of the connector itself
+	BytesPerSecond       int64          // Bandwidth shared by all the downloads, 0 for no limit
+	Priorities           map[string]int // Download order by file type (lower first), nil for DefaultDownloadPriorities
+}
+
+// concurrency returns the number of workers to download count files from the connector
+func (s DownloadScheduler) concurrency(connector connectors.Connector, count int) int {
+	workers := s.MaxConcurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if connector != nil {
+		if limit := s.ConnectorConcurrency[connector.GetScheme()]; limit > 0 {
+			workers = min(workers, limit)
+		}
+		if limiter, ok := connectors.As[connectors.ConcurrencyLimiter](connector); ok && limiter.MaxConcurrency() > 0 {
+			workers = min(workers, limiter.MaxConcurrency())
+		}
+	}
+	return max(1, min(workers, count))
+}
+
+// priority returns the download priority of a file type
+func (s DownloadScheduler) priority(fileType string) int {
+	priorities := s.Priorities
+	if priorities == nil {
+		priorities = DefaultDownloadPriorities
+	}
+	if priority, ok := priorities[fileType]; ok {
+		return priority
+	}
+	return priorities["extra"]
+}
+
+// order returns the files sorted by priority, the manifest order is kept for the files of the same priority
+func (s DownloadScheduler) order(files []FolderFile) []FolderFile {
+	ordered := slices.Clone(files)
+	slices.SortStableFunc(ordered, func(a, b FolderFile) int {
+		return s.priority(a.Type) - s.priority(b.Type)
+	})
+	return ordered
+}
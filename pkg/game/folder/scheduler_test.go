@@ -0,0 +1,180 @@
+package folder
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+// openRecorder records the order of the downloads and the max number of files open at the same time
+type openRecorder struct {
+	*connectors.MemoryConnector
+	limit int // MaxConcurrency of the connector, 0 for none
+
+	mu      sync.Mutex
+	opened  []string
+	open    int
+	maxOpen int
+}
+
+func (c *openRecorder) Open(remotePath string) (io.ReadCloser, int64, error) {
+	c.mu.Lock()
+	c.opened = append(c.opened, remotePath)
+	c.open++
+	c.maxOpen = max(c.maxOpen, c.open)
+	c.mu.Unlock()
+
+	// Let the other workers open their file
+	time.Sleep(5 * time.Millisecond)
+
+	rc, size, err := c.MemoryConnector.Open(remotePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &recordedReader{ReadCloser: rc, recorder: c}, size, nil
+}
+
+// OpenRange records the download like Open, the files are never resumed
+func (c *openRecorder) OpenRange(remotePath string, offset int64, ifRange string) (io.ReadCloser, int64, string, bool, error) {
+	rc, size, err := c.Open(remotePath)
+	return rc, size, "", false, err
+}
+
+type recordedReader struct {
+	io.ReadCloser
+	recorder *openRecorder
+}
+
+func (r *recordedReader) Close() error {
+	r.recorder.mu.Lock()
+	r.recorder.open--
+	r.recorder.mu.Unlock()
+	return r.ReadCloser.Close()
+}
+
+type limitedRecorder struct {
+	*openRecorder
+}
+
+func (c *limitedRecorder) MaxConcurrency() int {
+	return c.limit
+}
+
+func TestBuildDownloadsByPriority(t *testing.T) {
+	memConnector, manifest := newRemotePack(t, map[string]string{
+		"assets/objects/ab/abcdef":  "asset",
+		"config/options.json":       "{}",
+		"libraries/com/foo/foo.jar": "foo",
+		"minecraft.jar":             "client",
+		"natives/liblwjgl.so":       "so",
+		"runtime/bin/java":          "java",
+	})
+	types := map[string]string{
+		"assets/objects/ab/abcdef": "assets",
+		"config/options.json":      "extra",
+		"minecraft.jar":            "jar",
+		"natives/liblwjgl.so":      "natives",
+		"runtime/bin/java":         "runtime",
+	}
+	for i, file := range manifest.Files {
+		if fileType, ok := types[file.Path]; ok {
+			manifest.Files[i].Type = fileType
+		}
+	}
+
+	connector := &openRecorder{MemoryConnector: memConnector}
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	gameFolder.Scheduler.MaxConcurrency = 1
+
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"minecraft.jar",
+		"libraries/com/foo/foo.jar",
+		"natives/liblwjgl.so",
+		"runtime/bin/java",
+		"config/options.json",
+		"assets/objects/ab/abcdef",
+	}
+	if !slices.Equal(connector.opened, want) {
+		t.Errorf("download order = %v, want %v", connector.opened, want)
+	}
+}
+
+func TestBuildLimitsConcurrency(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("libraries/%d.jar", i)] = fmt.Sprint(i)
+	}
+
+	tests := []struct {
+		name      string
+		scheduler DownloadScheduler
+		limit     int
+		want      int
+	}{
+		{"max concurrency", DownloadScheduler{MaxConcurrency: 3}, 0, 3},
+		{"connector scheme", DownloadScheduler{MaxConcurrency: 8, ConnectorConcurrency: map[string]int{connectors.MEM_SCHEME: 2}}, 0, 2},
+		{"connector limit", DownloadScheduler{MaxConcurrency: 8}, 4, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memConnector, manifest := newRemotePack(t, files)
+			recorder := &openRecorder{MemoryConnector: memConnector, limit: test.limit}
+			var connector connectors.Connector = recorder
+			if test.limit > 0 {
+				connector = &limitedRecorder{recorder}
+			}
+			gameFolder := newTestGameFolder(t, connector, manifest)
+			gameFolder.Scheduler = test.scheduler
+
+			if err := gameFolder.Build(false, noProgress); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.maxOpen > test.want {
+				t.Errorf("%d parallel downloads, want at most %d", recorder.maxOpen, test.want)
+			}
+			if len(recorder.opened) != len(files) {
+				t.Errorf("%d files downloaded, want %d", len(recorder.opened), len(files))
+			}
+		})
+	}
+}
+
+func TestSchedulerConcurrency(t *testing.T) {
+	memConnector := connectors.NewMemoryConnector(connectors.NewMemFS(), "")
+	connector := connectors.WithRetry(&limitedRecorder{&openRecorder{MemoryConnector: memConnector, limit: 2}}, utils.DefaultRetryPolicy)
+
+	if n := (DownloadScheduler{MaxConcurrency: 8}).concurrency(connector, 100); n != 2 {
+		t.Errorf("concurrency = %d, want the limit of the wrapped connector (2)", n)
+	}
+	if n := (DownloadScheduler{MaxConcurrency: 8}).concurrency(nil, 3); n != 3 {
+		t.Errorf("concurrency = %d, want the number of files (3)", n)
+	}
+}
+
+func TestBuildLimitsBandwidth(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{
+		"minecraft.jar":             string(make([]byte, 3000)),
+		"libraries/com/foo/foo.jar": string(make([]byte, 3000)),
+	})
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	gameFolder.Scheduler.BytesPerSecond = 4000
+
+	start := time.Now()
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	// The bucket starts with 4000 bytes, the last 2000 bytes are sent at 4000 B/s
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("build took %v, want about 500ms", elapsed)
+	}
+}
@@ -1,22 +1,17 @@
 package shared
 
 import (
-	"io"
-	"log"
+	"fmt"
 	"net/http"
 
 	"limeal.fr/launchygo/pkg/game/folder/generator/manifests"
+	"limeal.fr/launchygo/pkg/utils"
 )
 
 func DownloadArtifact(artifact *manifests.Artifact) ([]byte, error) {
-	resp, err := http.Get(artifact.URL)
+	body, err := utils.DoRequest[[]byte](http.MethodGet, artifact.URL, nil)
 	if err != nil {
-		log.Fatal("failed to download artifact")
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal("failed to read artifact")
+		return nil, fmt.Errorf("failed to download artifact %s: %w", artifact.URL, err)
 	}
 
 	return body, nil
@@ -3,12 +3,12 @@ package shared
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"runtime"
+	"sync"
 
 	"limeal.fr/launchygo/pkg/game/folder/generator/manifests"
+	"limeal.fr/launchygo/pkg/utils"
 )
 
 type Directory string
@@ -31,6 +31,10 @@ const (
 )
 
 func (p Platform) GetRuntimes() (*manifests.JavaRuntimes, error) {
+	if err := LoadManifests(); err != nil {
+		return nil, err
+	}
+
 	switch p {
 	case PlatformMacosIntel:
 		return &RUNTIME_MANIFEST.Macos, nil
@@ -90,8 +94,11 @@ func (p Platform) CreateRules() []manifests.Rule {
 
 type ProgressCallback func(section string, current int, total int, description string)
 
-const PISTON_MANIFEST_URL = "https://piston-meta.mojang.com/mc/game/version_manifest.json"
-const RUNTIME_MANIFEST_URL = "https://launchermeta.mojang.com/v1/products/java-runtime/2ec0cc96c44e5a76b9c8b7c39df7210883d12871/all.json"
+// The Mojang endpoints, they can be replaced before the first LoadManifests (e.g. by a mirror or a test server)
+var PISTON_MANIFEST_URL = "https://piston-meta.mojang.com/mc/game/version_manifest.json"
+var RUNTIME_MANIFEST_URL = "https://launchermeta.mojang.com/v1/products/java-runtime/2ec0cc96c44e5a76b9c8b7c39df7210883d12871/all.json"
+var RESOURCES_URL = "https://resources.download.minecraft.net"
+
 const (
 	MainClass = "net.minecraft.client.main.Main"
 )
@@ -101,13 +108,33 @@ var PLATFORM Platform
 var RUNTIME_MANIFEST manifests.RuntimeManifest
 
 var MANIFEST_FILE = "manifest.json"
+var MANIFEST_SIGNATURE_FILE = "manifest.json.sig" // base64 ed25519 signature of the manifest.json bytes
+var CHANNELS_FILE = "channels.json"               // Revision of each release channel of the pack, e.g. {"stable": 12, "beta": 14}
+var CHANNELS_SIGNATURE_FILE = "channels.json.sig" // base64 ed25519 signature of the channels.json bytes
+var CATALOG_FILE = "index.json"                   // Catalog of the packs published next to each other, in their parent directory
+
+// MANIFEST_PUBLIC_KEYS are the base64 ed25519 public keys (comma separated) trusted to sign the manifests, pinned at build time:
+// go build -ldflags "-X limeal.fr/launchygo/pkg/game/folder/shared.MANIFEST_PUBLIC_KEYS=<key>,<key>"
+// When a key is trusted, the unsigned and tampered manifests are rejected
+var MANIFEST_PUBLIC_KEYS = ""
+
 var JAR_FILE = "minecraft.jar"
 
 var ASSETS_DIR = "assets"
 var LIBRARIES_DIR = "libraries"
 var NATIVES_DIR = "natives"
+var PATCHES_DIR = ".patches"    // Binary deltas of the published files, only on the connector
+var CHUNKS_DIR = ".chunks"      // Content-defined chunks of the published files, only on the connector
+var STATE_DIR = ".launchygo"    // Staged files, journal, backups and manifests of the updates, only in the game folder
+var MANIFESTS_DIR = "manifests" // Manifest of each revision of the pack, <revision>.json
+var ARCHIVE_DIR = ".archive"    // Content of the files replaced by a publish, used by the previous revisions
 
+// GetVersions returns the ids of the minecraft versions, nil if the version manifest can't be loaded
 func GetVersions(releaseOnly bool) []string {
+	if err := LoadManifests(); err != nil {
+		return nil
+	}
+
 	versions := []string{}
 	for _, v := range MC_GLOBAL_MANIFEST.Versions {
 		if releaseOnly && v.Type != "release" {
@@ -118,31 +145,48 @@ func GetVersions(releaseOnly bool) []string {
 	return versions
 }
 
-func init() {
+var (
+	manifestsMutex      sync.Mutex
+	manifestsLoadedFrom string // Urls of the loaded manifests, empty if not loaded
+)
+
+// LoadManifests fetches MC_GLOBAL_MANIFEST and RUNTIME_MANIFEST on the first call, or when their urls were replaced
+// They are only needed to generate a pack, so launching a published pack doesn't depend on the Mojang endpoints
+// A failed load is tried again on the next call
+func LoadManifests() error {
+	manifestsMutex.Lock()
+	defer manifestsMutex.Unlock()
+
+	urls := PISTON_MANIFEST_URL + " " + RUNTIME_MANIFEST_URL
+	if manifestsLoadedFrom == urls {
+		return nil
+	}
+	MC_GLOBAL_MANIFEST = manifests.MCManifest{}
+	RUNTIME_MANIFEST = manifests.RuntimeManifest{}
+
 	// Initialize MC_GLOBAL_MANIFEST
-	resp, err := http.Get(PISTON_MANIFEST_URL)
+	body, err := utils.DoRequest[[]byte](http.MethodGet, PISTON_MANIFEST_URL, nil)
 	if err != nil {
-		log.Fatal("failed to get version manifest")
+		return fmt.Errorf("failed to get version manifest: %w", err)
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal("failed to read version manifest")
+	if err := json.Unmarshal(body, &MC_GLOBAL_MANIFEST); err != nil {
+		return fmt.Errorf("failed to decode version manifest: %w", err)
 	}
-	json.Unmarshal(body, &MC_GLOBAL_MANIFEST)
 
 	// Initialize RUNTIME_MANIFEST
-	resp, err = http.Get(RUNTIME_MANIFEST_URL)
+	body, err = utils.DoRequest[[]byte](http.MethodGet, RUNTIME_MANIFEST_URL, nil)
 	if err != nil {
-		log.Fatal("failed to get runtime manifest")
+		return fmt.Errorf("failed to get runtime manifest: %w", err)
 	}
-	defer resp.Body.Close()
-	body, err = io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal("failed to read runtime manifest")
+	if err := json.Unmarshal(body, &RUNTIME_MANIFEST); err != nil {
+		return fmt.Errorf("failed to decode runtime manifest: %w", err)
 	}
-	json.Unmarshal(body, &RUNTIME_MANIFEST)
 
+	manifestsLoadedFrom = urls
+	return nil
+}
+
+func init() {
 	// Initialize PLATFORM
 	switch runtime.GOOS {
 	case "darwin":
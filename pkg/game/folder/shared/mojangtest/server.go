@@ -0,0 +1,256 @@
+// Package mojangtest fakes the Mojang endpoints (piston-meta, launchermeta and resources) for the tests
+package mojangtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"limeal.fr/launchygo/pkg/game/folder/generator/manifests"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+/**
+* Server serves fake versions, libraries, assets and java runtimes, the shared urls point to it until the test ends
+* Example:
+* ```
+* server := mojangtest.NewServer(t)
+* library := server.AddLibrary("com.example:lib:1.0", []byte("lib"))
+* server.AddVersion("1.20.1", []byte("client"), []manifests.Library{library}, map[string][]byte{"icon.png": []byte("icon")})
+* generator := generator.InitVanillaGenerator("my-pack", "1.20.1")
+* ```
+ */
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	files    map[string][]byte // url path => content
+	requests map[string]int    // url path => number of GET requests
+	versions []manifests.VersionInfo
+	runtimes map[string][]manifests.JavaRuntime // component => runtimes, the same for every platform
+}
+
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		files:    map[string][]byte{},
+		requests: map[string]int{},
+		runtimes: map[string][]manifests.JavaRuntime{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	pistonURL, runtimeURL, resourcesURL := shared.PISTON_MANIFEST_URL, shared.RUNTIME_MANIFEST_URL, shared.RESOURCES_URL
+	shared.PISTON_MANIFEST_URL = s.URL + "/mc/game/version_manifest.json"
+	shared.RUNTIME_MANIFEST_URL = s.URL + "/v1/products/java-runtime/all.json"
+	shared.RESOURCES_URL = s.URL + "/resources"
+
+	t.Cleanup(func() {
+		s.Close()
+		shared.PISTON_MANIFEST_URL, shared.RUNTIME_MANIFEST_URL, shared.RESOURCES_URL = pistonURL, runtimeURL, resourcesURL
+	})
+	return s
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	var body []byte
+	var ok bool
+	switch r.URL.Path {
+	case "/mc/game/version_manifest.json":
+		body, _ = json.Marshal(manifests.MCManifest{Versions: s.versions})
+		ok = true
+	case "/v1/products/java-runtime/all.json":
+		body, _ = json.Marshal(s.runtimeManifest())
+		ok = true
+	default:
+		body, ok = s.files[r.URL.Path]
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// ServeContent handles the Range requests of the resumed downloads
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+func (s *Server) runtimeManifest() manifests.RuntimeManifest {
+	// JavaRuntimes is a struct keyed by component, it is filled from a map with json
+	runtimes := manifests.JavaRuntimes{}
+	data, _ := json.Marshal(s.runtimes)
+	json.Unmarshal(data, &runtimes)
+
+	return manifests.RuntimeManifest{
+		Linux:      runtimes,
+		Macos:      runtimes,
+		MacosArm:   runtimes,
+		WindowsArm: runtimes,
+		WindowsX64: runtimes,
+		WindowsX86: runtimes,
+	}
+}
+
+// AddFile serves the content at the url path and returns its url
+func (s *Server) AddFile(urlPath string, data []byte) string {
+	urlPath = "/" + strings.TrimPrefix(urlPath, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[urlPath] = data
+	return s.URL + urlPath
+}
+
+// SetFile replaces the content of a served file, e.g. to serve a corrupted file
+func (s *Server) SetFile(url string, data []byte) {
+	s.AddFile(strings.TrimPrefix(url, s.URL), data)
+}
+
+// Requests returns the number of requests received for the url (or url path)
+func (s *Server) Requests(url string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[strings.TrimPrefix(url, s.URL)]
+}
+
+// AddArtifact serves the content and returns its download entry
+func (s *Server) AddArtifact(artifactPath string, data []byte) *manifests.Artifact {
+	return &manifests.Artifact{
+		Path: artifactPath,
+		Sha1: utils.BytesSHA1(data),
+		Size: int64(len(data)),
+		URL:  s.AddFile("/maven/"+artifactPath, data),
+	}
+}
+
+// AddLibrary serves a library jar, the maven path is derived from the name (group:artifact:version)
+func (s *Server) AddLibrary(name string, data []byte) manifests.Library {
+	return manifests.Library{
+		Name:      name,
+		Downloads: manifests.LibraryDownloads{Artifact: s.AddArtifact(mavenPath(name, ""), data)},
+	}
+}
+
+// AddNativeLibrary serves a library with a natives-<platform> classifier jar containing the files (e.g. liblwjgl.so)
+func (s *Server) AddNativeLibrary(name string, platform string, files map[string][]byte) manifests.Library {
+	classifier := "natives-" + platform
+	return manifests.Library{
+		Name: name,
+		Downloads: manifests.LibraryDownloads{
+			Classifiers: map[string]*manifests.Artifact{
+				classifier: s.AddArtifact(mavenPath(name, classifier), Zip(files)),
+			},
+		},
+	}
+}
+
+// AddAsset serves the asset object under the resources url and returns its entry of the assets index
+func (s *Server) AddAsset(data []byte) manifests.AssetObject {
+	hash := utils.BytesSHA1(data)
+	s.AddFile("/resources/"+hash[:2]+"/"+hash, data)
+	return manifests.AssetObject{Hash: hash, Size: int64(len(data))}
+}
+
+/**
+* Add a version to the version manifest with its client jar, libraries and assets (name => content)
+* The returned manifest can be modified and served again with SetVersionManifest
+ */
+func (s *Server) AddVersion(id string, client []byte, libraries []manifests.Library, assets map[string][]byte) manifests.VVersionManifest {
+	assetsManifest := manifests.AssetsManifest{Objects: map[string]manifests.AssetObject{}}
+	for name, data := range assets {
+		assetsManifest.Objects[name] = s.AddAsset(data)
+	}
+	assetsIndex, _ := json.Marshal(assetsManifest)
+
+	manifest := manifests.VVersionManifest{
+		Version:   id,
+		MainClass: shared.MainClass,
+		Libraries: libraries,
+		Downloads: map[string]manifests.DownloadEntry{
+			"client": {
+				Sha1: utils.BytesSHA1(client),
+				Size: int64(len(client)),
+				URL:  s.AddFile("/v1/objects/"+utils.BytesSHA1(client)+"/client.jar", client),
+			},
+		},
+	}
+	manifest.AssetIndex.ID = id
+	manifest.AssetIndex.URL = s.AddFile("/v1/packages/assets/"+id+".json", assetsIndex)
+	manifest.Arguments.Game = []any{"--username", "${auth_player_name}", "--version", "${version_name}"}
+	manifest.Arguments.JVM = []any{"-cp", "${classpath}"}
+
+	s.SetVersionManifest(manifest)
+	return manifest
+}
+
+// SetVersionManifest serves the version manifest, it is added to the version list if it is a new version
+func (s *Server) SetVersionManifest(manifest manifests.VVersionManifest) {
+	data, _ := json.Marshal(manifest)
+	url := s.AddFile("/v1/packages/"+manifest.Version+".json", data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.versions {
+		if v.ID == manifest.Version {
+			s.versions[i].SHA1 = utils.BytesSHA1(data)
+			return
+		}
+	}
+	s.versions = append(s.versions, manifests.VersionInfo{ID: manifest.Version, URL: url, SHA1: utils.BytesSHA1(data), Type: "release"})
+}
+
+// AddRuntime serves a java runtime component (e.g. java-runtime-gamma) for every platform with the files (path => content)
+func (s *Server) AddRuntime(component string, files map[string][]byte) {
+	runtimeManifest := manifests.JavaRuntimeManifest{Files: map[string]manifests.JavaRuntimeManifestFile{}}
+	for filePath, data := range files {
+		file := manifests.JavaRuntimeManifestFile{Type: "file", Executable: strings.HasPrefix(filePath, "bin/")}
+		file.Downloads.Raw.URL = s.AddFile("/runtime/"+component+"/"+filePath, data)
+		file.Downloads.Raw.Sha1 = utils.BytesSHA1(data)
+		file.Downloads.Raw.Size = int64(len(data))
+		runtimeManifest.Files[filePath] = file
+	}
+	data, _ := json.Marshal(runtimeManifest)
+
+	runtime := manifests.JavaRuntime{}
+	runtime.Manifest.URL = s.AddFile("/runtime/"+component+"/manifest.json", data)
+	runtime.Manifest.Sha1 = utils.BytesSHA1(data)
+	runtime.Manifest.Size = int64(len(data))
+	runtime.Version.Name = component
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runtimes[component] = []manifests.JavaRuntime{runtime}
+}
+
+// mavenPath returns the path of the jar of a maven name (group:artifact:version)
+func mavenPath(name string, classifier string) string {
+	parts := strings.Split(name, ":")
+	if len(parts) < 3 {
+		return name + ".jar"
+	}
+	group, artifact, version := strings.ReplaceAll(parts[0], ".", "/"), parts[1], parts[2]
+	file := artifact + "-" + version
+	if classifier != "" {
+		file += "-" + classifier
+	}
+	return group + "/" + artifact + "/" + version + "/" + file + ".jar"
+}
+
+// Zip returns a zip archive of the files (name => content)
+func Zip(files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, _ := w.Create(name)
+		f.Write(data)
+	}
+	w.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,165 @@
+package folder
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+var (
+	ErrUnsignedManifest = errors.New("the manifest is not signed")
+	ErrInvalidSignature = errors.New("the signature of the manifest doesn't match a trusted key")
+)
+
+var (
+	trustedKeysMutex sync.RWMutex
+	trustedKeys      []ed25519.PublicKey // In addition to shared.MANIFEST_PUBLIC_KEYS
+)
+
+/**
+* Trust the key to sign the manifests, InitGameFolder then rejects the unsigned and tampered manifests
+* The keys can also be pinned at build time, see shared.MANIFEST_PUBLIC_KEYS
+* Example:
+* ```
+* key, err := folder.ParsePublicKey("r8HbMuYGoLx0pOBKyyBxG0KE6gXhBPHpXXcH1vYDm7Q=")
+* folder.TrustManifestKey(key)
+* ```
+ */
+func TrustManifestKey(key ed25519.PublicKey) {
+	trustedKeysMutex.Lock()
+	defer trustedKeysMutex.Unlock()
+	trustedKeys = append(trustedKeys, key)
+}
+
+// TrustedManifestKeys returns the keys pinned at build time then the ones of TrustManifestKey
+func TrustedManifestKeys() ([]ed25519.PublicKey, error) {
+	keys := []ed25519.PublicKey{}
+	for _, encoded := range strings.Split(shared.MANIFEST_PUBLIC_KEYS, ",") {
+		if strings.TrimSpace(encoded) == "" {
+			continue
+		}
+		key, err := ParsePublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pinned manifest key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	trustedKeysMutex.RLock()
+	defer trustedKeysMutex.RUnlock()
+	return append(keys, trustedKeys...), nil
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected a key of %d bytes, got %d", ed25519.PublicKeySize, len(data))
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// EncodePublicKey returns the base64 form of the key, the one of ParsePublicKey and shared.MANIFEST_PUBLIC_KEYS
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// GenerateSigningKey creates a key pair and writes the private key to path (PEM, PKCS #8)
+func GenerateSigningKey(path string) (ed25519.PublicKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	// The private key must not be readable by the other users
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return public, f.Close()
+}
+
+// LoadSigningKey reads a private key written by GenerateSigningKey
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key in %s: %w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 private key", path)
+	}
+	return private, nil
+}
+
+// SignManifest returns the content of the signature file of the manifest bytes
+func SignManifest(manifest []byte, key ed25519.PrivateKey) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest)) + "\n")
+}
+
+// VerifyManifest checks the signature file of the manifest bytes against the keys
+func VerifyManifest(manifest []byte, signature []byte, keys []ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, manifest, sig) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// readManifest reads a manifest (or the channels) of the connector, it is verified with its signature when a signing key is trusted
+func readManifest(connector connectors.Connector, remotePath string, signaturePath string) ([]byte, error) {
+	data, err := connector.ReadFileBytes(remotePath, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := TrustedManifestKeys()
+	if err != nil || len(keys) == 0 {
+		return data, err
+	}
+	signature, err := connector.ReadFileBytes(signaturePath, -1)
+	if err != nil {
+		if connector.HasFile(signaturePath) {
+			return nil, fmt.Errorf("failed to read the signature of the manifest: %w", err)
+		}
+		return nil, ErrUnsignedManifest
+	}
+	if err := VerifyManifest(data, signature, keys); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
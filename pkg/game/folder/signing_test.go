@@ -0,0 +1,155 @@
+package folder
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/connectors"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+// trustKey trusts the key until the end of the test
+func trustKey(t *testing.T, key ed25519.PublicKey) {
+	t.Helper()
+	trustedKeysMutex.Lock()
+	previous := trustedKeys
+	trustedKeysMutex.Unlock()
+	TrustManifestKey(key)
+	t.Cleanup(func() {
+		trustedKeysMutex.Lock()
+		trustedKeys = previous
+		trustedKeysMutex.Unlock()
+	})
+}
+
+func TestSigningKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "publisher.key")
+	public, err := GenerateSigningKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := LoadSigningKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !public.Equal(private.Public()) {
+		t.Error("the loaded key doesn't match the public key")
+	}
+	if parsed, err := ParsePublicKey(EncodePublicKey(public)); err != nil || !parsed.Equal(public) {
+		t.Errorf("ParsePublicKey = %v, %v", parsed, err)
+	}
+
+	// An existing key is never overwritten
+	if _, err := GenerateSigningKey(path); err == nil {
+		t.Error("expected an error for an existing key file")
+	}
+}
+
+func TestInitGameFolderVerifiesSignature(t *testing.T) {
+	newLocalPack(t, map[string]string{"minecraft.jar": "client"}, "minecraft.jar")
+	path := filepath.Join(t.TempDir(), "publisher.key")
+	public, _ := GenerateSigningKey(path)
+	private, _ := LoadSigningKey(path)
+
+	connector := connectors.NewMemoryConnector(connectors.NewMemFS(), "")
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{SigningKey: private}); err != nil {
+		t.Fatal(err)
+	}
+	if !connector.HasFile(shared.MANIFEST_SIGNATURE_FILE) {
+		t.Fatal("the signature is not published")
+	}
+
+	// Without trusted key the signature isn't checked
+	if _, err := InitGameFolder(connector, "my-pack", true); err != nil {
+		t.Fatal(err)
+	}
+
+	trustKey(t, public)
+	if _, err := InitGameFolder(connector, "my-pack", true); err != nil {
+		t.Fatalf("signed manifest rejected: %v", err)
+	}
+
+	// Tampered manifest
+	manifest, _ := connector.ReadFileBytes(shared.MANIFEST_FILE, -1)
+	connector.SendFileFromBytes(shared.MANIFEST_FILE, append(manifest, ' '))
+	if _, err := InitGameFolder(connector, "my-pack", true); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("err = %v, want ErrInvalidSignature", err)
+	}
+
+	// Unsigned manifest, the publish without key removes the previous signature
+	if err := PublishGameFolder(connector, "my-pack"); err != nil {
+		t.Fatal(err)
+	}
+	if connector.HasFile(shared.MANIFEST_SIGNATURE_FILE) {
+		t.Error("the signature of the previous manifest is kept")
+	}
+	if _, err := InitGameFolder(connector, "my-pack", true); !errors.Is(err, ErrUnsignedManifest) {
+		t.Errorf("err = %v, want ErrUnsignedManifest", err)
+	}
+
+	// Signed by another key
+	_, other, _ := ed25519.GenerateKey(nil)
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{SigningKey: other}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitGameFolder(connector, "my-pack", true); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("err = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestPinnedManifestKeys(t *testing.T) {
+	public, _, _ := ed25519.GenerateKey(nil)
+	previous := shared.MANIFEST_PUBLIC_KEYS
+	t.Cleanup(func() { shared.MANIFEST_PUBLIC_KEYS = previous })
+
+	shared.MANIFEST_PUBLIC_KEYS = EncodePublicKey(public) + ", "
+	keys, err := TrustedManifestKeys()
+	if err != nil || len(keys) != 1 || !keys[0].Equal(public) {
+		t.Errorf("keys = %v, %v, want the pinned key", keys, err)
+	}
+
+	shared.MANIFEST_PUBLIC_KEYS = "not a key"
+	if _, err := TrustedManifestKeys(); err == nil {
+		t.Error("expected an error for an invalid pinned key")
+	}
+}
+
+func TestReadChannelsVerifiesSignature(t *testing.T) {
+	dir := newLocalPack(t, map[string]string{"minecraft.jar": "v1"})
+	public, private, _ := ed25519.GenerateKey(nil)
+	connector := connectors.NewMemoryConnector(connectors.NewMemFS(), "")
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{SigningKey: private}); err != nil {
+		t.Fatal(err)
+	}
+	writePackFile(t, dir, "minecraft.jar", "v2")
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{SigningKey: private, Channel: "beta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	trustKey(t, public)
+	if channels, err := ReadChannels(connector); err != nil || channels["beta"] != 2 {
+		t.Fatalf("channels = %v, %v, want beta 2", channels, err)
+	}
+
+	// The beta is pointed back to the older revision
+	connector.SendFileFromBytes(shared.CHANNELS_FILE, []byte(`{"stable": 1, "beta": 1}`))
+	if _, err := ReadChannels(connector); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("err = %v, want ErrInvalidSignature", err)
+	}
+	if _, err := InitGameFolderChannel(connector, "my-pack", "beta", true); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("err = %v, want ErrInvalidSignature", err)
+	}
+
+	// The publish without key removes the previous signature
+	if err := PublishGameFolder(connector, "my-pack", PublishOptions{Channel: "beta"}); err != nil {
+		t.Fatal(err)
+	}
+	if connector.HasFile(shared.CHANNELS_SIGNATURE_FILE) {
+		t.Error("the signature of the previous channels is kept")
+	}
+	if _, err := ReadChannels(connector); !errors.Is(err, ErrUnsignedManifest) {
+		t.Errorf("err = %v, want ErrUnsignedManifest", err)
+	}
+}
@@ -0,0 +1,295 @@
+package folder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+// ErrNoRollback is returned by Rollback when no update can be undone
+var ErrNoRollback = errors.New("no update to roll back")
+
+// The update state is stored in the STATE_DIR of the game folder:
+//   - staging/: the files downloaded by Build, moved in the game folder once all of them are verified
+//   - backup/: the files replaced or removed by the last update, restored by Rollback
+//   - journal.json: the moves of the update being applied, replayed when the launcher was closed in the middle
+//   - manifest.json, previous.json: the installed manifest and the one before the last update
+//   - update.json: the moves of the last update, undone by Rollback
+const (
+	stagingDir           = "staging"
+	backupDir            = "backup"
+	journalFile          = "journal.json"
+	installedFile        = "manifest.json"
+	previousFile         = "previous.json"
+	lastUpdateFile       = "update.json"
+	stateFilePermissions = 0644
+)
+
+// journalAction is a move of the journal, each one can be replayed after an interruption
+type journalAction string
+
+const (
+	actionInstall journalAction = "install" // Back up the file, then move the staged one in its place
+	actionRemove  journalAction = "remove"  // Back up the file
+	actionRestore journalAction = "restore" // Move the backed up file back in its place
+	actionDelete  journalAction = "delete"  // Delete the file, it didn't exist before the update
+)
+
+type journalKind string
+
+const (
+	kindUpdate   journalKind = "update"
+	kindRollback journalKind = "rollback"
+)
+
+type journalEntry struct {
+	Path   string        `json:"path"` // Relative to the game folder, with forward slashes
+	Action journalAction `json:"action"`
+}
+
+// journal lists the moves swapping the files of the game folder, it is written before the first move
+type journal struct {
+	Kind     journalKind    `json:"kind"`
+	Manifest Manifest       `json:"manifest"` // Installed once every entry is applied
+	Entries  []journalEntry `json:"entries"`
+}
+
+func (g *GameFolder) statePath(elem ...string) string {
+	return filepath.Join(append([]string{g.Path, shared.STATE_DIR}, elem...)...)
+}
+
+// stagedPath returns the path of the file in the staging area
+func (g *GameFolder) stagedPath(p string) (string, error) {
+	return ResolvePath(g.statePath(stagingDir), p)
+}
+
+// isState tells if the local path is in the STATE_DIR of the game folder
+func (g *GameFolder) isState(path string) bool {
+	return path == g.statePath()
+}
+
+func writeStateFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Written next to it then renamed, an interruption never leaves half a file
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, stateFilePermissions)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+func readStateFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// moveFile renames src to dest, creating the directory of dest
+func moveFile(src string, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dest)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// Journal
+/////////////////////////////////////////////////////////////////////
+
+// apply runs the move of the entry, running it again after an interruption finishes it
+func (g *GameFolder) apply(entry journalEntry) error {
+	livePath := filepath.Join(g.Path, filepath.FromSlash(entry.Path))
+	stagedPath := g.statePath(stagingDir, filepath.FromSlash(entry.Path))
+	backupPath := g.statePath(backupDir, filepath.FromSlash(entry.Path))
+
+	switch entry.Action {
+	case actionInstall:
+		// Without the staged file, the install is already done
+		if !exists(stagedPath) {
+			return nil
+		}
+		if exists(livePath) {
+			if err := moveFile(livePath, backupPath); err != nil {
+				return err
+			}
+		}
+		return moveFile(stagedPath, livePath)
+	case actionRemove:
+		if !exists(livePath) {
+			return nil
+		}
+		return moveFile(livePath, backupPath)
+	case actionRestore:
+		if !exists(backupPath) {
+			return nil
+		}
+		if err := os.Remove(livePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return moveFile(backupPath, livePath)
+	case actionDelete:
+		if err := os.Remove(livePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown journal action %q", entry.Action)
+}
+
+// applyJournal writes the journal, then moves the files and installs its manifest
+// The journal is only removed once everything is done, see recover
+func (g *GameFolder) applyJournal(j journal, write bool) error {
+	journalPath := g.statePath(journalFile)
+	if write {
+		if err := writeStateFile(journalPath, j); err != nil {
+			return fmt.Errorf("failed to write the update journal: %w", err)
+		}
+	}
+
+	for _, entry := range j.Entries {
+		if err := g.apply(entry); err != nil {
+			return fmt.Errorf("failed to %s %s: %w", entry.Action, entry.Path, err)
+		}
+	}
+
+	var err error
+	switch j.Kind {
+	case kindUpdate:
+		err = g.installUpdate(j)
+	case kindRollback:
+		err = g.installRollback(j)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(journalPath); err != nil {
+		return err
+	}
+	os.RemoveAll(g.statePath(stagingDir))
+	return nil
+}
+
+// installUpdate keeps the installed manifest as the previous one and the entries for Rollback
+func (g *GameFolder) installUpdate(j journal) error {
+	var installed Manifest
+	if readStateFile(g.statePath(installedFile), &installed) == nil {
+		if err := writeStateFile(g.statePath(previousFile), installed); err != nil {
+			return err
+		}
+		if err := writeStateFile(g.statePath(lastUpdateFile), j.Entries); err != nil {
+			return err
+		}
+	} else {
+		// The first install can't be rolled back
+		os.Remove(g.statePath(previousFile))
+		os.Remove(g.statePath(lastUpdateFile))
+	}
+	return writeStateFile(g.statePath(installedFile), j.Manifest)
+}
+
+// installRollback reinstalls the previous manifest, a rollback can't be rolled back
+func (g *GameFolder) installRollback(j journal) error {
+	if err := writeStateFile(g.statePath(installedFile), j.Manifest); err != nil {
+		return err
+	}
+	os.Remove(g.statePath(previousFile))
+	os.Remove(g.statePath(lastUpdateFile))
+	os.RemoveAll(g.statePath(backupDir))
+	return nil
+}
+
+// recover finishes the update or the rollback interrupted while moving the files
+// Every staged file was verified before the journal was written, the update is completed rather than undone
+func (g *GameFolder) recover() error {
+	var j journal
+	err := readStateFile(g.statePath(journalFile), &j)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the update journal: %w", err)
+	}
+	if err := g.applyJournal(j, false); err != nil {
+		return fmt.Errorf("failed to recover the interrupted update: %w", err)
+	}
+	return nil
+}
+
+// commit swaps the staged files and removes the unknown ones, backing up what they replace
+func (g *GameFolder) commit(entries []journalEntry) error {
+	// The backups of the update before are dropped, only the last one can be rolled back
+	if err := os.RemoveAll(g.statePath(backupDir)); err != nil {
+		return err
+	}
+	return g.applyJournal(journal{Kind: kindUpdate, Manifest: g.Manifest, Entries: entries}, true)
+}
+
+/**
+* Restore the files and the manifest of the game folder from before the last Build, e.g. when the new version
+* of the pack doesn't start. Only the last update can be rolled back, the first install can't
+* Example:
+* ```
+* if err := gameFolder.Rollback(); err != nil && !errors.Is(err, folder.ErrNoRollback) {
+*     return err
+* }
+* ```
+ */
+func (g *GameFolder) Rollback() error {
+	if err := g.recover(); err != nil {
+		return err
+	}
+
+	var previous Manifest
+	var entries []journalEntry
+	if readStateFile(g.statePath(previousFile), &previous) != nil || readStateFile(g.statePath(lastUpdateFile), &entries) != nil {
+		return ErrNoRollback
+	}
+
+	// The moves of the update are undone, the files it added are deleted
+	inverse := make([]journalEntry, 0, len(entries))
+	for _, entry := range entries {
+		action := actionRestore
+		if entry.Action == actionInstall && !exists(g.statePath(backupDir, filepath.FromSlash(entry.Path))) {
+			action = actionDelete
+		}
+		inverse = append(inverse, journalEntry{Path: entry.Path, Action: action})
+	}
+
+	if err := g.applyJournal(journal{Kind: kindRollback, Manifest: previous, Entries: inverse}, true); err != nil {
+		return fmt.Errorf("failed to roll back: %w", err)
+	}
+	g.Manifest = previous
+	return nil
+}
@@ -0,0 +1,173 @@
+package folder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeStagedFile writes the file in the staging area, as left by an interrupted build
+func writeStagedFile(t *testing.T, g *GameFolder, path string, content string) {
+	t.Helper()
+	dest := g.statePath(stagingDir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dest, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// buildVersion serves the files as the new version of the pack and builds it
+func buildVersion(t *testing.T, g *GameFolder, files map[string]string) error {
+	t.Helper()
+	g.Connector, g.Manifest = newRemotePack(t, files)
+	return g.Build(false, noProgress)
+}
+
+func TestBuildFailureKeepsGameFolder(t *testing.T) {
+	gameFolder := newTestGameFolder(t, nil, Manifest{})
+	if err := buildVersion(t, gameFolder, map[string]string{"minecraft.jar": "v1", "mods/old.jar": "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second file of the update is corrupted, the first one is only staged
+	connector, manifest := newRemotePack(t, map[string]string{"minecraft.jar": "v2", "mods/new.jar": "new"})
+	connector.SendFileFromBytes("mods/new.jar", []byte("corrupted"))
+	gameFolder.Connector, gameFolder.Manifest = connector, manifest
+	if err := gameFolder.Build(false, noProgress); err == nil {
+		t.Fatal("build succeeded with a corrupted file")
+	}
+
+	want := []string{"minecraft.jar", "mods/old.jar"}
+	if got := listFiles(t, gameFolder.Path); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "minecraft.jar")); got != "v1" {
+		t.Errorf("minecraft.jar = %q, want the previous version", got)
+	}
+	if exists(gameFolder.statePath(journalFile)) {
+		t.Error("journal written for a failed build")
+	}
+}
+
+func TestBuildRecoversInterruptedSwap(t *testing.T) {
+	gameFolder := newTestGameFolder(t, nil, Manifest{})
+	if err := buildVersion(t, gameFolder, map[string]string{"minecraft.jar": "v1", "mods/old.jar": "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The launcher was closed after backing up minecraft.jar, before moving the staged version in its place
+	connector, manifest := newRemotePack(t, map[string]string{"minecraft.jar": "v2"})
+	gameFolder.Connector, gameFolder.Manifest = connector, manifest
+	writeStagedFile(t, gameFolder, "minecraft.jar", "v2")
+	err := writeStateFile(gameFolder.statePath(journalFile), journal{
+		Kind:     kindUpdate,
+		Manifest: manifest,
+		Entries:  []journalEntry{{Path: "minecraft.jar", Action: actionInstall}, {Path: "mods/old.jar", Action: actionRemove}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(gameFolder.statePath(backupDir)); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveFile(filepath.Join(gameFolder.Path, "minecraft.jar"), gameFolder.statePath(backupDir, "minecraft.jar")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next build finishes the update without downloading anything
+	gameFolder.Connector = &openRecorder{MemoryConnector: connector}
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if opened := gameFolder.Connector.(*openRecorder).opened; len(opened) != 0 {
+		t.Errorf("downloaded %v, want nothing", opened)
+	}
+	if got := listFiles(t, gameFolder.Path); !slices.Equal(got, []string{"minecraft.jar"}) {
+		t.Errorf("files = %v, want [minecraft.jar]", got)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "minecraft.jar")); got != "v2" {
+		t.Errorf("minecraft.jar = %q, want the new version", got)
+	}
+
+	// The recovered update can be rolled back
+	if err := gameFolder.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "minecraft.jar")); got != "v1" {
+		t.Errorf("minecraft.jar = %q, want the previous version", got)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	gameFolder := newTestGameFolder(t, nil, Manifest{})
+	if err := buildVersion(t, gameFolder, map[string]string{"minecraft.jar": "v1", "mods/old.jar": "old"}); err != nil {
+		t.Fatal(err)
+	}
+	// The first install can't be rolled back
+	if err := gameFolder.Rollback(); !errors.Is(err, ErrNoRollback) {
+		t.Fatalf("err = %v, want ErrNoRollback", err)
+	}
+	v1 := gameFolder.Manifest
+
+	os.WriteFile(filepath.Join(gameFolder.Path, "options.txt"), []byte("fov:90"), 0644)
+	if err := buildVersion(t, gameFolder, map[string]string{"minecraft.jar": "v2", "mods/new.jar": "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gameFolder.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"minecraft.jar", "mods/old.jar", "options.txt"}
+	if got := listFiles(t, gameFolder.Path); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	for path, content := range map[string]string{"minecraft.jar": "v1", "mods/old.jar": "old", "options.txt": "fov:90"} {
+		if got := readFile(t, filepath.Join(gameFolder.Path, path)); got != content {
+			t.Errorf("%s = %q, want %q", path, got, content)
+		}
+	}
+	if !slices.EqualFunc(gameFolder.Manifest.Files, v1.Files, func(a, b FolderFile) bool { return a.Path == b.Path && a.Sha == b.Sha }) {
+		t.Errorf("manifest = %+v, want the previous one", gameFolder.Manifest)
+	}
+
+	// Only the last update can be rolled back
+	if err := gameFolder.Rollback(); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("err = %v, want ErrNoRollback", err)
+	}
+}
+
+func TestRollbackWithoutConnector(t *testing.T) {
+	chdir(t, t.TempDir())
+	if _, err := OpenLocalGameFolder("pack", true); err == nil || !strings.Contains(err.Error(), "is not installed") {
+		t.Fatalf("err = %v, want a not installed game folder", err)
+	}
+
+	gameFolder := newTestGameFolder(t, nil, Manifest{})
+	gameFolder.Path = filepath.Join("packs", "pack")
+	if err := buildVersion(t, gameFolder, map[string]string{"minecraft.jar": "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := buildVersion(t, gameFolder, map[string]string{"minecraft.jar": "v2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pack server is down, only the local state is used
+	localFolder, err := OpenLocalGameFolder("pack", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if localFolder.Connector != nil || localFolder.Manifest.Files[0].Sha != gameFolder.Manifest.Files[0].Sha {
+		t.Fatalf("game folder = %+v, want the installed manifest without connector", localFolder)
+	}
+	if err := localFolder.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(localFolder.Path, "minecraft.jar")); got != "v1" {
+		t.Errorf("minecraft.jar = %q, want v1", got)
+	}
+}
@@ -0,0 +1,307 @@
+package folder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"limeal.fr/launchygo/pkg/game/folder/chunker"
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+)
+
+var (
+	ErrInvalidPath = errors.New("invalid path")
+	ErrPathEscape  = errors.New("path escapes the game folder")
+)
+
+// windowsReservedNames can't be used as a file name on Windows, with or without extension (e.g. con.txt)
+var windowsReservedNames = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[0-9¹²³]|lpt[0-9¹²³]|conin\$|conout\$)(\..*)?$`)
+
+var driveRegex = regexp.MustCompile(`^[a-zA-Z]:`)
+
+var shaRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+/**
+* Check a path of the manifest before it is used on disk: relative, with forward slashes, without . or .. segments,
+* Windows drive, UNC prefix, reserved names (con, nul...) or characters (<>:"|?* and control characters)
+* Example:
+* ```
+* folder.ValidatePath("mods/sodium.jar")  // nil
+* folder.ValidatePath("../../.bashrc")    // ErrInvalidPath
+* ```
+ */
+func ValidatePath(p string) error {
+	if p == "" {
+		return fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+	if strings.Contains(p, "\\") {
+		return fmt.Errorf("%w: %q contains a backslash", ErrInvalidPath, p)
+	}
+	if strings.HasPrefix(p, "/") {
+		return fmt.Errorf("%w: %q is absolute", ErrInvalidPath, p)
+	}
+	if driveRegex.MatchString(p) {
+		return fmt.Errorf("%w: %q has a drive prefix", ErrInvalidPath, p)
+	}
+
+	for _, segment := range strings.Split(p, "/") {
+		switch {
+		case segment == "":
+			return fmt.Errorf("%w: %q has an empty segment", ErrInvalidPath, p)
+		case segment == "." || segment == "..":
+			return fmt.Errorf("%w: %q has a %s segment", ErrInvalidPath, p, segment)
+		case strings.ContainsAny(segment, `<>:"|?*`) || strings.IndexFunc(segment, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0:
+			return fmt.Errorf("%w: %q has a reserved character", ErrInvalidPath, p)
+		case strings.HasSuffix(segment, ".") || strings.HasSuffix(segment, " "):
+			// Windows drops them, "a." and "a" would be the same file
+			return fmt.Errorf("%w: %q has a segment ending with a dot or a space", ErrInvalidPath, p)
+		case windowsReservedNames.MatchString(segment):
+			return fmt.Errorf("%w: %q has a reserved name", ErrInvalidPath, p)
+		}
+	}
+	return nil
+}
+
+// validateRemotePath checks a path of the connector (patches, chunk store), the leading .. segments are allowed
+// since the chunk store can be shared by the packs next to each other
+func validateRemotePath(p string) error {
+	rest := p
+	for strings.HasPrefix(rest, "../") {
+		rest = strings.TrimPrefix(rest, "../")
+	}
+	return ValidatePath(rest)
+}
+
+/**
+* Return the path of the manifest file in the game folder, after checking that neither the path nor a symbolic link
+* of the game folder leads outside of it
+* Example:
+* ```
+* dest, err := folder.ResolvePath(gameFolder.Path, "mods/sodium.jar")
+* ```
+ */
+func ResolvePath(root string, p string) (string, error) {
+	if err := ValidatePath(p); err != nil {
+		return "", err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Nothing on disk yet, no link to follow
+			return filepath.Join(root, filepath.FromSlash(p)), nil
+		}
+		return "", err
+	}
+
+	current := root
+	for _, segment := range strings.Split(p, "/") {
+		current = filepath.Join(current, segment)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		target, err := filepath.EvalSymlinks(current)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// A dangling link would be followed when the file is created
+				return "", fmt.Errorf("%w: %s is a link to a missing file", ErrPathEscape, p)
+			}
+			return "", err
+		}
+		if rel, err := filepath.Rel(realRoot, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%w: %s is a link to %s", ErrPathEscape, p, target)
+		}
+	}
+	return filepath.Join(root, filepath.FromSlash(p)), nil
+}
+
+// normalizeLegacyPaths replaces the backslashes of the paths written by the previous versions before they are validated:
+// the Windows java binary of the generators and the files of the packs published from Windows
+func normalizeLegacyPaths(manifest *Manifest) {
+	for platform, binary := range manifest.JavaBinaries {
+		manifest.JavaBinaries[platform] = strings.ReplaceAll(binary, "\\", "/")
+	}
+	for i := range manifest.Files {
+		manifest.Files[i].Path = strings.ReplaceAll(manifest.Files[i].Path, "\\", "/")
+	}
+}
+
+// reservedPaths hold the update state of the game folder and the storage of the connector, not the game files
+func reservedPaths() []string {
+	return []string{shared.STATE_DIR, shared.MANIFESTS_DIR, shared.ARCHIVE_DIR, shared.PATCHES_DIR, shared.CHUNKS_DIR,
+		shared.CHANNELS_FILE}
+}
+
+/////////////////////////////////////////////////////////////////////
+// Manifest
+/////////////////////////////////////////////////////////////////////
+
+// ManifestValidationError lists every problem found in a manifest
+// errors.Is finds the errors of the problems, e.g. ErrInvalidPath
+type ManifestValidationError struct {
+	Problems []string
+	errs     []error
+}
+
+func (e *ManifestValidationError) Error() string {
+	return fmt.Sprintf("invalid manifest (%d problems):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+func (e *ManifestValidationError) Unwrap() []error {
+	return e.errs
+}
+
+func (e *ManifestValidationError) add(format string, args ...any) {
+	err := fmt.Errorf(format, args...)
+	e.Problems = append(e.Problems, err.Error())
+	if errors.Unwrap(err) != nil {
+		e.errs = append(e.errs, err)
+	}
+}
+
+/**
+* Check the whole manifest before anything is written on disk: paths (see ValidatePath), duplicates, checksums,
+* sizes, patches, chunks and compressions. The error is a *ManifestValidationError with every problem found
+* Example:
+* ```
+* if err := folder.ValidateManifest(manifest); err != nil {
+*     fmt.Println(err)
+* }
+* ```
+ */
+func ValidateManifest(manifest Manifest) error {
+	problems := &ManifestValidationError{}
+
+	if manifest.MainClass == "" {
+		problems.add("mainClass is missing")
+	}
+	if manifest.McVersion == "" {
+		problems.add("mcVersion is missing")
+	}
+	if manifest.Revision < 0 {
+		problems.add("negative revision")
+	}
+	if manifest.Channel != "" {
+		if err := ValidateChannel(manifest.Channel); err != nil {
+			problems.add("%w", err)
+		}
+	}
+	if manifest.ReleaseDate != "" {
+		if _, err := time.Parse(time.RFC3339, manifest.ReleaseDate); err != nil {
+			problems.add("releaseDate %q is not a RFC 3339 date", manifest.ReleaseDate)
+		}
+	}
+	if manifest.Icon != "" {
+		if err := ValidatePath(manifest.Icon); err != nil {
+			problems.add("icon: %w", err)
+		}
+	}
+	if manifest.AssetIndex != "" && (ValidatePath(manifest.AssetIndex) != nil || strings.Contains(manifest.AssetIndex, "/")) {
+		problems.add("assetIndex %q is not a valid name", manifest.AssetIndex)
+	}
+	if manifest.ChunkStore != "" {
+		if err := validateRemotePath(manifest.ChunkStore); err != nil {
+			problems.add("chunkStore: %w", err)
+		}
+	}
+	for platform, binary := range manifest.JavaBinaries {
+		if err := ValidatePath(binary); err != nil {
+			problems.add("javaBinaries[%s]: %w", platform, err)
+		}
+	}
+
+	// Case insensitive, the paths which only differ by their case are the same file on Windows and macOS
+	paths := make(map[string]string, len(manifest.Files))
+	for _, file := range manifest.Files {
+		if err := ValidatePath(file.Path); err == nil {
+			paths[strings.ToLower(file.Path)] = file.Path
+		}
+	}
+
+	seen := make(map[string]bool, len(manifest.Files))
+	for i, file := range manifest.Files {
+		name := fmt.Sprintf("files[%d] %q", i, file.Path)
+		if err := ValidatePath(file.Path); err != nil {
+			problems.add("%s: %w", name, err)
+			continue
+		}
+
+		key := strings.ToLower(file.Path)
+		if seen[key] {
+			problems.add("%s: duplicated path", name)
+		}
+		seen[key] = true
+		for _, dir := range reservedPaths() {
+			if reserved := strings.ToLower(dir); key == reserved || strings.HasPrefix(key, reserved+"/") {
+				problems.add("%s: %s is reserved", name, dir)
+			}
+		}
+		// A file can't be the directory of another one
+		for dir := key; strings.Contains(dir, "/"); {
+			dir = dir[:strings.LastIndex(dir, "/")]
+			if other, ok := paths[dir]; ok {
+				problems.add("%s: %q is a file", name, other)
+				break
+			}
+		}
+
+		if !shaRegex.MatchString(file.Sha) {
+			problems.add("%s: sha %q is not a sha1", name, file.Sha)
+		}
+		if file.Size < 0 {
+			problems.add("%s: negative size", name)
+		}
+		validateFileStorage(problems, name, file)
+	}
+
+	if len(problems.Problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// validateFileStorage checks how the file is stored on the connector: patches, chunks and compression
+func validateFileStorage(problems *ManifestValidationError, name string, file FolderFile) {
+	for j, patch := range file.Patches {
+		if err := validateRemotePath(patch.Path); err != nil {
+			problems.add("%s: patches[%d]: %w", name, j, err)
+		}
+		if !shaRegex.MatchString(patch.Sha) || !shaRegex.MatchString(patch.BaseSha) {
+			problems.add("%s: patches[%d]: invalid sha1", name, j)
+		}
+	}
+
+	chunksSize := int64(0)
+	for j, chunk := range file.Chunks {
+		if !shaRegex.MatchString(chunk.Sha) {
+			problems.add("%s: chunks[%d]: sha %q is not a sha1", name, j, chunk.Sha)
+		}
+		if chunk.Size <= 0 || chunk.Size > chunker.MaxSize {
+			problems.add("%s: chunks[%d]: invalid size %d", name, j, chunk.Size)
+		}
+		chunksSize += chunk.Size
+	}
+	if len(file.Chunks) > 0 && chunksSize != file.Size {
+		problems.add("%s: the chunks are %d bytes, the file %d", name, chunksSize, file.Size)
+	}
+
+	if file.Compression != COMPRESSION_NONE {
+		if _, err := file.Compression.codec(); err != nil {
+			problems.add("%s: %w", name, err)
+		}
+		if file.CompressedSize < 0 {
+			problems.add("%s: negative compressed size", name)
+		}
+	}
+}
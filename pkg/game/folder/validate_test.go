@@ -0,0 +1,161 @@
+package folder
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/game/folder/shared"
+	"limeal.fr/launchygo/pkg/utils"
+)
+
+func TestValidatePath(t *testing.T) {
+	for _, p := range []string{"minecraft.jar", "mods/sodium-0.5.jar", "assets/objects/ab/abcdef", ".hidden/file", "config/a b.cfg"} {
+		if err := ValidatePath(p); err != nil {
+			t.Errorf("ValidatePath(%q) = %v, want nil", p, err)
+		}
+	}
+
+	for _, p := range []string{
+		"", "/etc/passwd", "../escape", "mods/../../escape", "mods/./a.jar", "mods//a.jar", "mods/",
+		`mods\a.jar`, `..\escape`, `\\server\share\a.jar`, "//server/share/a.jar", "C:/Windows/a.dll", "c:a.dll",
+		"con", "mods/NUL.txt", "mods/com1.jar", "lpt9", "mods/a.jar:stream", "mods/a?.jar", "mods/a\x00.jar",
+		"mods/a.", "mods/a ",
+	} {
+		if err := ValidatePath(p); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("ValidatePath(%q) = %v, want ErrInvalidPath", p, err)
+		}
+	}
+}
+
+func TestResolvePathSymlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "config"), 0755)
+	if err := os.Symlink(outside, filepath.Join(root, "mods")); err != nil {
+		t.Skip("symbolic links not supported: ", err)
+	}
+	os.Symlink(filepath.Join(root, "config"), filepath.Join(root, "settings"))
+	os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling"))
+
+	if _, err := ResolvePath(root, "mods/evil.jar"); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("link outside: err = %v, want ErrPathEscape", err)
+	}
+	if _, err := ResolvePath(root, "dangling"); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("dangling link: err = %v, want ErrPathEscape", err)
+	}
+	if dest, err := ResolvePath(root, "settings/options.txt"); err != nil || dest != filepath.Join(root, "settings", "options.txt") {
+		t.Errorf("link inside: %s, %v", dest, err)
+	}
+	if _, err := ResolvePath(filepath.Join(root, "missing"), "mods/a.jar"); err != nil {
+		t.Errorf("missing game folder: %v", err)
+	}
+}
+
+func TestValidateManifest(t *testing.T) {
+	sha := utils.BytesSHA1([]byte("content"))
+	manifest := Manifest{
+		MainClass:    shared.MainClass,
+		McVersion:    "1.20.1",
+		JavaBinaries: map[shared.Platform]string{shared.PlatformLinux: "runtime/linux/bin/java"},
+		Files: []FolderFile{
+			{Path: "minecraft.jar", Sha: sha, Size: 7},
+			{Path: "mods/a.jar", Sha: sha, Size: 7, Patches: []FilePatch{{Path: ".patches/a.patch", BaseSha: sha, Sha: sha}}},
+			{Path: "mods/b.jar", Sha: sha, Size: 7, Chunks: []FileChunk{{Sha: sha, Size: 7}}, Compression: COMPRESSION_GZIP},
+		},
+		ChunkStore: "../.chunks",
+	}
+	if err := ValidateManifest(manifest); err != nil {
+		t.Fatalf("valid manifest rejected: %v", err)
+	}
+
+	manifest.MainClass = ""
+	manifest.JavaBinaries[shared.PlatformWindows] = "C:/Windows/System32/cmd.exe"
+	manifest.ChunkStore = "/var/chunks"
+	manifest.Files = append(manifest.Files,
+		FolderFile{Path: "../../.bashrc", Sha: sha},
+		FolderFile{Path: "MODS/A.JAR", Sha: sha},
+		FolderFile{Path: "minecraft.jar/inner", Sha: sha},
+		FolderFile{Path: "mods/c.jar", Sha: "not a sha"},
+		FolderFile{Path: "mods/d.jar", Sha: sha, Size: 10, Chunks: []FileChunk{{Sha: sha, Size: 7}}},
+		FolderFile{Path: "mods/e.jar", Sha: sha, Compression: "rar"},
+		FolderFile{Path: "mods/f.jar", Sha: sha, Patches: []FilePatch{{Path: "/etc/a.patch", BaseSha: sha, Sha: sha}}},
+		FolderFile{Path: ".launchygo/journal.json", Sha: sha},
+	)
+
+	err := ValidateManifest(manifest)
+	var validationErr *ManifestValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("err = %v, want a ManifestValidationError", err)
+	}
+	for _, want := range []string{"mainClass", "javaBinaries[windows]", "chunkStore", `"../../.bashrc"`, "duplicated path",
+		`"minecraft.jar" is a file`, "not a sha1", "the chunks are 7 bytes", `unsupported compression "rar"`, "patches[0]",
+		".launchygo is reserved"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q not reported in:\n%v", want, err)
+		}
+	}
+	if len(validationErr.Problems) != 11 {
+		t.Errorf("%d problems, want 11:\n%v", len(validationErr.Problems), err)
+	}
+}
+
+func TestLoadLegacyManifest(t *testing.T) {
+	// Published before the validation: the java binary of the generator and a file published from Windows
+	connector, manifest := newRemotePack(t, map[string]string{"mods/a.jar": "a"})
+	manifest.Files[0].Path = `mods\a.jar`
+	manifest.JavaBinaries = map[shared.Platform]string{shared.PlatformWindows: `runtime\windows\bin\java.exe`}
+	data, _ := json.Marshal(manifest)
+	connector.SendFileFromBytes(shared.MANIFEST_FILE, data)
+	chdir(t, t.TempDir())
+
+	gameFolder, err := InitGameFolder(connector, "game", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary := gameFolder.Manifest.JavaBinaries[shared.PlatformWindows]; binary != "runtime/windows/bin/java.exe" {
+		t.Errorf("windows java binary = %q", binary)
+	}
+	if err := gameFolder.Build(false, noProgress); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(gameFolder.Path, "mods", "a.jar")); got != "a" {
+		t.Errorf("mods/a.jar = %q", got)
+	}
+}
+
+func TestBuildRejectsPathTraversal(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{"minecraft.jar": "client"})
+	manifest.Files = append(manifest.Files, FolderFile{Path: "../escape.sh", Sha: manifest.Files[0].Sha, Size: 6, Executable: true})
+	connector.SendFileFromBytes("../escape.sh", []byte("client"))
+
+	root := t.TempDir()
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	gameFolder.Path = filepath.Join(root, "instance")
+	if err := gameFolder.Build(false, noProgress); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("err = %v, want ErrInvalidPath", err)
+	}
+	// Nothing is written, not even the valid files
+	if files := listFiles(t, root); len(files) != 0 {
+		t.Errorf("files = %v, want none", files)
+	}
+}
+
+func TestBuildRejectsSymlinkEscape(t *testing.T) {
+	connector, manifest := newRemotePack(t, map[string]string{"mods/evil.jar": "evil"})
+	gameFolder := newTestGameFolder(t, connector, manifest)
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(gameFolder.Path, "mods")); err != nil {
+		t.Skip("symbolic links not supported: ", err)
+	}
+
+	if err := gameFolder.Build(false, noProgress); !errors.Is(err, ErrPathEscape) {
+		t.Errorf("err = %v, want ErrPathEscape", err)
+	}
+	if files := listFiles(t, outside); len(files) != 0 {
+		t.Errorf("written outside of the game folder: %v", files)
+	}
+}
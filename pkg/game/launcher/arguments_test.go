@@ -0,0 +1,156 @@
+package launcher
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"limeal.fr/launchygo/pkg/game/folder"
+	"limeal.fr/launchygo/pkg/game/folder/rules"
+	"limeal.fr/launchygo/pkg/game/profile"
+)
+
+// newTestLauncher returns a launcher on a game folder with one library, the java path is not resolved
+func newTestLauncher(t *testing.T) *Launcher {
+	t.Helper()
+
+	dir := t.TempDir()
+	library := filepath.Join(dir, "libraries", "com", "foo", "foo.jar")
+	os.MkdirAll(filepath.Dir(library), 0755)
+	os.WriteFile(library, []byte("foo"), 0644)
+
+	gameProfile := profile.NewGameProfile()
+	gameProfile.SetUser("Steve")
+
+	launcher := NewLauncher()
+	launcher.gameFolder = &folder.GameFolder{
+		Path:     dir,
+		Manifest: folder.Manifest{Version: "my-pack-1.0", McVersion: "1.20.1", AssetIndex: "5"},
+	}
+	launcher.SetProfile(gameProfile)
+	return launcher
+}
+
+// currentOS returns the os name of the Mojang rules for the current platform
+func currentOS() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "osx"
+	case "windows":
+		return "windows"
+	}
+	return "linux"
+}
+
+func osRule(action string, name string) map[string]any {
+	return map[string]any{"action": action, "os": map[string]any{"name": name}}
+}
+
+func TestParseAndFormatArgsPlaceholders(t *testing.T) {
+	launcher := newTestLauncher(t)
+	parser := NewLauncherArgumentParser(launcher)
+
+	args := parser.parseAndFormatArgs([]any{
+		"--username", "${auth_player_name}",
+		"--version", "${version_name}",
+		"--gameDir", "${game_directory}",
+		"--assetsDir", "${assets_root}",
+		"--assetIndex", "${assets_index_name}",
+		"--uuid", "${auth_uuid}",
+		"-Djava.library.path=${natives_directory}",
+		"${unknown}",
+	})
+
+	dir := launcher.gameFolder.GetPath()
+	want := []string{
+		"--username", "Steve",
+		"--version", "my-pack-1.0",
+		"--gameDir", dir,
+		"--assetsDir", filepath.Join(dir, "assets"),
+		"--assetIndex", "5",
+		"--uuid", "00000000-0000-0000-0000-000000000000",
+		"-Djava.library.path=" + filepath.Join(dir, "natives"),
+		"${unknown}",
+	}
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestParseAndFormatArgsClasspath(t *testing.T) {
+	launcher := newTestLauncher(t)
+	args := NewLauncherArgumentParser(launcher).parseAndFormatArgs([]any{"-cp", "${classpath}"})
+
+	if len(args) != 2 {
+		t.Fatalf("args = %v", args)
+	}
+	classpath := strings.Split(args[1], string(os.PathListSeparator))
+	dir := launcher.gameFolder.GetPath()
+	want := []string{filepath.Join(dir, "minecraft.jar"), filepath.Join(dir, "libraries", "com", "foo", "foo.jar")}
+	if !slices.Equal(classpath, want) {
+		t.Errorf("classpath = %v, want %v", classpath, want)
+	}
+}
+
+func TestParseAndFormatArgsOSRules(t *testing.T) {
+	launcher := newTestLauncher(t)
+	otherOS := "windows"
+	if currentOS() == "windows" {
+		otherOS = "linux"
+	}
+
+	args := NewLauncherArgumentParser(launcher).parseAndFormatArgs([]any{
+		map[string]any{"rules": []any{osRule("allow", currentOS())}, "value": "-Dcurrent=${version_name}"},
+		map[string]any{"rules": []any{osRule("allow", otherOS)}, "value": []any{"-Dother=true", "-Dother2=true"}},
+		map[string]any{"rules": []any{map[string]any{"action": "allow"}, osRule("disallow", currentOS())}, "value": "-Ddisallowed=true"},
+		"-Dplain=true",
+	})
+
+	want := []string{"-Dcurrent=my-pack-1.0", "-Dplain=true"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestParseAndFormatArgsFeatures(t *testing.T) {
+	launcher := newTestLauncher(t)
+	quickPlay := map[string]any{
+		"rules": []any{map[string]any{"action": "allow", "features": map[string]any{"is_quick_play_multiplayer": true}}},
+		"value": []any{"--quickPlayMultiplayer", "${quickPlayMultiplayer}"},
+	}
+	parser := NewLauncherArgumentParser(launcher)
+
+	if args := parser.parseAndFormatArgs([]any{quickPlay}); len(args) != 0 {
+		t.Errorf("args without the feature = %v, want none", args)
+	}
+
+	args := parser.parseAndFormatArgs([]any{quickPlay}, rules.Feature{
+		AKey:  "is_quick_play_multiplayer",
+		Flag:  "quickPlayMultiplayer",
+		Value: "mc.example.com",
+	})
+	if want := []string{"--quickPlayMultiplayer", "mc.example.com"}; !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.20.1", "1.20.1", 0},
+		{"1.20", "1.20.0", 0},
+		{"1.8.9", "1.16", -1},
+		{"1.20.5", "1.20.4", 1},
+		{"1.21", "1.20.6", 1},
+	}
+	for _, test := range tests {
+		if got := versionCmp(test.a, test.b); got != test.want {
+			t.Errorf("versionCmp(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package profile
 
 import (
+	"errors"
 	"strconv"
 
 	"limeal.fr/launchygo/pkg/game/authenticator"
@@ -47,6 +48,15 @@ func (g *GameProfile) SetUser(username string) {
 	g.UserType = string(authenticator.MOJANG)
 }
 
+// AccessToken returns the token of the authenticated player, it can be the token source of the http connector
+// Example: connectors.NewRemoteURLSigner("https://api.example.com/packs/sign", gameProfile.AccessToken)
+func (g *GameProfile) AccessToken() (string, error) {
+	if !g.IsAuthenticated || g.Token == "" {
+		return "", errors.New("the player is not authenticated")
+	}
+	return g.Token, nil
+}
+
 func (g *GameProfile) AuthenticateWithCredentials(authenticator authenticator.Authenticator, username string, password string) error {
 	response, err := authenticator.AuthenticateWithCredentials(username, password)
 	if err != nil {
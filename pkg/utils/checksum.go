@@ -4,6 +4,7 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
+	"hash"
 	"io"
 	"os"
 )
@@ -21,22 +22,32 @@ func BytesSHA256(data []byte) string {
 }
 
 func FileSHA1(path string) string {
-	data, err := os.ReadFile(path)
+	f, err := os.Open(path)
 	if err != nil {
 		return ""
 	}
-	return BytesSHA1(data)
+	sum, err := ReaderSHA1(f)
+	if err != nil {
+		return ""
+	}
+	return sum
 }
 
 func FileSHA256(path string) string {
-	data, err := os.ReadFile(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	sum, err := ReaderSHA256(f)
 	if err != nil {
 		return ""
 	}
-	return BytesSHA256(data)
+	return sum
 }
 
+// ReaderSHA1 hashes and closes the reader
 func ReaderSHA1(rc io.ReadCloser) (string, error) {
+	defer rc.Close()
 	h := sha1.New()
 	if _, err := io.Copy(h, rc); err != nil {
 		return "", err
@@ -44,10 +55,50 @@ func ReaderSHA1(rc io.ReadCloser) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// ReaderSHA256 hashes and closes the reader
 func ReaderSHA256(rc io.ReadCloser) (string, error) {
+	defer rc.Close()
 	h := sha256.New()
 	if _, err := io.Copy(h, rc); err != nil {
 		return "", err
 	}
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
+
+/////////////////////////////////////////////////////////////////////
+// Streaming checksum
+/////////////////////////////////////////////////////////////////////
+
+// ChecksumReader hashes the data while it is read, so a stream can be verified without a second read
+type ChecksumReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	read   int64
+}
+
+func NewSHA1Reader(r io.Reader) *ChecksumReader {
+	return &ChecksumReader{reader: r, hash: sha1.New()}
+}
+
+func NewSHA256Reader(r io.Reader) *ChecksumReader {
+	return &ChecksumReader{reader: r, hash: sha256.New()}
+}
+
+func (r *ChecksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.hash.Write(p[:n])
+		r.read += int64(n)
+	}
+	return n, err
+}
+
+// Sum returns the hex checksum of the data read so far
+func (r *ChecksumReader) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// Size returns the number of bytes read so far
+func (r *ChecksumReader) Size() int64 {
+	return r.read
+}
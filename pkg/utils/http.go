@@ -3,12 +3,14 @@ package utils
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 type RequestOptions[T any] struct {
@@ -18,6 +20,7 @@ type RequestOptions[T any] struct {
 	QueryParams map[string]string
 	Result      *T
 	Debug       bool
+	Client      *http.Client // nil for the shared client (e.g. a connector with its own proxy or certificates)
 }
 
 func NewRequestOptions[T any](contentType string, result *T) *RequestOptions[T] {
@@ -65,8 +68,90 @@ func (o *RequestOptions[T]) SetBody(body any) {
 }
 
 func DoRequest[T any](method string, uri string, options *RequestOptions[T]) ([]byte, error) {
-	httpClient := &http.Client{}
+	resp, err := DoStreamRequest(method, uri, options)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bytesBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if options != nil && options.Result != nil {
+		err = json.Unmarshal(bytesBody, options.Result)
+		return nil, err
+	}
+
+	return bytesBody, nil
+}
+
+// DoStreamRequest sends the request and returns the response without reading the body
+// The caller must close the response body
+// The body of GET responses resumes with a Range request if the connection is interrupted (server supporting ranges only)
+func DoStreamRequest[T any](method string, uri string, options *RequestOptions[T]) (*http.Response, error) {
+	req, err := newRequest(method, uri, options)
+	if err != nil {
+		return nil, err
+	}
+
+	client := requestClient(options)
+	resp, err := sendRequest(client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if method == http.MethodGet && resp.StatusCode == http.StatusOK {
+		if validator := ResponseValidator(resp); validator != "" && resp.Header.Get("Accept-Ranges") == "bytes" {
+			resp.Body = &resumableBody{ReadCloser: resp.Body, client: client, request: req, validator: validator}
+		}
+	}
+
+	return resp, nil
+}
 
+/**
+* Send a GET request for the content starting at offset, used to resume a download (e.g. from a .part file)
+* If validator is set (ETag or Last-Modified of the interrupted response) it is sent with If-Range,
+* so the server sends the whole content if the file changed in the meantime
+* resumed is false when the server sent the whole content (no range support or changed file)
+* Example:
+* ```
+* resp, resumed, err := utils.DoRangeRequest[[]byte](url, partSize, "", nil)
+* ```
+ */
+func DoRangeRequest[T any](uri string, offset int64, validator string, options *RequestOptions[T]) (*http.Response, bool, error) {
+	req, err := newRequest(http.MethodGet, uri, options)
+	if err != nil {
+		return nil, false, err
+	}
+	return sendRangeRequest(requestClient(options), req, offset, validator)
+}
+
+func sendRangeRequest(client *http.Client, req *http.Request, offset int64, validator string) (*http.Response, bool, error) {
+	rangeReq := req
+	if offset > 0 {
+		rangeReq = req.Clone(req.Context())
+		rangeReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			rangeReq.Header.Set("If-Range", validator)
+		}
+	}
+
+	resp, err := sendRequest(client, rangeReq)
+	if err != nil {
+		// The part is already complete (or bigger than the file)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return sendRangeRequest(client, req, 0, "")
+		}
+		return nil, false, err
+	}
+	return resp, offset > 0 && resp.StatusCode == http.StatusPartialContent, nil
+}
+
+func newRequest[T any](method string, uri string, options *RequestOptions[T]) (*http.Request, error) {
 	if options != nil && len(options.QueryParams) > 0 {
 		queryParams := url.Values{}
 		for key, value := range options.QueryParams {
@@ -90,42 +175,109 @@ func DoRequest[T any](method string, uri string, options *RequestOptions[T]) ([]
 			req.Header.Set(key, value)
 		}
 	}
+	return req, nil
+}
+
+// requestClient returns the client of the options, or the shared client
+func requestClient[T any](options *RequestOptions[T]) *http.Client {
+	if options != nil && options.Client != nil {
+		return options.Client
+	}
+	return httpClient
+}
 
+// sendRequest sends the request with DefaultRetryPolicy
+func sendRequest(client *http.Client, req *http.Request) (*http.Response, error) {
 	//fmt.Println("[*] Request:", req.URL.String())
 	//fmt.Println("[*] Request Headers:", req.Header)
-	//fmt.Println("[*] Request Body:", body)
 
-	resp, err := httpClient.Do(req)
+	resp, err := DefaultRetryPolicy.Do(client, req)
 	if err != nil {
 		return nil, err
 	}
 
 	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		if resp.Header.Get("Content-Type") == "application/json" {
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return nil, err
-			}
-			var errorResponse map[string]string
-			err = json.Unmarshal(body, &errorResponse)
-			if err != nil {
-				return nil, err
-			}
-			return nil, fmt.Errorf("status code: %d, body: %s", resp.StatusCode, errorResponse["error_description"])
-		} else {
-			return nil, fmt.Errorf("status code: %d", resp.StatusCode)
-		}
+		defer resp.Body.Close()
+		return nil, responseError(resp)
 	}
 
-	bytesBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	return resp, nil
+}
+
+// ResponseValidator returns the validator to send with If-Range: a strong ETag or the Last-Modified date
+func ResponseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
 	}
+	return resp.Header.Get("Last-Modified")
+}
 
-	if options != nil && options.Result != nil {
-		err = json.Unmarshal(bytesBody, options.Result)
-		return nil, err
+// maxResumeAttempts is the number of times an interrupted response body is resumed
+const maxResumeAttempts = 5
+
+// resumableBody resumes the download with a Range request when reading the body fails
+type resumableBody struct {
+	io.ReadCloser
+	client    *http.Client
+	request   *http.Request
+	validator string
+	offset    int64
+	attempts  int
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.offset += int64(n)
+	if err == nil || err == io.EOF || b.attempts >= maxResumeAttempts {
+		return n, err
 	}
 
-	return bytesBody, nil
+	b.attempts++
+	resp, resumed, rerr := sendRangeRequest(b.client, b.request, b.offset, b.validator)
+	if rerr != nil {
+		return n, err
+	}
+	if !resumed {
+		// The file changed on the server, the data already read can't be completed
+		resp.Body.Close()
+		return n, err
+	}
+
+	b.ReadCloser.Close()
+	b.ReadCloser = resp.Body
+	if n > 0 {
+		return n, nil
+	}
+	return b.Read(p)
+}
+
+// StatusError is returned when the server answers with a non 2xx status code
+type StatusError struct {
+	StatusCode  int
+	Description string        // error_description of json error responses
+	RetryAfter  time.Duration // Retry-After header of 429 and 503 responses
+}
+
+func (e *StatusError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("status code: %d, body: %s", e.StatusCode, e.Description)
+	}
+	return fmt.Sprintf("status code: %d", e.StatusCode)
+}
+
+func responseError(resp *http.Response) error {
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	if resp.Header.Get("Content-Type") == "application/json" {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		var errorResponse map[string]string
+		err = json.Unmarshal(body, &errorResponse)
+		if err != nil {
+			return err
+		}
+		return &StatusError{StatusCode: resp.StatusCode, Description: errorResponse["error_description"], RetryAfter: retryAfter}
+	}
+	return &StatusError{StatusCode: resp.StatusCode, RetryAfter: retryAfter}
 }
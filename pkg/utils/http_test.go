@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCutServer serves content, the first GET is cut after half of the body
+func newCutServer(t *testing.T, content string, etag string) (*httptest.Server, *[]string) {
+	t.Helper()
+	ranges := []string{}
+	var cut atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("Range") == "" && !cut.Swap(true) {
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", "100")
+			io.WriteString(w, content[:50])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		ranges = append(ranges, r.Header.Get("Range")+" "+r.Header.Get("If-Range"))
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server, &ranges
+}
+
+func TestDoStreamRequestResumesCutBody(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	server, ranges := newCutServer(t, content, `"v1"`)
+
+	resp, err := DoStreamRequest[[]byte](http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || string(data) != content {
+		t.Fatalf("body = %q, %v, want the whole content", data, err)
+	}
+	if len(*ranges) != 1 || (*ranges)[0] != `bytes=50- "v1"` {
+		t.Errorf("range requests = %q, want the rest of the content if it didn't change", *ranges)
+	}
+}
+
+func TestDoRangeRequest(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	read := func(offset int64, validator string) (string, bool) {
+		t.Helper()
+		resp, resumed, err := DoRangeRequest[[]byte](server.URL, offset, validator, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return string(data), resumed
+	}
+
+	if data, resumed := read(40, `"v2"`); !resumed || data != content[40:] {
+		t.Errorf("resumed %v with %q, want the content from the offset", resumed, data)
+	}
+	// The file changed since the part was downloaded
+	if data, resumed := read(40, `"v1"`); resumed || data != content {
+		t.Errorf("resumed %v with %d bytes, want the whole content", resumed, len(data))
+	}
+	// The part is already complete
+	if data, resumed := read(100, ""); resumed || data != content {
+		t.Errorf("resumed %v with %d bytes, want the whole content", resumed, len(data))
+	}
+}
@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// PROXY_DIRECT disables the proxy, including the one of the environment
+const PROXY_DIRECT = "direct"
+
+/**
+* Proxy and TLS options of the network connections
+* The zero value uses the proxy of the environment (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) and the system certificates
+* Example:
+* ```
+* err := utils.ConfigureHTTPClient(utils.NetworkOptions{
+*     Proxy:    "socks5://proxy.school.example:1080",
+*     CAFile:   "/etc/launchygo/ca.pem",
+*     CertFile: "/etc/launchygo/client.pem",
+*     KeyFile:  "/etc/launchygo/client.key",
+* })
+* ```
+ */
+type NetworkOptions struct {
+	Proxy    string // http://, https://, socks5:// or socks5h:// proxy url, "" for the environment, PROXY_DIRECT for none
+	CAFile   string // PEM bundle of the certificate authorities trusted in addition to the system ones
+	CertFile string // PEM client certificate sent to the servers requiring mTLS, with KeyFile
+	KeyFile  string // PEM private key of CertFile
+}
+
+// IsZero reports whether the options are the defaults
+func (o NetworkOptions) IsZero() bool {
+	return o == NetworkOptions{}
+}
+
+// Merge fills the unset options with the given ones
+func (o NetworkOptions) Merge(other NetworkOptions) NetworkOptions {
+	if o.Proxy == "" {
+		o.Proxy = other.Proxy
+	}
+	if o.CAFile == "" {
+		o.CAFile = other.CAFile
+	}
+	if o.CertFile == "" && o.KeyFile == "" {
+		o.CertFile = other.CertFile
+		o.KeyFile = other.KeyFile
+	}
+	return o
+}
+
+// TLSConfig returns the TLS configuration with the CA bundle and the client certificate, nil when none is set
+func (o NetworkOptions) TLSConfig() (*tls.Config, error) {
+	if o.CAFile == "" && o.CertFile == "" && o.KeyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if o.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		data, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in the CA bundle %s", o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return nil, fmt.Errorf("the client certificate needs both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// ProxyFunc returns the proxy selection of the HTTP transports
+func (o NetworkOptions) ProxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	switch o.Proxy {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case PROXY_DIRECT:
+		return nil, nil
+	}
+
+	proxyURL, err := parseProxyURL(o.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// ProxyForHost returns the proxy to reach host from a non HTTP client (e.g. SFTP), nil to connect directly
+// Without Proxy option, ALL_PROXY is used unless the host matches NO_PROXY
+func (o NetworkOptions) ProxyForHost(host string) (*url.URL, error) {
+	switch o.Proxy {
+	case PROXY_DIRECT:
+		return nil, nil
+	case "":
+		proxy := getEnvAny("ALL_PROXY", "all_proxy")
+		if proxy == "" || matchNoProxy(getEnvAny("NO_PROXY", "no_proxy"), host) {
+			return nil, nil
+		}
+		return parseProxyURL(proxy)
+	}
+	return parseProxyURL(o.Proxy)
+}
+
+/**
+* Create a HTTP transport with the proxy and TLS options, on top of the settings of NewTransport
+* Example:
+* ```
+* transport, err := utils.NewTransportWithOptions(utils.NetworkOptions{CAFile: "ca.pem"})
+* ```
+ */
+func NewTransportWithOptions(options NetworkOptions) (*http.Transport, error) {
+	transport := NewTransport()
+
+	proxy, err := options.ProxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
+	tlsConfig, err := options.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// NewHTTPClient returns a client using the options, the shared client when the options are the defaults
+func NewHTTPClient(options NetworkOptions) (*http.Client, error) {
+	if options.IsZero() {
+		return HTTPClient(), nil
+	}
+	transport, err := NewTransportWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// ConfigureHTTPClient replaces the shared client by a client using the options
+func ConfigureHTTPClient(options NetworkOptions) error {
+	if options.IsZero() {
+		return nil
+	}
+	transport, err := NewTransportWithOptions(options)
+	if err != nil {
+		return err
+	}
+	SetHTTPClient(&http.Client{Transport: transport})
+	return nil
+}
+
+func parseProxyURL(proxy string) (*url.URL, error) {
+	// Like curl, a proxy without scheme is a HTTP proxy
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (http, https, socks5, socks5h)", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", proxy)
+	}
+	return proxyURL, nil
+}
+
+func getEnvAny(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// matchNoProxy reports whether host is excluded by the NO_PROXY list ("*", hosts, domains and IPs, with or without leading dot)
+func matchNoProxy(noProxy string, host string) bool {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		case host == strings.TrimPrefix(entry, "."):
+			return true
+		case strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")):
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(host); ip != nil && network.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,371 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testPKI is a certificate authority signing the server and client certificates of the tests
+type testPKI struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	CAFile string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "launchygo test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+
+	pki := &testPKI{dir: t.TempDir(), ca: ca, caKey: key}
+	pki.CAFile = pki.write(t, "ca.pem", "CERTIFICATE", der)
+	return pki
+}
+
+func (p *testPKI) write(t *testing.T, name string, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(p.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue returns a certificate signed by the CA, and the paths of its PEM files
+func (p *testPKI) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (tls.Certificate, string, string) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := p.write(t, name+".pem", "CERTIFICATE", der)
+	keyFile := p.write(t, name+".key", "EC PRIVATE KEY", keyDer)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+// newMTLSServer starts a HTTPS server with a certificate of the PKI, requiring a client certificate of the PKI
+func newMTLSServer(t *testing.T, pki *testPKI) *httptest.Server {
+	t.Helper()
+	serverCert, _, _ := pki.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(pki.ca)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello "+r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNetworkOptionsMTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	server := newMTLSServer(t, pki)
+	_, certFile, keyFile := pki.issue(t, "launcher", x509.ExtKeyUsageClientAuth)
+
+	client, err := NewHTTPClient(NetworkOptions{Proxy: PROXY_DIRECT, CAFile: pki.CAFile, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hello launcher" {
+		t.Errorf("body = %q", body)
+	}
+
+	// Without the client certificate the server closes the connection
+	client, _ = NewHTTPClient(NetworkOptions{Proxy: PROXY_DIRECT, CAFile: pki.CAFile})
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("expected an error without client certificate")
+	}
+
+	// Without the CA the server certificate is rejected
+	client, _ = NewHTTPClient(NetworkOptions{Proxy: PROXY_DIRECT, CertFile: certFile, KeyFile: keyFile})
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("expected an error with an unknown certificate authority")
+	}
+}
+
+func TestNetworkOptionsInvalidFiles(t *testing.T) {
+	pki := newTestPKI(t)
+	_, certFile, _ := pki.issue(t, "launcher", x509.ExtKeyUsageClientAuth)
+
+	tests := []NetworkOptions{
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{CAFile: certFile + ".missing"},
+		{CertFile: certFile},
+		{Proxy: "ftp://proxy.example"},
+	}
+	for _, options := range tests {
+		if _, err := NewHTTPClient(options); err == nil {
+			t.Errorf("NewHTTPClient(%+v): expected an error", options)
+		}
+	}
+}
+
+func TestNetworkOptionsHTTPProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		io.WriteString(w, "from proxy")
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(NetworkOptions{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://packs.example/manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied != "http://packs.example/manifest.json" {
+		t.Errorf("proxied %q", proxied)
+	}
+}
+
+// startSOCKS5Proxy starts a SOCKS5 proxy accepting the given credentials (none if username is empty)
+// It returns the address of the proxy and a channel receiving the requested destinations
+func startSOCKS5Proxy(t *testing.T, username string, password string) (string, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	destinations := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, username, password, destinations)
+		}
+	}()
+	return listener.Addr().String(), destinations
+}
+
+func serveSOCKS5(conn net.Conn, username string, password string, destinations chan string) {
+	defer conn.Close()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	io.ReadFull(conn, methods)
+
+	if username == "" {
+		conn.Write([]byte{5, 0})
+	} else {
+		conn.Write([]byte{5, 2})
+		auth := make([]byte, 2)
+		io.ReadFull(conn, auth)
+		user := make([]byte, auth[1])
+		io.ReadFull(conn, user)
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		pass := make([]byte, length[0])
+		io.ReadFull(conn, pass)
+		if string(user) != username || string(pass) != password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	request := make([]byte, 4)
+	io.ReadFull(conn, request)
+	var host string
+	switch request[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		name := make([]byte, length[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+	destination := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	destinations <- destination
+
+	// The test servers listen on 127.0.0.1, the host names are resolved to it
+	_, targetPort, _ := net.SplitHostPort(destination)
+	target, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", targetPort))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestSOCKS5Dialer(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(conn, conn); conn.Close() }()
+		}
+	}()
+	_, echoPort, _ := net.SplitHostPort(echo.Addr().String())
+
+	proxyAddress, destinations := startSOCKS5Proxy(t, "steve", "secret")
+	proxyURL, _ := url.Parse("socks5h://steve:secret@" + proxyAddress)
+	dialer, err := ProxyDialer(proxyURL, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "sftp.example:"+echoPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Errorf("reply = %q, %v", reply, err)
+	}
+	// socks5h sends the host name to the proxy
+	if destination := <-destinations; destination != "sftp.example:"+echoPort {
+		t.Errorf("destination = %s", destination)
+	}
+
+	proxyURL, _ = url.Parse("socks5://steve:wrong@" + proxyAddress)
+	dialer, _ = ProxyDialer(proxyURL, 5*time.Second)
+	if _, err := dialer.DialContext(context.Background(), "tcp", "127.0.0.1:"+echoPort); err == nil {
+		t.Error("expected an authentication error")
+	}
+
+	if _, err := ProxyDialer(&url.URL{Scheme: "http", Host: proxyAddress}, time.Second); err == nil {
+		t.Error("expected an error for a HTTP proxy")
+	}
+}
+
+func TestNetworkOptionsSOCKS5Proxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+	proxyAddress, destinations := startSOCKS5Proxy(t, "", "")
+
+	client, err := NewHTTPClient(NetworkOptions{Proxy: "socks5://" + proxyAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if destination := <-destinations; destination != server.Listener.Addr().String() {
+		t.Errorf("destination = %s, want %s", destination, server.Listener.Addr())
+	}
+}
+
+func TestProxyForHost(t *testing.T) {
+	t.Setenv("ALL_PROXY", "socks5://proxy.example:1080")
+	t.Setenv("NO_PROXY", "localhost,.internal.example,10.0.0.0/8")
+
+	tests := []struct {
+		options NetworkOptions
+		host    string
+		want    string
+	}{
+		{NetworkOptions{}, "sftp.example", "socks5://proxy.example:1080"},
+		{NetworkOptions{}, "localhost", ""},
+		{NetworkOptions{}, "packs.internal.example", ""},
+		{NetworkOptions{}, "10.1.2.3", ""},
+		{NetworkOptions{Proxy: "socks5h://other:1080"}, "localhost", "socks5h://other:1080"},
+		{NetworkOptions{Proxy: PROXY_DIRECT}, "sftp.example", ""},
+	}
+	for _, test := range tests {
+		proxyURL, err := test.options.ProxyForHost(test.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+		if got != test.want {
+			t.Errorf("ProxyForHost(%+v, %s) = %q, want %q", test.options, test.host, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+* Token bucket limiting the bandwidth of the readers sharing it
+* The bucket holds up to one second of data, so short bursts are allowed after an idle period
+* Example:
+* ```
+* limiter := utils.NewRateLimiter(2 * 1024 * 1024) // 2 MiB/s shared by every download
+* io.Copy(dst, limiter.Reader(src))
+* ```
+ */
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second
+	burst  float64 // Capacity of the bucket
+	tokens float64 // Can be negative, the readers wait until the debt is paid back
+	last   time.Time
+
+	now   func() time.Time // Replaced by the tests
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter returns a limiter of bytesPerSecond, nil (no limit) when bytesPerSecond <= 0
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// WaitN takes n bytes from the bucket, waiting until they are available
+// The bytes are reserved before waiting so the concurrent readers are served in turn
+func (l *RateLimiter) WaitN(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if wait > 0 {
+		l.sleep(wait)
+	}
+}
+
+// Reader returns a reader of r limited by the bucket, r itself when there is no limit
+func (l *RateLimiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &rateLimitedReader{r: r, limiter: l}
+}
+
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	// Reading more than the bucket would make the other readers wait for a long time
+	if len(p) > int(r.limiter.burst) {
+		p = p[:int(r.limiter.burst)]
+	}
+	n, err := r.r.Read(p)
+	r.limiter.WaitN(n)
+	return n, err
+}
+
+/**
+* Parse a byte rate like "500K", "2M", "1.5MB" or "1048576" (bytes per second), the units are powers of 1024
+* "0" and "" mean no limit
+* Example:
+* ```
+* limit, err := utils.ParseByteRate("2M") // 2097152
+* ```
+ */
+func ParseByteRate(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(s, "/S"), "B"), "I") // 2MiB/s, 2MB, 2M
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := 1.0
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q (e.g. 500K, 2M)", value)
+	}
+	return int64(n * multiplier), nil
+}
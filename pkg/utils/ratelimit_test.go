@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withFakeClock makes the limiter sleep on a fake clock, it returns the total wait
+func withFakeClock(limiter *RateLimiter) *time.Duration {
+	var waited time.Duration
+	now := time.Now()
+	limiter.last = now
+	limiter.now = func() time.Time { return now.Add(waited) }
+	limiter.sleep = func(d time.Duration) { waited += d }
+	return &waited
+}
+
+func TestRateLimiterWaits(t *testing.T) {
+	limiter := NewRateLimiter(1000)
+	waited := withFakeClock(limiter)
+
+	// The bucket starts full, then the data is sent at the rate
+	data, err := io.ReadAll(limiter.Reader(strings.NewReader(strings.Repeat("x", 3000))))
+	if err != nil || len(data) != 3000 {
+		t.Fatalf("read %d bytes, %v", len(data), err)
+	}
+	if *waited < 1900*time.Millisecond || *waited > 2100*time.Millisecond {
+		t.Errorf("waited %v, want about 2s", *waited)
+	}
+}
+
+func TestRateLimiterReadsAtMostTheBucket(t *testing.T) {
+	limiter := NewRateLimiter(100)
+	withFakeClock(limiter)
+
+	n, _ := limiter.Reader(bytes.NewReader(make([]byte, 1000))).Read(make([]byte, 1000))
+	if n != 100 {
+		t.Errorf("read %d bytes, want 100", n)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	var limiter *RateLimiter = NewRateLimiter(0)
+	if limiter != nil {
+		t.Fatal("expected no limiter")
+	}
+
+	r := strings.NewReader("foo")
+	if limiter.Reader(r) != io.Reader(r) {
+		t.Error("the reader is wrapped without limit")
+	}
+	limiter.WaitN(1 << 30)
+}
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"1048576", 1048576},
+		{"500K", 500 * 1024},
+		{"2M", 2 * 1024 * 1024},
+		{"2MB", 2 * 1024 * 1024},
+		{"2MiB/s", 2 * 1024 * 1024},
+		{"1.5m", 1536 * 1024},
+		{"1G", 1 << 30},
+	}
+	for _, test := range tests {
+		got, err := ParseByteRate(test.value)
+		if err != nil || got != test.want {
+			t.Errorf("ParseByteRate(%q) = %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+
+	for _, value := range []string{"fast", "-1M", "2T"} {
+		if _, err := ParseByteRate(value); err == nil {
+			t.Errorf("ParseByteRate(%q): expected an error", value)
+		}
+	}
+}
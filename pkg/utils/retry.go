@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+/**
+* Retry policy of the network operations
+* Attempts are spaced with an exponential backoff with jitter, a Retry-After header overrides the backoff
+* Example:
+* ```
+* utils.DefaultRetryPolicy = utils.RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: time.Minute}
+* ```
+ */
+type RetryPolicy struct {
+	MaxAttempts    int           // Total number of attempts, 1 disables the retries
+	InitialBackoff time.Duration // Wait before the second attempt, doubled after each attempt
+	MaxBackoff     time.Duration // Upper bound of the wait between two attempts (Retry-After included)
+	RequestTimeout time.Duration // Timeout of one attempt until the response headers are received, 0 for none
+	Timeout        time.Duration // Overall timeout of the attempts and the waits between them, 0 for none
+}
+
+// DefaultRetryPolicy is used by the shared HTTP layer (DoRequest, DoStreamRequest...) and the builders
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	RequestTimeout: 30 * time.Second,
+	Timeout:        5 * time.Minute,
+}
+
+// NoRetryPolicy sends the requests once
+var NoRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+/////////////////////////////////////////////////////////////////////
+// Transport
+/////////////////////////////////////////////////////////////////////
+
+// NewTransport returns a transport tuned for many parallel downloads on a few hosts
+// The proxy is read from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   15 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32, // The default (2) closes the connections of the download workers
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// httpClient is shared by every request so the connections are reused
+// There is no client timeout, it would also cut the read of big bodies, see RetryPolicy.RequestTimeout
+var httpClient = &http.Client{Transport: NewTransport()}
+
+// HTTPClient returns the client shared by the HTTP layer and the HTTP based connectors
+func HTTPClient() *http.Client {
+	return httpClient
+}
+
+// SetHTTPClient replaces the shared client (e.g. to use a custom transport)
+func SetHTTPClient(client *http.Client) {
+	httpClient = client
+}
+
+/////////////////////////////////////////////////////////////////////
+// Retry
+/////////////////////////////////////////////////////////////////////
+
+// Backoff returns the wait before the next attempt, attempt starts at 1 (the attempt which failed)
+// A positive retryAfter (Retry-After header) is used instead of the exponential backoff
+func (p RetryPolicy) Backoff(attempt int, retryAfter time.Duration) time.Duration {
+	wait := retryAfter
+	if wait <= 0 {
+		wait = p.InitialBackoff
+		for i := 1; i < attempt && (p.MaxBackoff <= 0 || wait < p.MaxBackoff); i++ {
+			wait *= 2
+		}
+		// Equal jitter: half of the backoff is random, so the workers don't retry all at once
+		if wait > 1 {
+			wait = wait/2 + rand.N(wait/2)
+		}
+	}
+
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// next waits before the next attempt, it returns false if there is no attempt left or the overall timeout would be exceeded
+func (p RetryPolicy) next(attempt int, start time.Time, err error, transient func(error) bool) bool {
+	if attempt >= p.MaxAttempts || !transient(err) {
+		return false
+	}
+
+	var retryAfter time.Duration
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		retryAfter = statusErr.RetryAfter
+	}
+
+	wait := p.Backoff(attempt, retryAfter)
+	if p.Timeout > 0 && time.Since(start)+wait > p.Timeout {
+		return false
+	}
+	time.Sleep(wait)
+	return true
+}
+
+/**
+* Run the operation until it succeeds, fails with a permanent error or the policy gives up
+* Only the transient errors are retried, see IsTransientError
+* Example:
+* ```
+* err := utils.DefaultRetryPolicy.Retry(func() error {
+*     return connector.SendFile("mods/foo.jar", "packs/my-pack/mods/foo.jar")
+* })
+* ```
+ */
+func (p RetryPolicy) Retry(fn func() error) error {
+	return p.RetryIf(IsTransientError, fn)
+}
+
+// RetryIf is like Retry with a custom classification of the transient errors
+func (p RetryPolicy) RetryIf(transient func(error) bool, fn func() error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !p.next(attempt, start, err, transient) {
+			return err
+		}
+	}
+}
+
+/**
+* Send the request with the client following the policy
+* Transient network errors and 5xx, 429 and 408 responses are retried
+* When the attempts are exhausted the last response is returned as is, the caller handles its status code
+* The request body is sent again only if it can be rewound (http.NewRequest with a bytes or strings reader)
+* Non idempotent requests (POST, PATCH) are only retried when the server didn't process them (429, 503, connection refused)
+ */
+func (p RetryPolicy) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		resp, err := p.send(client, req)
+
+		attemptErr := err
+		if err == nil && isRetryableStatus(resp.StatusCode) {
+			attemptErr = &StatusError{StatusCode: resp.StatusCode, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		}
+		if attemptErr == nil || !canResend(req, attemptErr) {
+			return resp, err
+		}
+
+		if !p.next(attempt, start, attemptErr, IsTransientError) {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain a bit of the body so the connection can be reused
+			io.CopyN(io.Discard, resp.Body, 4096)
+			resp.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// send sends one attempt, the request timeout only applies until the response headers are received
+func (p RetryPolicy) send(client *http.Client, req *http.Request) (*http.Response, error) {
+	if p.RequestTimeout <= 0 {
+		return client.Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(p.RequestTimeout, cancel)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if !timer.Stop() && err != nil {
+		cancel()
+		return nil, &timeoutError{err: err}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// canResend tells if the request can be sent again after the error
+func canResend(req *http.Request, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, "PROPFIND", "MKCOL":
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func isRetryableStatus(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout
+}
+
+/**
+* IsTransientError tells if the operation may succeed if it is tried again:
+* retryable status codes (5xx, 429, 408), timeouts, reset or refused connections and truncated responses
+* Permanent errors (404, 403, invalid certificate, file not found...) are not transient
+ */
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Checked before context.Canceled, the attempt context is canceled on timeout
+	var timeoutErr *timeoutError
+	if errors.As(err, &timeoutErr) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return isRetryableStatus(statusErr.StatusCode)
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// A keep-alive connection closed by the server before the response
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && errors.Is(urlErr.Err, io.EOF)
+}
+
+// parseRetryAfter parses the Retry-After header, in seconds or as an http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// timeoutError is returned when an attempt exceeds the request timeout
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string   { return "request timeout: " + e.err.Error() }
+func (e *timeoutError) Unwrap() error   { return e.err }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// cancelBody releases the context of the attempt once the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
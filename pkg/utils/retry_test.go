@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries quickly so the tests don't wait for the backoff
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Second}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for range 20 {
+		// Doubled after each attempt, half of it is random
+		if wait := policy.Backoff(3, 0); wait < 200*time.Millisecond || wait >= 400*time.Millisecond {
+			t.Fatalf("backoff of the attempt 3 = %s, want between 200ms and 400ms", wait)
+		}
+		if wait := policy.Backoff(10, 0); wait > time.Second {
+			t.Fatalf("backoff = %s, want at most MaxBackoff", wait)
+		}
+	}
+	if wait := policy.Backoff(1, 700*time.Millisecond); wait != 700*time.Millisecond {
+		t.Errorf("backoff = %s, want the Retry-After", wait)
+	}
+	if wait := policy.Backoff(1, time.Hour); wait != time.Second {
+		t.Errorf("backoff = %s, want the Retry-After bounded by MaxBackoff", wait)
+	}
+}
+
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	start := time.Now()
+	resp, err := testRetryPolicy.Do(server.Client(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || requests.Load() != 2 {
+		t.Errorf("status %d after %d requests, want 200 after 2", resp.StatusCode, requests.Load())
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %s, want the 1s of Retry-After", elapsed)
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// The last response is returned to the caller
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := testRetryPolicy.Do(server.Client(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || requests.Load() != 3 {
+		t.Errorf("status %d after %d requests, want 502 after the 3 attempts", resp.StatusCode, requests.Load())
+	}
+
+	// Permanent errors are not retried
+	requests.Store(0)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(w, r)
+	})
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	if resp, err = testRetryPolicy.Do(server.Client(), req); err == nil {
+		resp.Body.Close()
+	}
+	if requests.Load() != 1 {
+		t.Errorf("404 sent %d times, want 1", requests.Load())
+	}
+}
+
+func TestRetryPolicyNonIdempotentRequests(t *testing.T) {
+	var requests atomic.Int32
+	var status atomic.Int32
+	bodies := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	send := func(method string, body io.Reader, code int) int32 {
+		t.Helper()
+		requests.Store(0)
+		status.Store(int32(code))
+		req, _ := http.NewRequest(method, server.URL, body)
+		resp, err := testRetryPolicy.Do(server.Client(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return requests.Load()
+	}
+
+	// The server may have processed the POST
+	if n := send(http.MethodPost, strings.NewReader("order"), http.StatusInternalServerError); n != 1 {
+		t.Errorf("POST answered with 500 sent %d times, want 1", n)
+	}
+	// 503 tells the request was not processed
+	if n := send(http.MethodPost, strings.NewReader("order"), http.StatusServiceUnavailable); n != 3 {
+		t.Errorf("POST answered with 503 sent %d times, want 3", n)
+	}
+	// A body which can't be rewound is sent once
+	if n := send(http.MethodPut, io.NopCloser(bytes.NewReader([]byte("file"))), http.StatusInternalServerError); n != 1 {
+		t.Errorf("PUT with a stream body sent %d times, want 1", n)
+	}
+	// The rewound body is sent again as a whole
+	if n := send(http.MethodPut, bytes.NewReader([]byte("file")), http.StatusInternalServerError); n != 3 {
+		t.Errorf("PUT sent %d times, want 3", n)
+	}
+
+	close(bodies)
+	for body := range bodies {
+		if body != "order" && body != "file" {
+			t.Errorf("body = %q, want the whole body on each attempt", body)
+		}
+	}
+}